@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/p4u/enguardia-arxiu/internal/backend"
+	"github.com/p4u/enguardia-arxiu/internal/catalog"
+	"github.com/p4u/enguardia-arxiu/internal/generator"
+)
+
+const catalogUsage = "Invalid catalog command. Use: catalog import, catalog export or catalog query \"<SQL>\""
+
+func (a *app) catalog(args []string) int {
+	fs := a.newFlagSet()
+	common := a.addCommonFlags(fs)
+	dir := fs.String("dir", "", "directory the episode JSON files are exported to (default: the data directory)")
+	dryRun := dryRunFlag(fs)
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+	action := fs.Arg(0)
+	if action != "import" && action != "export" && action != "query" || action == "query" && fs.NArg() < 2 {
+		fmt.Fprintln(a.stderr, catalogUsage)
+		return exitUsage
+	}
+
+	cfg, prog, err := common.loadProgram()
+	if err != nil {
+		return fail("Invalid configuration", "error", err)
+	}
+
+	// Queries only read the catalogue
+	if action != "query" {
+		unlock, err := a.lockDataDirs(*dryRun, cfg.DataDir)
+		if err != nil {
+			return fail("Failed to lock data directory", "error", err)
+		}
+		defer unlock()
+	}
+
+	c, err := catalog.Open(catalog.Path(cfg.DataDir))
+	if err != nil {
+		return fail("Failed to open catalog", "error", err)
+	}
+	defer c.Close()
+
+	switch action {
+	case "import":
+		media, err := backend.New(cfg.DataDir, backendOptions(cfg, prog.Slug)).List(a.ctx, "")
+		if err != nil {
+			return fail("Failed to list media", "error", err)
+		}
+		if media == nil {
+			media = []backend.Info{} // Nothing stored yet, still refresh the media state
+		}
+		tagSystem := generator.NewTagSystemWithOptions(cfg.DataDir, generatorOptions(cfg, prog))
+		stats, err := c.Sync(a.ctx, cfg.DataDir, catalog.SyncOptions{
+			Media:            media,
+			MinAudioFileSize: cfg.Storage.MinAudioFileSize,
+			MinImageFileSize: cfg.Storage.MinImageFileSize,
+			Tagger:           tagSystem.Evidence,
+		})
+		if err != nil {
+			return fail("Failed to import episodes", "error", err)
+		}
+		fmt.Fprintf(a.stderr, "%d episodes in the catalog: %d added, %d changed, %d removed\n",
+			stats.Episodes, stats.Added, stats.Changed, stats.Removed)
+
+	case "export":
+		target := cfg.DataDir
+		if *dir != "" {
+			target = *dir
+		}
+		written, err := c.Export(a.ctx, target, *dryRun)
+		if err != nil {
+			return fail("Failed to export episodes", "error", err)
+		}
+		fmt.Fprintf(a.stderr, "%d episode files written to %s\n", written, target)
+
+	case "query":
+		rows, err := c.Query(a.ctx, strings.Join(fs.Args()[1:], " "))
+		if err != nil {
+			return fail("Failed to query catalog", "error", err)
+		}
+		w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.Join(rows.Columns, "\t"))
+		for _, row := range rows.Values {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		if err := w.Flush(); err != nil {
+			return fail("Failed to write query result", "error", err)
+		}
+	}
+	return exitOK
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+	"github.com/p4u/enguardia-arxiu/internal/fake3cat"
+)
+
+func TestCatalog(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	setFakeEnv(t, srv)
+	t.Setenv("ENGUARDIA_STORAGE_CATALOG", "true")
+
+	dataDir := t.TempDir()
+	outputDir := filepath.Join(t.TempDir(), "data")
+	a, _, _ := newTestApp()
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir, "-lazy"}); code != exitOK {
+		t.Fatalf("scrape exited with %d", code)
+	}
+	if code := a.run([]string{"generate", "-dataDir=" + dataDir, "-output=" + outputDir}); code != exitOK {
+		t.Fatalf("generate exited with %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, constants.CatalogFile)); err != nil {
+		t.Fatalf("Expected generate to create the catalog: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "episodes-list.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var episodes []json.RawMessage
+	if err := json.Unmarshal(data, &episodes); err != nil || len(episodes) != 5 {
+		t.Errorf("Expected 5 generated episodes from the catalog, got %d (%v)", len(episodes), err)
+	}
+
+	// Download one episode, the import refreshes its media state
+	if code := a.run([]string{"download", "-dataDir=" + dataDir, "-from=1245"}); code != exitOK {
+		t.Fatalf("download exited with %d", code)
+	}
+	if code := a.run([]string{"catalog", "-dataDir=" + dataDir, "import"}); code != exitOK {
+		t.Fatalf("catalog import exited with %d", code)
+	}
+	a, stdout, _ := newTestApp()
+	query := "SELECT number FROM episodes JOIN media USING (json_file) WHERE kind = 'audio' AND NOT present ORDER BY number"
+	if code := a.run([]string{"catalog", "-dataDir=" + dataDir, "query", query}); code != exitOK {
+		t.Fatalf("catalog query exited with %d", code)
+	}
+	if got, want := strings.Fields(stdout.String()), []string{"number", "1241", "1242", "1243", "1244"}; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Episodes without audio = %v, want %v", got, want)
+	}
+
+	// Export restores the JSON files
+	exportDir := t.TempDir()
+	if code := a.run([]string{"catalog", "-dataDir=" + dataDir, "-dir=" + exportDir, "export"}); code != exitOK {
+		t.Fatalf("catalog export exited with %d", code)
+	}
+	want, _ := os.ReadFile(filepath.Join(dataDir, "1245-la-batalla-de-l-ebre.json"))
+	if got, err := os.ReadFile(filepath.Join(exportDir, "1245-la-batalla-de-l-ebre.json")); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("Exported episode differs from the stored one: %v", err)
+	}
+
+	if code := a.run([]string{"catalog", "-dataDir=" + dataDir, "vacuum"}); code != exitUsage {
+		t.Errorf("Expected an unknown catalog command to exit with %d, got %d", exitUsage, code)
+	}
+}
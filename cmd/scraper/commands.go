@@ -0,0 +1,673 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/atomicfile"
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/config"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+	"github.com/p4u/enguardia-arxiu/internal/generator"
+	"github.com/p4u/enguardia-arxiu/internal/hooks"
+	"github.com/p4u/enguardia-arxiu/internal/metrics"
+	"github.com/p4u/enguardia-arxiu/internal/program"
+	"github.com/p4u/enguardia-arxiu/internal/report"
+	"github.com/p4u/enguardia-arxiu/internal/storage"
+)
+
+func (a *app) scrape(args []string) int {
+	fs := a.newFlagSet()
+	common := a.addCommonFlags(fs)
+	audio := addAudioFlags(fs)
+	metricsAddr := addMetricsFlag(fs)
+	lazy := fs.Bool("lazy", false, "only save metadata, media can be fetched later with the download command")
+	maxPages := fs.Int("maxPages", 0, "maximum pages to scrape (0 = all pages)")
+	dryRun := dryRunFlag(fs)
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+
+	cfg, prog, err := common.loadProgram()
+	if err != nil {
+		return fail("Invalid configuration", "error", err)
+	}
+	audio.apply(cfg)
+	metricsAddr.apply(cfg)
+	rep := a.startReport(cfg, common, *dryRun)
+	m, err := a.startMetrics(cfg)
+	if err != nil {
+		return fail("Failed to start metrics", "error", err)
+	}
+
+	storageOpts := storageOptions(cfg)
+	storageOpts.Report = rep
+	storageOpts.Metrics = m
+	st, err := newStorage(cfg.DataDir, storageOpts, *dryRun)
+	if err != nil {
+		return fail("Failed to prepare data directory", "error", err)
+	}
+	unlock, err := a.lockDataDir(st)
+	if err != nil {
+		return fail("Failed to lock data directory", "error", err)
+	}
+	defer unlock()
+	collectorOpts := collectorOptions(cfg, prog)
+	collectorOpts.Report = rep
+	collectorOpts.Metrics = m
+	c := collector.NewCollectorWithOptions(collectorOpts)
+
+	failed, err := scrapeEpisodes(a.ctx, c, st, rep, newHooks(cfg, prog, *dryRun, rep, m), *lazy, *maxPages)
+	if err != nil {
+		return fail("Failed to scrape episodes", "error", err)
+	}
+	return resultCode(failed)
+}
+
+func (a *app) repair(args []string) int {
+	fs := a.newFlagSet()
+	common := a.addCommonFlags(fs)
+	audio := addAudioFlags(fs)
+	metricsAddr := addMetricsFlag(fs)
+	lazy := fs.Bool("lazy", false, "only update metadata, checking the repaired audio is served instead of downloading it")
+	dryRun := dryRunFlag(fs)
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+
+	cfg, prog, err := common.loadProgram()
+	if err != nil {
+		return fail("Invalid configuration", "error", err)
+	}
+	audio.apply(cfg)
+	metricsAddr.apply(cfg)
+	rep := a.startReport(cfg, common, *dryRun)
+	m, err := a.startMetrics(cfg)
+	if err != nil {
+		return fail("Failed to start metrics", "error", err)
+	}
+
+	storageOpts := storageOptions(cfg)
+	storageOpts.Report = rep
+	storageOpts.Metrics = m
+	st, err := newStorage(cfg.DataDir, storageOpts, *dryRun)
+	if err != nil {
+		return fail("Failed to prepare data directory", "error", err)
+	}
+	unlock, err := a.lockDataDir(st)
+	if err != nil {
+		return fail("Failed to lock data directory", "error", err)
+	}
+	defer unlock()
+	collectorOpts := collectorOptions(cfg, prog)
+	collectorOpts.Report = rep
+	collectorOpts.Metrics = m
+	c := collector.NewCollectorWithOptions(collectorOpts)
+
+	failed, err := repairEpisodes(a.ctx, c, st, rep, *lazy)
+	if err != nil {
+		return fail("Failed to repair episodes", "error", err)
+	}
+	return resultCode(failed)
+}
+
+func (a *app) generate(args []string) int {
+	fs := a.newFlagSet()
+	common := a.addCommonFlags(fs)
+	outputDir := fs.String("output", "data", "output directory for webapp JSON files")
+	lazy := fs.Bool("lazy", false, "link the remote audio and images instead of the local files")
+	probe := fs.Bool("probe", false, "check that the remote audio is still served before marking it available")
+	siteDir := fs.String("site", "", "webapp directory receiving a static page per episode and the sitemap")
+	remoteThumbnails := fs.Bool("remoteThumbnails", false, "build the thumbnails of the images not downloaded from their 3Cat URL")
+	dryRun := dryRunFlag(fs)
+	fs.Lookup("program").Usage = "programme to generate (default from the programs file, \"all\" for every programme)"
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+
+	cfg, registry, err := common.load()
+	if err != nil {
+		return fail("Invalid configuration", "error", err)
+	}
+	if isSet(fs, "output") {
+		cfg.OutputDir = *outputDir
+	}
+	if isSet(fs, "probe") {
+		cfg.Generator.ProbeAudio = *probe
+	}
+	if isSet(fs, "site") {
+		cfg.Generator.SiteDir = *siteDir
+	}
+	if isSet(fs, "remoteThumbnails") {
+		cfg.Generator.RemoteThumbnails = *remoteThumbnails
+	}
+	a.startReport(cfg, common, *dryRun)
+
+	// The probe cache and the catalogue live in the data directories
+	if cfg.Program == "all" {
+		dirs := make([]string, 0, len(registry.Programs))
+		for _, p := range registry.Programs {
+			dirs = append(dirs, p.DataDir)
+		}
+		unlock, err := a.lockDataDirs(*dryRun, dirs...)
+		if err != nil {
+			return fail("Failed to lock data directory", "error", err)
+		}
+		defer unlock()
+
+		opts := generatorOptions(cfg, program.Program{})
+		opts.DryRun = *dryRun
+		if err := generator.GenerateMultiProgramData(a.ctx, cfg.OutputDir, *lazy, registry.Programs, opts); err != nil {
+			return fail("Failed to generate webapp data", "error", err)
+		}
+		return exitOK
+	}
+
+	prog, err := selectProgram(cfg, registry)
+	if err != nil {
+		return fail("Invalid configuration", "error", err)
+	}
+
+	unlock, err := a.lockDataDirs(*dryRun, cfg.DataDir)
+	if err != nil {
+		return fail("Failed to lock data directory", "error", err)
+	}
+	defer unlock()
+
+	opts := generatorOptions(cfg, prog)
+	opts.DryRun = *dryRun
+	gen := generator.NewGeneratorWithOptions(cfg.DataDir, opts)
+	if err := gen.GenerateWebappData(a.ctx, cfg.OutputDir, *lazy); err != nil {
+		return fail("Failed to generate webapp data", "error", err)
+	}
+
+	return exitOK
+}
+
+func (a *app) tags(args []string) int {
+	fs := a.newFlagSet()
+	common := a.addCommonFlags(fs)
+	tagsFile := fs.String("tagsFile", "", "tags file to write (default: the programme tags file)")
+	dryRun := dryRunFlag(fs)
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+
+	cfg, prog, err := common.loadProgram()
+	if err != nil {
+		return fail("Invalid configuration", "error", err)
+	}
+	if isSet(fs, "tagsFile") {
+		cfg.Generator.TagsFile = *tagsFile
+	}
+	a.startReport(cfg, common, *dryRun)
+
+	unlock, err := a.lockDataDirs(*dryRun, cfg.DataDir)
+	if err != nil {
+		return fail("Failed to lock data directory", "error", err)
+	}
+	defer unlock()
+
+	opts := generatorOptions(cfg, prog)
+	opts.DryRun = *dryRun
+
+	outputPath := prog.TagsFile
+	if opts.TagsFile != "" {
+		outputPath = opts.TagsFile
+	}
+
+	tagSystem := generator.NewTagSystemWithOptions(cfg.DataDir, opts)
+	if err := tagSystem.GenerateTagsFile(outputPath); err != nil {
+		return fail("Failed to generate tags file", "error", err)
+	}
+
+	return exitOK
+}
+
+func (a *app) serve(args []string) int {
+	fs := a.newFlagSet()
+	common := a.addCommonFlags(fs)
+	port := fs.String("port", constants.DefaultPort, "port for the HTTP server")
+	staticDir := fs.String("staticDir", "webapp/dist", "directory containing the static files to serve")
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+
+	cfg, _, err := common.loadProgram()
+	if err != nil {
+		return fail("Invalid configuration", "error", err)
+	}
+
+	if info, err := os.Stat(*staticDir); err != nil || !info.IsDir() {
+		return fail("Static directory not found, build the webapp first", "dir", *staticDir)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.Dir(*staticDir)))
+	mux.Handle(constants.MetricsPath, a.newMetrics(cfg).Handler())
+
+	addr := ":" + *port
+	slog.Info("Serving static files", "dir", *staticDir, "url", "http://localhost"+addr,
+		"metrics", "http://localhost"+addr+constants.MetricsPath)
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: constants.HTTPTimeout,
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- server.ListenAndServe() }()
+
+	select {
+	case err := <-errc:
+		return fail("HTTP server failed", "error", err)
+	case <-a.ctx.Done():
+	}
+
+	slog.Info("Shutting down the HTTP server")
+	ctx, cancel := context.WithTimeout(context.Background(), constants.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		return fail("HTTP server did not shut down cleanly", "error", err)
+	}
+	if err := <-errc; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fail("HTTP server failed", "error", err)
+	}
+	// Stopping is how a server ends, not an interruption
+	return exitOK
+}
+
+func (a *app) verify(args []string) int {
+	fs := a.newFlagSet()
+	common := a.addCommonFlags(fs)
+	metadataOnly := fs.Bool("metadataOnly", false, "only check metadata, for archives scraped in lazy mode")
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+
+	cfg, _, err := common.loadProgram()
+	if err != nil {
+		return fail("Invalid configuration", "error", err)
+	}
+	rep := a.startReport(cfg, common, false)
+
+	st := storage.NewStorageWithOptions(cfg.DataDir, storageOptions(cfg))
+	problems, err := st.Verify(*metadataOnly)
+	if err != nil {
+		return fail("Failed to verify data directory", "dir", cfg.DataDir, "error", err)
+	}
+
+	for _, problem := range problems {
+		fmt.Fprintln(a.stdout, problem)
+		rep.Fail(problem.File, "verify", errors.New(problem.Message))
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(a.stderr, "%d problems found in %s\n", len(problems), cfg.DataDir)
+		return exitProblems
+	}
+
+	fmt.Fprintf(a.stderr, "No problems found in %s\n", cfg.DataDir)
+	return exitOK
+}
+
+func (a *app) stats(args []string) int {
+	fs := a.newFlagSet()
+	common := a.addCommonFlags(fs)
+	asJSON := fs.Bool("json", false, "print the summary as JSON")
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+
+	cfg, prog, err := common.loadProgram()
+	if err != nil {
+		return fail("Invalid configuration", "error", err)
+	}
+
+	st := storage.NewStorageWithOptions(cfg.DataDir, storageOptions(cfg))
+	summary, err := st.Summarize()
+	if err != nil {
+		return fail("Failed to read data directory", "dir", cfg.DataDir, "error", err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(a.stdout)
+		encoder.SetIndent("", constants.JSONIndent)
+		if err := encoder.Encode(summary); err != nil {
+			return fail("Failed to write summary", "error", err)
+		}
+		return exitOK
+	}
+
+	fmt.Fprintf(a.stdout, "Programme:       %s (%s)\n", prog.Name, cfg.DataDir)
+	fmt.Fprintf(a.stdout, "Episodes:        %d\n", summary.Episodes)
+	fmt.Fprintf(a.stdout, "Audio files:     %d (%s)\n", summary.AudioFiles, formatBytes(summary.AudioBytes))
+	fmt.Fprintf(a.stdout, "Image files:     %d (%s)\n", summary.ImageFiles, formatBytes(summary.ImageBytes))
+	fmt.Fprintf(a.stdout, "Fallback audio:  %d\n", summary.FallbackAudio)
+	fmt.Fprintf(a.stdout, "Local only:      %d\n", summary.LocalOnly)
+	fmt.Fprintf(a.stdout, "Lost:            %d\n", summary.Lost)
+	return exitOK
+}
+
+func (a *app) export(args []string) int {
+	fs := a.newFlagSet()
+	common := a.addCommonFlags(fs)
+	format := fs.String("format", "json", "export format: json or csv")
+	output := fs.String("o", "-", "output file (- = standard output)")
+	dryRun := dryRunFlag(fs)
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+	if *format != "json" && *format != "csv" {
+		fmt.Fprintf(a.stderr, "Invalid format %q, use json or csv\n", *format)
+		return exitUsage
+	}
+
+	cfg, _, err := common.loadProgram()
+	if err != nil {
+		return fail("Invalid configuration", "error", err)
+	}
+
+	st := storage.NewStorageWithOptions(cfg.DataDir, storageOptions(cfg))
+	episodes, err := st.LoadEpisodes()
+	if err != nil {
+		return fail("Failed to load episodes", "error", err)
+	}
+
+	if *output != "-" && *dryRun {
+		slog.Info("Dry run: would write", "file", *output, "episodes", len(episodes))
+		return exitOK
+	}
+
+	write := func(w io.Writer) error {
+		if *format == "csv" {
+			return exportCSV(w, episodes)
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", constants.JSONIndent)
+		return encoder.Encode(episodes)
+	}
+
+	if *output == "-" {
+		err = write(a.stdout)
+	} else {
+		err = atomicfile.Write(*output, constants.FilePermissions, write)
+	}
+	if err != nil {
+		return fail("Failed to export episodes", "error", err)
+	}
+	return exitOK
+}
+
+func (a *app) config(args []string) int {
+	fs := a.newFlagSet()
+	common := a.addCommonFlags(fs)
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+	action := fs.Arg(0)
+	if action != "print" && action != "base-path" {
+		fmt.Fprintln(a.stderr, "Invalid config command. Use: config print|base-path")
+		return exitUsage
+	}
+
+	cfg, _, err := common.loadProgram()
+	if err != nil {
+		return fail("Invalid configuration", "error", err)
+	}
+	if action == "base-path" {
+		basePath, err := cfg.BasePath()
+		if err != nil {
+			return fail("Invalid configuration", "error", err)
+		}
+		fmt.Fprintln(a.stdout, basePath)
+		return exitOK
+	}
+	if err := cfg.Print(a.stdout); err != nil {
+		return fail("Failed to print configuration", "error", err)
+	}
+	return exitOK
+}
+
+// newStorage creates the data directory unless running dry
+func newStorage(dataDir string, opts storage.Options, dryRun bool) (*storage.Storage, error) {
+	if !dryRun {
+		if err := os.MkdirAll(dataDir, constants.DirPermissions); err != nil {
+			return nil, fmt.Errorf("failed to create data directory: %w", err)
+		}
+	}
+	opts.DryRun = dryRun
+	return storage.NewStorageWithOptions(dataDir, opts), nil
+}
+
+// newHooks creates the dispatcher notifying the configured hooks of new episodes
+func newHooks(cfg *config.Config, prog program.Program, dryRun bool, rep *report.Report, m *metrics.Metrics) *hooks.Dispatcher {
+	opts := hooksOptions(cfg, prog)
+	opts.DryRun = dryRun
+	opts.Report = rep
+	opts.Metrics = m
+	return hooks.NewDispatcher(opts)
+}
+
+// resultCode returns the exit code of a command that processed episodes
+func resultCode(failed int) int {
+	if failed > 0 {
+		return exitProblems
+	}
+	return exitOK
+}
+
+func scrapeEpisodes(ctx context.Context, c *collector.Collector, storage *storage.Storage, rep *report.Report, notify *hooks.Dispatcher, lazy bool, maxPages int) (int, error) {
+	slog.Info("Starting scraping process", "lazy", lazy)
+	return saveEpisodes(ctx, storage, rep, notify, lazy, func() ([]collector.Episode, error) {
+		return c.ScrapeEpisodesWithLimit(ctx, maxPages)
+	})
+}
+
+// saveEpisodes stores the metadata of the episodes returned by fetch and,
+// unless lazy, downloads their missing media. The hooks are notified of the
+// episodes that were not stored yet once their media is downloaded.
+func saveEpisodes(ctx context.Context, storage *storage.Storage, rep *report.Report, notify *hooks.Dispatcher, lazy bool, fetch func() ([]collector.Episode, error)) (int, error) {
+	endScrape := rep.Phase("scrape")
+
+	episodes, err := fetch()
+	if err != nil {
+		endScrape()
+		return 0, err
+	}
+
+	slog.Info("Found episodes", "episodes", len(episodes))
+
+	// Phase 1: save the metadata of every episode
+	var saved, newEpisodes []collector.Episode
+	errorCount := 0
+
+	for i, episode := range episodes {
+		slog.Debug("Saving metadata", "position", i+1, "total", len(episodes), "episode", episode.Title)
+		isNew := !storage.HasEpisode(episode)
+
+		// Save the metadata, updating the stored episode found by its item ID
+		// or title, which keeps its file names when 3Cat retitles it
+		episode, err := storage.SaveEpisode(episode)
+		if err != nil {
+			slog.Error("Failed to save episode metadata", "episode", episode.Title, "error", err)
+			errorCount++
+			continue
+		}
+		saved = append(saved, episode)
+		if isNew {
+			newEpisodes = append(newEpisodes, episode)
+		}
+	}
+	endScrape()
+
+	if lazy {
+		errorCount += notify.NewEpisodes(ctx, newEpisodes)
+		slog.Info("Scraping completed, media downloads skipped (lazy mode)",
+			"total", len(episodes), "saved", len(saved), "new", len(newEpisodes), "errors", errorCount)
+		return errorCount, nil
+	}
+
+	// Phase 2: download the media of the scraped episodes from the local catalogue,
+	// starting with the ones an interrupted scrape left in its queue. The queue
+	// of an interrupted download run is left for the download command.
+	endDownload := rep.Phase("download")
+	filter := downloadFilter{missingOnly: true, images: true}
+	previous, err := storage.LoadQueue(constants.ScrapeQueueFile)
+	if err != nil {
+		slog.Warn("Ignoring the queue of an interrupted scrape", "error", err)
+	}
+	queued := withPending(storage, previous, filter.apply(storage, saved, nil))
+	failed, err := runDownloads(ctx, storage, constants.ScrapeQueueFile, queued, filter, saved)
+	endDownload()
+	if err != nil {
+		return errorCount, err
+	}
+
+	errorCount += notify.NewEpisodes(ctx, newEpisodes)
+	slog.Info("Scraping completed", "total", len(episodes), "saved", len(saved), "new", len(newEpisodes),
+		"download_errors", failed, "errors", errorCount)
+
+	return errorCount + failed, nil
+}
+
+// repairEpisodes resolves the audio of the episodes due for repair. When the
+// context is cancelled it stops before the next episode.
+func repairEpisodes(ctx context.Context, c *collector.Collector, storage *storage.Storage, rep *report.Report, lazy bool) (int, error) {
+	slog.Info("Repairing episodes stuck on the fallback audio URL")
+
+	episodes, err := storage.FallbackAudioEpisodes()
+	if err != nil {
+		return 0, err
+	}
+
+	slog.Info("Found episodes due for audio repair", "episodes", len(episodes))
+
+	repairedCount := 0
+	failedCount := 0
+
+	for i, episode := range episodes {
+		if err := ctx.Err(); err != nil {
+			slog.Warn("Repair interrupted", "repaired", repairedCount, "pending", len(episodes)-i)
+			return failedCount, fmt.Errorf("repair interrupted: %w", err)
+		}
+		slog.Info("Repairing", "position", i+1, "total", len(episodes), "episode", episode.Title)
+
+		itemID := episode.ItemID()
+		if itemID == "" {
+			err := fmt.Errorf("cannot find item ID in link %q", episode.Link)
+			slog.Error("Cannot repair episode", "episode", episode.Title, "error", err)
+			rep.Fail(episode.Title, "resolve", err)
+			failedCount++
+			continue
+		}
+
+		_, renditions, resolveErr := c.ResolveAudio(ctx, itemID)
+		if resolveErr == nil {
+			// Every rendition is tried, the preferred one first
+			episode.AudioRenditions = renditions
+			resolveErr = useAudioRendition(ctx, storage, &episode, c.RankAudio(renditions), lazy)
+		}
+		if ctx.Err() != nil {
+			continue // Not an attempt, the episode stays due
+		}
+		episode.LastAudioAttempt = c.Now().UTC().Format(time.RFC3339)
+		if resolveErr != nil {
+			episode.AudioFailures++
+			slog.Warn("Failed to repair audio", "episode", episode.Title, "attempt", episode.AudioFailures,
+				"max_attempts", constants.MaxAudioRepairAttempts, "error", resolveErr)
+			rep.Fail(episode.Title, "resolve", resolveErr)
+			failedCount++
+		} else {
+			episode.AudioFailures = 0
+			repairedCount++
+		}
+
+		if err := storage.UpdateEpisode(episode); err != nil {
+			slog.Error("Failed to update episode metadata", "episode", episode.Title, "error", err)
+			rep.Fail(episode.Title, "metadata", err)
+		}
+
+		_ = c.Wait(ctx) // Cancellation is handled at the top of the loop
+	}
+
+	slog.Info("Repair completed", "total", len(episodes), "repaired", repairedCount, "failed", failedCount)
+	rep.Add(report.Repaired, repairedCount)
+	return failedCount, nil
+}
+
+// useAudioRendition points the episode at the first rendition whose audio is
+// served: downloaded, or in lazy mode answering a probe. The file name follows
+// the format of the rendition used, and a file under the previous name is
+// removed. The episode keeps its placeholder URL when no rendition is served.
+func useAudioRendition(ctx context.Context, st *storage.Storage, episode *collector.Episode, renditions []collector.AudioRendition, lazy bool) error {
+	placeholder, filename := episode.AudioURL, episode.Filename
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	var errs []error
+	for _, rendition := range renditions {
+		episode.AudioURL = rendition.URL
+		episode.Filename = base + rendition.Extension()
+		var err error
+		if lazy {
+			var served bool
+			if served, err = st.ProbeAudio(ctx, *episode); err == nil && !served {
+				err = fmt.Errorf("audio not found: %s", rendition.URL)
+			}
+		} else {
+			err = st.DownloadAudio(ctx, *episode)
+		}
+		if err == nil {
+			if episode.Filename != filename {
+				if err := st.RemoveMedia(ctx, filename); err != nil {
+					slog.Warn("Failed to remove stale audio file", "episode", episode.Title, "error", err)
+				}
+			}
+			return nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		slog.Warn("Audio rendition unavailable", "episode", episode.Title, "format", rendition.Format, "error", err)
+		errs = append(errs, err)
+	}
+	episode.AudioURL, episode.Filename = placeholder, filename
+	return fmt.Errorf("no audio rendition available: %w", errors.Join(errs...))
+}
+
+// exportCSV writes one row per episode
+func exportCSV(w io.Writer, episodes []collector.Episode) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"title", "date", "duration", "link", "audio_url", "filename", "image", "description"}); err != nil {
+		return err
+	}
+	for _, ep := range episodes {
+		record := []string{ep.Title, ep.Date, ep.Duration, ep.Link, ep.AudioURL, ep.Filename, ep.Image, ep.Description}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatBytes returns a human readable size
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGT"[exp])
+}
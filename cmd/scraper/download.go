@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+	"github.com/p4u/enguardia-arxiu/internal/generator"
+	"github.com/p4u/enguardia-arxiu/internal/storage"
+)
+
+// dateFlagLayout is the layout of the -since and -until flags
+const dateFlagLayout = "2006-01-02"
+
+// downloadFilter selects the stored episodes whose media is downloaded
+type downloadFilter struct {
+	from, to     int       // Episode number range (0 = unbounded)
+	since, until time.Time // Broadcast date range, inclusive (zero = unbounded)
+	tags         []string  // Any of these webapp tags
+	missingOnly  bool      // Skip episodes whose media is already downloaded
+	images       bool      // Download images as well as audio
+}
+
+func (a *app) download(args []string) int {
+	fs := a.newFlagSet()
+	common := a.addCommonFlags(fs)
+	from := fs.Int("from", 0, "first episode number to download (0 = no limit)")
+	to := fs.Int("to", 0, "last episode number to download (0 = no limit)")
+	since := fs.String("since", "", "only episodes broadcast on or after this date (YYYY-MM-DD)")
+	until := fs.String("until", "", "only episodes broadcast on or before this date (YYYY-MM-DD)")
+	tags := fs.String("tag", "", "only episodes with any of these comma separated tags")
+	missingOnly := fs.Bool("missingOnly", true, "skip episodes already downloaded (false = download them again)")
+	audioOnly := fs.Bool("audioOnly", false, "skip image downloads")
+	metricsAddr := addMetricsFlag(fs)
+	restart := fs.Bool("restart", false, "discard the queue of an interrupted run instead of resuming it")
+	dryRun := dryRunFlag(fs)
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+
+	filter := downloadFilter{
+		from:        *from,
+		to:          *to,
+		tags:        splitList(*tags),
+		missingOnly: *missingOnly,
+		images:      !*audioOnly,
+	}
+	for _, date := range []struct {
+		value string
+		dst   *time.Time
+	}{{*since, &filter.since}, {*until, &filter.until}} {
+		if date.value == "" {
+			continue
+		}
+		parsed, err := time.Parse(dateFlagLayout, date.value)
+		if err != nil {
+			fmt.Fprintf(a.stderr, "Invalid date %q, use YYYY-MM-DD\n", date.value)
+			return exitUsage
+		}
+		*date.dst = parsed
+	}
+
+	cfg, prog, err := common.loadProgram()
+	if err != nil {
+		return fail("Invalid configuration", "error", err)
+	}
+	metricsAddr.apply(cfg)
+	rep := a.startReport(cfg, common, *dryRun)
+	m, err := a.startMetrics(cfg)
+	if err != nil {
+		return fail("Failed to start metrics", "error", err)
+	}
+
+	storageOpts := storageOptions(cfg)
+	storageOpts.Report = rep
+	storageOpts.Metrics = m
+	st, err := newStorage(cfg.DataDir, storageOpts, *dryRun)
+	if err != nil {
+		return fail("Failed to prepare data directory", "error", err)
+	}
+
+	queue, err := st.LoadQueue(constants.DownloadQueueFile)
+	if err != nil {
+		return fail("Failed to load download queue", "error", err)
+	}
+	scrapeQueue, err := st.LoadQueue(constants.ScrapeQueueFile)
+	if err != nil {
+		return fail("Failed to load download queue", "error", err)
+	}
+	resume := queue != nil && !*restart
+
+	// The scrape queue only holds missing media, it never overwrites
+	missingStorage := st
+	overwrite := !filter.missingOnly
+	if resume {
+		overwrite = queue.Overwrite
+	}
+	if overwrite {
+		storageOpts.Overwrite = true
+		if st, err = newStorage(cfg.DataDir, storageOpts, *dryRun); err != nil {
+			return fail("Failed to prepare data directory", "error", err)
+		}
+	}
+
+	unlock, err := a.lockDataDir(st)
+	if err != nil {
+		return fail("Failed to lock data directory", "error", err)
+	}
+	defer unlock()
+
+	// The downloads of an interrupted scrape or watch go first
+	scrapeFailed := 0
+	if scrapeQueue != nil {
+		slog.Info("Resuming downloads of an interrupted scrape", "created", scrapeQueue.Created,
+			"pending", len(scrapeQueue.Pending))
+		if scrapeFailed, err = processQueue(a.ctx, missingStorage, scrapeQueue, nil); err != nil {
+			return fail("Failed to download media", "error", err)
+		}
+	}
+
+	if resume {
+		slog.Info("Resuming interrupted download", "created", queue.Created,
+			"pending", len(queue.Pending), "filters", queue.Filters)
+		if filterFlagsSet(fs) {
+			slog.Warn("The filters given are ignored, use -restart to build a new queue")
+		}
+		failed, err := processQueue(a.ctx, st, queue, nil)
+		if err != nil {
+			return fail("Failed to download media", "error", err)
+		}
+		return resultCode(scrapeFailed + failed)
+	}
+
+	episodes, err := st.LoadEpisodes()
+	if err != nil {
+		return fail("Failed to load episodes", "error", err)
+	}
+
+	var episodeTags map[string][]string
+	if len(filter.tags) > 0 {
+		gen := generator.NewGeneratorWithOptions(cfg.DataDir, generatorOptions(cfg, prog))
+		episodeTags = gen.EpisodeTags(episodes)
+	}
+
+	selected := filter.apply(st, episodes, episodeTags)
+	slog.Info("Selected episodes", "selected", len(selected), "total", len(episodes), "filters", filter.String())
+
+	failed, err := runDownloads(a.ctx, st, constants.DownloadQueueFile, selected, filter, nil)
+	if err != nil {
+		return fail("Failed to download media", "error", err)
+	}
+	return resultCode(scrapeFailed + failed)
+}
+
+// filterFlagsSet reports whether any episode selection flag was given
+func filterFlagsSet(fs *flag.FlagSet) bool {
+	for _, name := range []string{"from", "to", "since", "until", "tag", "missingOnly", "audioOnly"} {
+		if isSet(fs, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns the episodes matching the filter, in catalogue order
+func (f downloadFilter) apply(st *storage.Storage, episodes []collector.Episode, episodeTags map[string][]string) []collector.Episode {
+	var selected []collector.Episode
+	for _, ep := range episodes {
+		if f.match(st, ep, episodeTags[ep.JSONFile]) {
+			selected = append(selected, ep)
+		}
+	}
+	return selected
+}
+
+func (f downloadFilter) match(st *storage.Storage, ep collector.Episode, tags []string) bool {
+	// Nothing to download until repair finds the audio
+	if ep.HasFallbackAudio() {
+		return false
+	}
+
+	if f.from > 0 || f.to > 0 {
+		num := ep.Number()
+		if num == 0 || (f.from > 0 && num < f.from) || (f.to > 0 && num > f.to) {
+			return false
+		}
+	}
+
+	if !f.since.IsZero() || !f.until.IsZero() {
+		date := ep.PublishedAt()
+		if date.IsZero() || (!f.since.IsZero() && date.Before(f.since)) ||
+			(!f.until.IsZero() && !date.Before(f.until.AddDate(0, 0, 1))) {
+			return false
+		}
+	}
+
+	if len(f.tags) > 0 && !hasAnyTag(tags, f.tags) {
+		return false
+	}
+
+	if f.missingOnly {
+		missingImage := f.images && ep.Image != "" && ep.ImageFilename != "" && !st.HasImage(ep)
+		return !st.HasAudio(ep) || missingImage
+	}
+	return true
+}
+
+// String describes the filter for logs and the queue file
+func (f downloadFilter) String() string {
+	var parts []string
+	if f.from > 0 || f.to > 0 {
+		parts = append(parts, fmt.Sprintf("episodes %d-%d", f.from, f.to))
+	}
+	if !f.since.IsZero() {
+		parts = append(parts, "since "+f.since.Format(dateFlagLayout))
+	}
+	if !f.until.IsZero() {
+		parts = append(parts, "until "+f.until.Format(dateFlagLayout))
+	}
+	if len(f.tags) > 0 {
+		parts = append(parts, "tags "+strings.Join(f.tags, ","))
+	}
+	if f.missingOnly {
+		parts = append(parts, "missing only")
+	}
+	if !f.images {
+		parts = append(parts, "audio only")
+	}
+	if len(parts) == 0 {
+		return "all episodes"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func hasAnyTag(tags, wanted []string) bool {
+	for _, tag := range tags {
+		for _, w := range wanted {
+			if strings.EqualFold(tag, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// runDownloads queues the episodes in the named queue file and downloads their
+// media. Episodes not yet stored (dry runs) are taken from known.
+func runDownloads(ctx context.Context, st *storage.Storage, queueFile string, episodes []collector.Episode, filter downloadFilter, known []collector.Episode) (int, error) {
+	queue := st.NewQueue(queueFile, episodes)
+	queue.Filters = filter.String()
+	queue.Images = filter.images
+	queue.Overwrite = !filter.missingOnly
+	if err := queue.Save(); err != nil {
+		return 0, err
+	}
+	return processQueue(ctx, st, queue, known)
+}
+
+// withPending returns the episodes still pending in a previous queue followed
+// by the ones of episodes not among them, so a new queue resumes where the
+// previous one stopped
+func withPending(st *storage.Storage, queue *storage.Queue, episodes []collector.Episode) []collector.Episode {
+	if queue == nil {
+		return episodes
+	}
+	var merged []collector.Episode
+	pending := make(map[string]bool, len(queue.Pending))
+	for _, file := range queue.Pending {
+		episode, err := st.QueuedEpisode(file)
+		if err != nil {
+			slog.Warn("Dropping queued episode", "file", file, "error", err)
+			continue
+		}
+		pending[file] = true
+		merged = append(merged, episode)
+	}
+	for _, episode := range episodes {
+		if !pending[episode.JSONFile] {
+			merged = append(merged, episode)
+		}
+	}
+	return merged
+}
+
+// processQueue downloads the pending episodes of a queue, saving the queue after
+// each one. When the context is cancelled it stops before the next episode,
+// leaving the queue to be resumed.
+func processQueue(ctx context.Context, st *storage.Storage, queue *storage.Queue, known []collector.Episode) (int, error) {
+	byFile := make(map[string]collector.Episode, len(known))
+	for _, ep := range known {
+		byFile[ep.JSONFile] = ep
+	}
+
+	total := len(queue.Pending) + queue.Done + len(queue.Failed)
+	failedBefore := len(queue.Failed)
+
+	for {
+		file, ok := queue.Next()
+		if !ok {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			slog.Warn("Download interrupted, run download again to resume", "pending", len(queue.Pending))
+			return len(queue.Failed), fmt.Errorf("download interrupted: %w", err)
+		}
+		position := queue.Done + len(queue.Failed) + 1
+
+		episode, err := st.QueuedEpisode(file)
+		if err != nil {
+			var found bool
+			if episode, found = byFile[file]; !found {
+				slog.Error("Failed to load queued episode", "position", position, "total", total, "file", file, "error", err)
+				if err := queue.Complete(false); err != nil {
+					return len(queue.Failed), err
+				}
+				continue
+			}
+		}
+
+		slog.Info("Downloading", "position", position, "total", total, "episode", episode.Title)
+		done := downloadEpisode(ctx, st, episode, queue.Images)
+		if ctx.Err() != nil {
+			continue // Left pending, the partial file is already removed
+		}
+		if err := queue.Complete(done); err != nil {
+			return len(queue.Failed), err
+		}
+	}
+
+	// An empty queue has nothing left to resume
+	if err := queue.Remove(); err != nil {
+		return len(queue.Failed), err
+	}
+
+	failed := len(queue.Failed)
+	slog.Info("Download completed", "total", total, "downloaded", queue.Done,
+		"failed", failed, "failed_this_run", failed-failedBefore)
+	return failed, nil
+}
+
+// downloadEpisode downloads the audio and optionally the image of an episode,
+// reporting whether every download succeeded
+func downloadEpisode(ctx context.Context, storage *storage.Storage, episode collector.Episode, images bool) bool {
+	ok := true
+
+	if err := storage.DownloadAudio(ctx, episode); err != nil {
+		slog.Error("Failed to download audio", "episode", episode.Title, "error", err)
+		ok = false
+	}
+
+	if images && episode.Image != "" && episode.ImageFilename != "" && ctx.Err() == nil {
+		if err := storage.DownloadImage(ctx, episode); err != nil {
+			slog.Error("Failed to download image", "episode", episode.Title, "error", err)
+			ok = false
+		}
+	}
+
+	return ok
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+	"github.com/p4u/enguardia-arxiu/internal/fake3cat"
+	"github.com/p4u/enguardia-arxiu/internal/storage"
+)
+
+func TestDownloadFiltersAndResume(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	setFakeEnv(t, srv)
+
+	dataDir := t.TempDir()
+	a, _, _ := newTestApp()
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir, "-lazy"}); code != exitOK {
+		t.Fatalf("scrape -lazy exited with %d", code)
+	}
+
+	downloaded := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dataDir, name))
+		return err == nil
+	}
+
+	// Episodes 1244-1245 broadcast from 1 September 2025, audio only
+	args := []string{"download", "-dataDir=" + dataDir, "-from=1243", "-to=1245", "-since=2025-09-01", "-audioOnly"}
+	if code := a.run(args); code != exitOK {
+		t.Fatalf("download exited with %d", code)
+	}
+	if !downloaded("1245-la-batalla-de-l-ebre.mp3") {
+		t.Error("Expected episode 1245 audio to be downloaded")
+	}
+	for _, name := range []string{"1245-la-batalla-de-l-ebre.jpg", "1244-els-almogàvers.mp3", "1243-la-pesta-negra.mp3"} {
+		if downloaded(name) {
+			t.Errorf("Expected %s to be filtered out", name)
+		}
+	}
+
+	// An interrupted run leaves its queue behind, the next run resumes it
+	// and ignores new filters
+	st := storage.NewStorage(dataDir)
+	episodes, err := st.LoadEpisodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var queued []collector.Episode
+	for _, ep := range episodes {
+		if ep.Number() == 1241 || ep.Number() == 1243 {
+			queued = append(queued, ep)
+		}
+	}
+	queue := st.NewQueue(constants.DownloadQueueFile, queued)
+	queue.Images = false
+	if err := queue.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := a.run([]string{"download", "-dataDir=" + dataDir, "-to=1242"}); code != exitOK {
+		t.Fatalf("resumed download exited with %d", code)
+	}
+	if !downloaded("1243-la-pesta-negra.mp3") || !downloaded("1241-jaume-i-el-conqueridor.mp3") {
+		t.Error("Expected the queued episodes to be downloaded")
+	}
+	if downloaded("1244-els-almogàvers.mp3") || downloaded("1241-jaume-i-el-conqueridor.jpg") {
+		t.Error("Expected only the queued audio to be downloaded")
+	}
+	if downloaded(constants.DownloadQueueFile) {
+		t.Error("Expected the completed queue to be removed")
+	}
+}
+
+func TestDownloadInterrupted(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	setFakeEnv(t, srv)
+
+	dataDir := t.TempDir()
+	a, _, _ := newTestApp()
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir, "-lazy"}); code != exitOK {
+		t.Fatalf("scrape -lazy exited with %d", code)
+	}
+
+	// Interrupted in the middle of episode 1245
+	stalled := srv.StallMedia("mp3/1/0/1001.mp3")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stalled
+		cancel()
+	}()
+
+	a, _, stderr := newTestApp()
+	a.ctx = ctx
+	if code := a.run([]string{"download", "-dataDir=" + dataDir, "-audioOnly"}); code != exitInterrupted {
+		t.Fatalf("Expected an interrupted download to exit with %d, got %d", exitInterrupted, code)
+	}
+	if !strings.Contains(stderr.String(), "Interrupted: download stopped") {
+		t.Errorf("Expected an interruption summary, got:\n%s", stderr.String())
+	}
+
+	temps, err := filepath.Glob(filepath.Join(dataDir, "*"+constants.TempSuffix))
+	if err != nil || len(temps) != 0 {
+		t.Errorf("Expected no temporary files left, got %v (%v)", temps, err)
+	}
+	queue, err := storage.NewStorage(dataDir).LoadQueue(constants.DownloadQueueFile)
+	if err != nil || queue == nil {
+		t.Fatalf("Expected the queue to be kept: %v", err)
+	}
+	if len(queue.Failed) != 0 || !strings.HasPrefix(queue.Pending[0], "1245-") {
+		t.Errorf("Expected the interrupted episode to stay pending, got pending=%v failed=%v", queue.Pending, queue.Failed)
+	}
+
+	// The next run resumes with the interrupted episode
+	a, _, _ = newTestApp()
+	if code := a.run([]string{"download", "-dataDir=" + dataDir}); code != exitOK {
+		t.Fatalf("resumed download exited with %d", code)
+	}
+	if info, err := os.Stat(filepath.Join(dataDir, "1245-la-batalla-de-l-ebre.mp3")); err != nil || info.Size() != fake3cat.AudioSize {
+		t.Errorf("Expected the interrupted audio to be downloaded completely: %v", err)
+	}
+}
+
+func TestScrapeKeepsInterruptedDownload(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	setFakeEnv(t, srv)
+
+	dataDir := t.TempDir()
+	a, _, _ := newTestApp()
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir, "-lazy"}); code != exitOK {
+		t.Fatalf("scrape -lazy exited with %d", code)
+	}
+
+	// A filtered download interrupted in the middle of episode 1245
+	stalled := srv.StallMedia("mp3/1/0/1001.mp3")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stalled
+		cancel()
+	}()
+	a, _, _ = newTestApp()
+	a.ctx = ctx
+	if code := a.run([]string{"download", "-dataDir=" + dataDir, "-from=1244", "-to=1245", "-audioOnly"}); code != exitInterrupted {
+		t.Fatalf("Expected an interrupted download to exit with %d, got %d", exitInterrupted, code)
+	}
+	interrupted, err := storage.NewStorage(dataDir).LoadQueue(constants.DownloadQueueFile)
+	if err != nil || interrupted == nil {
+		t.Fatalf("Expected the queue to be kept: %v", err)
+	}
+
+	// A full scrape downloads with its own queue
+	a, _, _ = newTestApp()
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir}); code != exitOK {
+		t.Fatalf("scrape exited with %d", code)
+	}
+	queue, err := storage.NewStorage(dataDir).LoadQueue(constants.DownloadQueueFile)
+	if err != nil || queue == nil {
+		t.Fatalf("Expected the scrape to leave the interrupted queue: %v", err)
+	}
+	if queue.Filters != interrupted.Filters || queue.Images || strings.Join(queue.Pending, ",") != strings.Join(interrupted.Pending, ",") {
+		t.Errorf("Queue = %+v, want %+v", queue, interrupted)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, constants.ScrapeQueueFile)); !os.IsNotExist(err) {
+		t.Errorf("Expected the finished scrape queue to be removed: %v", err)
+	}
+
+	a, _, _ = newTestApp()
+	if code := a.run([]string{"download", "-dataDir=" + dataDir}); code != exitOK {
+		t.Fatalf("resumed download exited with %d", code)
+	}
+	if queue, err := storage.NewStorage(dataDir).LoadQueue(constants.DownloadQueueFile); err != nil || queue != nil {
+		t.Errorf("Expected the resumed queue to be done, got %+v (%v)", queue, err)
+	}
+}
+
+func TestScrapeResumesInterruptedScrape(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	setFakeEnv(t, srv)
+
+	// interrupt runs a scrape stopped in the middle of the audio of episode 1244
+	interrupt := func(dataDir string) {
+		t.Helper()
+		stalled := srv.StallMedia("mp3/1/0/1002_128k.mp3")
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			<-stalled
+			cancel()
+		}()
+		a, _, _ := newTestApp()
+		a.ctx = ctx
+		if code := a.run([]string{"scrape", "-dataDir=" + dataDir}); code != exitInterrupted {
+			t.Fatalf("Expected an interrupted scrape to exit with %d, got %d", exitInterrupted, code)
+		}
+		queue, err := storage.NewStorage(dataDir).LoadQueue(constants.ScrapeQueueFile)
+		if err != nil || queue == nil {
+			t.Fatalf("Expected the scrape queue to be kept: %v", err)
+		}
+		if !strings.HasPrefix(queue.Pending[0], "1244-") {
+			t.Errorf("Expected the interrupted episode to stay pending, got %v", queue.Pending)
+		}
+	}
+	resumed := func(dataDir string) {
+		t.Helper()
+		if _, err := os.Stat(filepath.Join(dataDir, constants.ScrapeQueueFile)); !os.IsNotExist(err) {
+			t.Errorf("Expected the resumed scrape queue to be removed: %v", err)
+		}
+		if info, err := os.Stat(filepath.Join(dataDir, "1244-els-almogàvers.mp3")); err != nil || info.Size() != fake3cat.AudioSize {
+			t.Errorf("Expected the interrupted audio to be downloaded completely: %v", err)
+		}
+	}
+
+	t.Run("download", func(t *testing.T) {
+		dataDir := t.TempDir()
+		interrupt(dataDir)
+		a, _, _ := newTestApp()
+		if code := a.run([]string{"download", "-dataDir=" + dataDir, "-from=1", "-to=1"}); code != exitOK {
+			t.Fatalf("download exited with %d", code)
+		}
+		resumed(dataDir)
+	})
+
+	t.Run("scrape", func(t *testing.T) {
+		dataDir := t.TempDir()
+		interrupt(dataDir)
+		// Episode 1244 is no longer listed, it is still downloaded from the queue
+		srv.RemoveItem(1002)
+		a, _, _ := newTestApp()
+		if code := a.run([]string{"scrape", "-dataDir=" + dataDir, "-maxPages=1"}); code != exitOK {
+			t.Fatalf("scrape exited with %d", code)
+		}
+		resumed(dataDir)
+	})
+}
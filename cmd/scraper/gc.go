@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/p4u/enguardia-arxiu/internal/storage"
+)
+
+func (a *app) gc(args []string) int {
+	fs := a.newFlagSet()
+	common := a.addCommonFlags(fs)
+	quarantine := fs.Bool("quarantine", false, "move the orphaned files to the quarantine directory")
+	quarantineDir := fs.String("quarantineDir", "", "quarantine directory (default: .quarantine in the data directory)")
+	remove := fs.Bool("delete", false, "delete the orphaned files")
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+	if *quarantine && *remove {
+		fmt.Fprintln(a.stderr, "Use either -quarantine or -delete")
+		return exitUsage
+	}
+
+	cfg, _, err := common.loadProgram()
+	if err != nil {
+		return fail("Invalid configuration", "error", err)
+	}
+
+	st := storage.NewStorageWithOptions(cfg.DataDir, storageOptions(cfg))
+	if *quarantine || *remove {
+		// Temporary files of a running command are not orphans
+		unlock, err := a.lockDataDir(st)
+		if err != nil {
+			return fail("Failed to lock data directory", "error", err)
+		}
+		defer unlock()
+	}
+
+	orphans, err := st.Orphans()
+	if err != nil {
+		return fail("Failed to scan data directory", "dir", cfg.DataDir, "error", err)
+	}
+
+	var total int64
+	for _, orphan := range orphans {
+		fmt.Fprintf(a.stdout, "%10s  %-10s  %s\n", formatBytes(orphan.Size), orphan.Reason, orphan.File)
+		total += orphan.Size
+	}
+	if len(orphans) == 0 {
+		fmt.Fprintf(a.stderr, "No orphaned files in %s\n", cfg.DataDir)
+		return exitOK
+	}
+
+	switch {
+	case *quarantine:
+		dir, err := st.Quarantine(orphans, *quarantineDir)
+		if err != nil {
+			return fail("Failed to quarantine orphaned files", "error", err)
+		}
+		fmt.Fprintf(a.stderr, "%d orphaned files (%s) moved to %s\n", len(orphans), formatBytes(total), dir)
+	case *remove:
+		if err := st.RemoveOrphans(orphans); err != nil {
+			return fail("Failed to delete orphaned files", "error", err)
+		}
+		fmt.Fprintf(a.stderr, "%d orphaned files (%s) deleted\n", len(orphans), formatBytes(total))
+	default:
+		fmt.Fprintf(a.stderr, "%d orphaned files (%s) in %s, use -quarantine or -delete to clean them up\n",
+			len(orphans), formatBytes(total), cfg.DataDir)
+		return exitProblems
+	}
+	return exitOK
+}
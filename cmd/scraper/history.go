@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+	"github.com/p4u/enguardia-arxiu/internal/storage"
+)
+
+func (a *app) history(args []string) int {
+	fs := a.newFlagSet()
+	common := a.addCommonFlags(fs)
+	asJSON := fs.Bool("json", false, "print the history as JSON")
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(a.stderr, "Invalid history command. Use: history <episode number or JSON file>")
+		return exitUsage
+	}
+
+	cfg, _, err := common.loadProgram()
+	if err != nil {
+		return fail("Invalid configuration", "error", err)
+	}
+
+	st := storage.NewStorageWithOptions(cfg.DataDir, storageOptions(cfg))
+	episodes, err := st.LoadEpisodes()
+	if err != nil {
+		return fail("Failed to load episodes", "error", err)
+	}
+	episode, ok := findEpisode(episodes, fs.Arg(0))
+	if !ok {
+		return fail("Episode not found", "episode", fs.Arg(0), "dir", cfg.DataDir)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(a.stdout)
+		encoder.SetIndent("", constants.JSONIndent)
+		if err := encoder.Encode(episode.History); err != nil {
+			return fail("Failed to write history", "error", err)
+		}
+		return exitOK
+	}
+
+	fmt.Fprintf(a.stdout, "%s (%s)\n", episode.Title, episode.JSONFile)
+	if len(episode.History) == 0 {
+		fmt.Fprintln(a.stdout, "No history recorded")
+	}
+	for _, event := range episode.History {
+		fmt.Fprintf(a.stdout, "%-20s  %-16s  %s\n", event.At, event.Event, describeEvent(event))
+	}
+	return exitOK
+}
+
+// findEpisode looks an episode up by number or JSON file name
+func findEpisode(episodes []collector.Episode, key string) (collector.Episode, bool) {
+	number, _ := strconv.Atoi(key)
+	name := strings.TrimSuffix(key, constants.JSONExtension) + constants.JSONExtension
+	for _, ep := range episodes {
+		if ep.JSONFile == name || number > 0 && ep.Number() == number {
+			return ep, true
+		}
+	}
+	return collector.Episode{}, false
+}
+
+// describeEvent formats the details of a history event
+func describeEvent(event collector.HistoryEvent) string {
+	switch event.Event {
+	case collector.EventFieldChanged:
+		return fmt.Sprintf("%s: %q → %q", event.Field, event.Old, event.New)
+	case collector.EventMediaDownloaded:
+		return event.Field + ": " + event.New
+	case collector.EventMediaFailed:
+		return event.Field + ": " + event.Error
+	}
+	return ""
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/fake3cat"
+	"github.com/p4u/enguardia-arxiu/internal/storage"
+)
+
+func TestHistory(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	srv.FailMedia("jpg/1/0/1005.jpg", 404)
+	setFakeEnv(t, srv)
+
+	dataDir := t.TempDir()
+	a, _, _ := newTestApp()
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir, "-lazy"}); code != exitOK {
+		t.Fatalf("scrape exited with %d", code)
+	}
+
+	// An edited description is restored by the next scrape and logged
+	st := storage.NewStorage(dataDir)
+	episodes, err := st.LoadEpisodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	episode, _ := findEpisode(episodes, "1241")
+	want := episode.Description
+	episode.Description = "Descripció antiga"
+	if err := st.UpdateEpisode(episode); err != nil {
+		t.Fatal(err)
+	}
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir}); code != exitProblems {
+		t.Fatalf("Expected scrape to report the failed image, got %d", code)
+	}
+
+	a, stdout, _ := newTestApp()
+	if code := a.run([]string{"history", "-dataDir=" + dataDir, "-json", "1241"}); code != exitOK {
+		t.Fatalf("history exited with %d", code)
+	}
+	var history []collector.HistoryEvent
+	if err := json.Unmarshal(stdout.Bytes(), &history); err != nil {
+		t.Fatal(err)
+	}
+	var events []string
+	for _, event := range history {
+		events = append(events, event.Event+" "+event.Field)
+	}
+	wantEvents := []string{
+		"first_seen ",
+		"field_changed description", // The manual edit
+		"field_changed description", // Restored by the scrape
+		"media_downloaded audio",
+		"media_failed image",
+	}
+	if strings.Join(events, ", ") != strings.Join(wantEvents, ", ") {
+		t.Errorf("History = %v, want %v", events, wantEvents)
+	}
+	if last := history[2]; last.Old != "Descripció antiga" || last.New != want {
+		t.Errorf("Unexpected change %+v", last)
+	}
+
+	a, stdout, _ = newTestApp()
+	if code := a.run([]string{"history", "-dataDir=" + dataDir, "1241-jaume-i-el-conqueridor.json"}); code != exitOK {
+		t.Fatalf("history exited with %d", code)
+	}
+	if !strings.Contains(stdout.String(), "media_failed") || !strings.Contains(stdout.String(), "404") {
+		t.Errorf("Unexpected history output:\n%s", stdout.String())
+	}
+	if code := a.run([]string{"history", "-dataDir=" + dataDir, "9999"}); code != exitFailure {
+		t.Errorf("Expected an unknown episode to fail, got %d", code)
+	}
+
+	// Scraping again without changes leaves the episode file untouched
+	jsonPath := filepath.Join(dataDir, episode.JSONFile)
+	before, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir}); code != exitProblems {
+		t.Fatalf("Expected scrape to report the failed image, got %d", code)
+	}
+	if after, err := os.ReadFile(jsonPath); err != nil || string(after) != string(before) {
+		t.Errorf("Expected an unchanged episode not to be rewritten (error %v)", err)
+	}
+
+	outputDir := filepath.Join(t.TempDir(), "data")
+	if code := a.run([]string{"generate", "-dataDir=" + dataDir, "-output=" + outputDir}); code != exitOK {
+		t.Fatalf("generate exited with %d", code)
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "episodes-list.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var generated []struct {
+		JSONFile     string `json:"jsonFile"`
+		FirstSeen    string `json:"firstSeen"`
+		LastModified string `json:"lastModified"`
+	}
+	if err := json.Unmarshal(data, &generated); err != nil {
+		t.Fatal(err)
+	}
+	for _, ep := range generated {
+		if ep.JSONFile == episode.JSONFile && (ep.FirstSeen != history[0].At || ep.LastModified != history[2].At) {
+			t.Errorf("Generated firstSeen %q and lastModified %q, want %q and %q", ep.FirstSeen, ep.LastModified, history[0].At, history[2].At)
+		}
+	}
+}
@@ -1,129 +1,491 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/config"
 	"github.com/p4u/enguardia-arxiu/internal/constants"
-	"github.com/p4u/enguardia-arxiu/internal/generator"
+	"github.com/p4u/enguardia-arxiu/internal/logging"
+	"github.com/p4u/enguardia-arxiu/internal/metrics"
+	"github.com/p4u/enguardia-arxiu/internal/program"
+	"github.com/p4u/enguardia-arxiu/internal/report"
 	"github.com/p4u/enguardia-arxiu/internal/storage"
 )
 
+// Exit codes
+const (
+	exitOK       = 0 // Command completed
+	exitFailure  = 1 // Command could not run
+	exitUsage    = 2 // Invalid command line
+	exitProblems = 3 // Command completed but some episodes failed or problems were found
+
+	exitInterrupted = 130 // Command stopped by SIGINT or SIGTERM, as shells report it
+)
+
+// command is a scraper subcommand
+type command struct {
+	name    string
+	summary string
+	run     func(a *app, args []string) int
+}
+
+var commands = []command{
+	{"scrape", "Fetch episode metadata from 3Cat and download audio and images", (*app).scrape},
+	{"download", "Download missing audio and images of stored episodes", (*app).download},
+	{"repair", "Retry episodes stuck on the fallback audio URL", (*app).repair},
+	{"reconcile", "Mark the episodes removed from 3Cat as local-only or lost", (*app).reconcile},
+	{"watch", "Scrape new episodes, download them and regenerate the webapp data on a schedule", (*app).watch},
+	{"generate", "Generate the webapp JSON data files", (*app).generate},
+	{"tags", "Generate the tags file with episode categorization", (*app).tags},
+	{"serve", "Serve the built webapp over HTTP", (*app).serve},
+	{"verify", "Check stored episodes and downloaded media", (*app).verify},
+	{"gc", "List orphaned and leftover files in the data directory and clean them up", (*app).gc},
+	{"stats", "Show a summary of the stored episodes", (*app).stats},
+	{"history", "Show the change log of an episode", (*app).history},
+	{"export", "Export episode metadata as JSON or CSV", (*app).export},
+	{"catalog", "Import, export and query the SQLite episode catalogue", (*app).catalog},
+	{"config", "Show the effective configuration (config print) or the webapp base path (config base-path)", (*app).config},
+}
+
+// app holds the state of the command line interface
+type app struct {
+	ctx     context.Context // Cancelled on SIGINT and SIGTERM
+	stdout  io.Writer
+	stderr  io.Writer
+	command command // Subcommand being run
+
+	report     *report.Report // Run report of the command, nil when disabled
+	reportPath string
+	metrics    *metrics.Metrics // Metrics of the command, nil until started
+}
+
 func main() {
-	action := flag.String("action", "scrape", "scrape, generate, or tags")
-	dataDir := flag.String("dataDir", constants.DefaultDataDir, "data directory")
-	outputDir := flag.String("output", "data", "output directory for webapp JSON files")
-	lazy := flag.Bool("lazy", false, "lazy mode: don't download MP3 files, use remote links")
-	maxPages := flag.Int("maxPages", 0, "maximum pages to scrape (0 = all pages)")
-	flag.Parse()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	// A second signal kills the process, as without the handler
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	a := &app{ctx: ctx, stdout: os.Stdout, stderr: os.Stderr}
+	code := a.run(os.Args[1:])
+	stop()
+	os.Exit(code)
+}
 
-	if err := os.MkdirAll(*dataDir, constants.DirPermissions); err != nil {
-		log.Fatalf("Failed to create data directory: %v", err)
+// run executes the subcommand named by the first argument and returns the exit code
+func (a *app) run(args []string) int {
+	if a.ctx == nil {
+		a.ctx = context.Background()
+	}
+	args = a.legacyAction(args)
+	if len(args) == 0 {
+		a.usage()
+		return exitUsage
 	}
 
-	switch *action {
-	case "scrape":
-		scrapeEpisodes(*dataDir, *lazy, *maxPages)
-	case "generate":
-		generateWebappData(*dataDir, *outputDir, *lazy)
-	case "tags":
-		generateTags(*dataDir)
-	default:
-		log.Fatal("Invalid action. Use: scrape, generate, or tags")
+	name := args[0]
+	switch name {
+	case "help", "-h", "-help", "--help":
+		if len(args) > 1 {
+			return a.run([]string{args[1], "-h"})
+		}
+		a.usage()
+		return exitOK
 	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			a.command = cmd
+			a.report, a.reportPath, a.metrics = nil, "", nil
+			code := cmd.run(a, args[1:])
+			if a.ctx.Err() != nil && code != exitOK {
+				code = exitInterrupted
+				a.printInterrupted()
+			}
+			a.writeReport(code)
+			return code
+		}
+	}
+
+	fmt.Fprintf(a.stderr, "Unknown command %q\n\n", name)
+	a.usage()
+	return exitUsage
+}
+
+// legacyAction translates the former -action=<name> flag into a subcommand
+func (a *app) legacyAction(args []string) []string {
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "action" {
+			continue
+		}
+		rest := append([]string(nil), args[:i]...)
+		if !hasValue {
+			if i+1 >= len(args) {
+				return args
+			}
+			value = args[i+1]
+			rest = append(rest, args[i+2:]...)
+		} else {
+			rest = append(rest, args[i+1:]...)
+		}
+		fmt.Fprintf(a.stderr, "Warning: -action is deprecated, use: scraper %s [flags]\n", value)
+		return append([]string{value}, rest...)
+	}
+	return args
 }
 
-func scrapeEpisodes(dataDir string, lazy bool, maxPages int) {
-	if lazy {
-		log.Println("Starting scraping process in LAZY mode (no MP3 downloads)...")
-	} else {
-		log.Println("Starting scraping process...")
+func (a *app) usage() {
+	fmt.Fprintf(a.stderr, "Usage: scraper <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(a.stderr, "  %-9s %s\n", cmd.name, cmd.summary)
 	}
+	fmt.Fprintf(a.stderr, "\nRun 'scraper help <command>' for the flags of a command.\n")
+}
 
-	c := collector.NewCollector()
-	episodes, err := c.ScrapeEpisodesWithLimit(maxPages)
-	if err != nil {
-		log.Fatalf("Failed to scrape episodes: %v", err)
+// newFlagSet creates the flag set of the running subcommand
+func (a *app) newFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(a.command.name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "Usage: scraper %s [flags]\n\n%s.\n\nFlags:\n", a.command.name, a.command.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the subcommand flags, returning the exit code to use when
+// the command must not run
+func parse(fs *flag.FlagSet, args []string) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, false
+		}
+		return exitUsage, false
 	}
+	return exitOK, true
+}
 
-	log.Printf("Found %d episodes", len(episodes))
+// startReport starts the run report of the command. It is written to the
+// configured report directory when the command ends; dry runs only write
+// one when -report is given.
+func (a *app) startReport(cfg *config.Config, cf *commonFlags, dryRun bool) *report.Report {
+	rep := report.New(a.command.name, cfg.Program, nil)
+	rep.DryRun = dryRun
 
-	storage := storage.NewStorage(dataDir)
-	successCount := 0
-	skipCount := 0
-	errorCount := 0
+	path := *cf.reportFile
+	if path == "" && !dryRun && cfg.Log.ReportDir != "" {
+		path = filepath.Join(cfg.Log.ReportDir, rep.FileName())
+	}
 
-	for i, episode := range episodes {
-		log.Printf("[%d/%d] Processing: %s", i+1, len(episodes), episode.Title)
+	// Kept without a path for the interruption summary
+	a.report, a.reportPath = rep, path
+	return rep
+}
 
-		// Save episode metadata (with existence check)
-		if err := storage.SaveEpisode(episode); err != nil {
-			log.Printf("Failed to save episode metadata %s: %v", episode.Title, err)
-			errorCount++
-			continue
+// writeReport finishes and saves the run report, if any
+func (a *app) writeReport(exitCode int) {
+	if a.report == nil {
+		return
+	}
+	a.report.Finish(exitCode)
+	if a.reportPath == "" {
+		return
+	}
+	if err := a.report.Write(a.reportPath); err != nil {
+		slog.Error("Failed to write run report", "error", err)
+		return
+	}
+	slog.Info("Run report written", "file", a.reportPath)
+}
+
+// printInterrupted prints what the command got done before it was interrupted
+func (a *app) printInterrupted() {
+	fmt.Fprintf(a.stderr, "\nInterrupted: %s stopped before completing", a.command.name)
+	if a.report == nil {
+		fmt.Fprintln(a.stderr, ".")
+		return
+	}
+
+	var done []string
+	for counter, n := range a.report.Counts {
+		if n > 0 {
+			done = append(done, fmt.Sprintf("%s=%d", counter, n))
 		}
+	}
+	sort.Strings(done)
+	if a.report.BytesDownloaded > 0 {
+		done = append(done, formatBytes(a.report.BytesDownloaded)+" downloaded")
+	}
+	elapsed := time.Since(a.report.StartedAt).Round(time.Second)
+	if len(done) == 0 {
+		fmt.Fprintf(a.stderr, " after %s, nothing done yet.\n", elapsed)
+		return
+	}
+	fmt.Fprintf(a.stderr, " after %s: %s.\n", elapsed, strings.Join(done, ", "))
+}
 
-		// Download audio and images only if not in lazy mode
-		if !lazy {
-			audioSuccess := true
-			imageSuccess := true
+// newMetrics creates the metrics of the command. The episodes gauge is
+// computed from the data directory whenever the metrics are collected.
+func (a *app) newMetrics(cfg *config.Config) *metrics.Metrics {
+	m := metrics.New()
+	st := storage.NewStorageWithOptions(cfg.DataDir, storageOptions(cfg))
+	m.Registry.OnCollect(func() {
+		counts, err := st.Availability()
+		if err != nil {
+			slog.Warn("Failed to count episodes for metrics", "error", err)
+			return
+		}
+		m.SetEpisodes(cfg.Program, counts)
+	})
+	a.metrics = m
+	return m
+}
 
-			// Download audio
-			if err := storage.DownloadAudio(episode); err != nil {
-				log.Printf("Failed to download audio for %s: %v", episode.Title, err)
-				audioSuccess = false
-			}
+// startMetrics creates the metrics of the command and serves them on
+// /metrics in the background when an address is configured
+func (a *app) startMetrics(cfg *config.Config) (*metrics.Metrics, error) {
+	m := a.newMetrics(cfg)
+	if cfg.Metrics.Addr == "" {
+		return m, nil
+	}
 
-			// Download image if available
-			if episode.Image != "" && episode.ImageFilename != "" {
-				if err := storage.DownloadImage(episode); err != nil {
-					log.Printf("Failed to download image for %s: %v", episode.Title, err)
-					imageSuccess = false
-				}
-			}
+	listener, err := net.Listen("tcp", cfg.Metrics.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(constants.MetricsPath, m.Handler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: constants.HTTPTimeout}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Metrics server failed", "error", err)
+		}
+	}()
+	slog.Info("Serving metrics", "url", "http://"+listener.Addr().String()+constants.MetricsPath)
+	return m, nil
+}
 
-			if audioSuccess && imageSuccess {
-				successCount++
-			} else {
-				errorCount++
-			}
-		} else {
-			log.Printf("Skipping audio and image downloads for %s (lazy mode)", episode.Title)
-			skipCount++
+// lockDataDir takes the data directory lock for the running command and
+// returns the function releasing it
+func (a *app) lockDataDir(st *storage.Storage) (func(), error) {
+	lock, err := st.Lock(a.command.name)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := lock.Unlock(); err != nil {
+			slog.Warn("Failed to release data directory lock", "error", err)
+		}
+	}, nil
+}
+
+// lockDataDirs takes the lock of the data directories a command writes into
+// without a storage of its own, skipping the ones not created yet, and
+// returns the function releasing them
+func (a *app) lockDataDirs(dryRun bool, dirs ...string) (func(), error) {
+	var unlocks []func()
+	release := func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			continue
 		}
+		unlock, err := a.lockDataDir(storage.NewStorageWithOptions(dir, storage.Options{DryRun: dryRun}))
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("%s: %w", dir, err)
+		}
+		unlocks = append(unlocks, unlock)
+	}
+	return release, nil
+}
+
+// commonFlags are the flags selecting the configuration, programme and logging
+type commonFlags struct {
+	fs           *flag.FlagSet
+	stderr       io.Writer
+	configFile   *string
+	dataDir      *string
+	programSlug  *string
+	programsFile *string
+	logLevel     *string
+	logFormat    *string
+	reportFile   *string
+}
+
+func (a *app) addCommonFlags(fs *flag.FlagSet) *commonFlags {
+	return &commonFlags{
+		fs:           fs,
+		stderr:       a.stderr,
+		configFile:   fs.String("config", constants.DefaultConfigFile, "configuration file"),
+		dataDir:      fs.String("dataDir", "", "data directory (default: the programme data directory)"),
+		programSlug:  fs.String("program", "", "programme to use (default from the programs file)"),
+		programsFile: fs.String("programs", constants.DefaultProgramsFile, "programme registry file"),
+		logLevel:     fs.String("logLevel", "", "log level: debug, info, warn or error (default from the configuration)"),
+		logFormat:    fs.String("logFormat", "", "log format: text or json (default from the configuration)"),
+		reportFile:   fs.String("report", "", "write the JSON run report to this file (default: a new file in the report directory)"),
+	}
+}
+
+// load merges the configuration sources: defaults < config file < environment < flags
+func (cf *commonFlags) load() (*config.Config, *program.Registry, error) {
+	cfg, err := config.Load(*cf.configFile, isSet(cf.fs, "config"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if isSet(cf.fs, "dataDir") {
+		cfg.DataDir = *cf.dataDir
+	}
+	if isSet(cf.fs, "program") {
+		cfg.Program = *cf.programSlug
+	}
+	if isSet(cf.fs, "programs") {
+		cfg.ProgramsFile = *cf.programsFile
+	}
+	if isSet(cf.fs, "logLevel") {
+		cfg.Log.Level = *cf.logLevel
+	}
+	if isSet(cf.fs, "logFormat") {
+		cfg.Log.Format = *cf.logFormat
+	}
+
+	if err := logging.Setup(cf.stderr, cfg.Log.Level, cfg.Log.Format); err != nil {
+		return nil, nil, err
+	}
+	if err := checkStorage(cfg); err != nil {
+		return nil, nil, err
+	}
+
+	registry, err := program.LoadRegistry(cfg.ProgramsFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load programme registry: %w", err)
 	}
 
-	if lazy {
-		log.Printf("Scraping completed in LAZY mode! Total: %d, Metadata saved: %d, Audio downloads skipped: %d, Errors: %d",
-			len(episodes), len(episodes)-errorCount, skipCount, errorCount)
-	} else {
-		log.Printf("Scraping completed! Total: %d, Success: %d, Skipped: %d, Errors: %d",
-			len(episodes), successCount, skipCount, errorCount)
+	return cfg, registry, nil
+}
+
+// loadProgram loads the configuration and resolves the selected programme
+func (cf *commonFlags) loadProgram() (*config.Config, program.Program, error) {
+	cfg, registry, err := cf.load()
+	if err != nil {
+		return nil, program.Program{}, err
 	}
+
+	prog, err := selectProgram(cfg, registry)
+	return cfg, prog, err
 }
 
-func generateWebappData(dataDir, outputDir string, lazy bool) {
-	log.Println("Generating webapp data files...")
+// selectProgram resolves the configured programme and its data directory
+func selectProgram(cfg *config.Config, registry *program.Registry) (program.Program, error) {
+	prog, err := registry.Get(cfg.Program)
+	if err != nil {
+		return program.Program{}, err
+	}
+	cfg.Program = prog.Slug
 
-	gen := generator.NewGenerator(dataDir)
-	if err := gen.GenerateWebappData(outputDir, lazy); err != nil {
-		log.Fatalf("Failed to generate webapp data: %v", err)
+	// Keep each programme in its own directory unless one is configured explicitly
+	if cfg.DataDir == "" {
+		cfg.DataDir = prog.DataDir
 	}
 
-	log.Println("Webapp data generation completed successfully!")
+	return prog, nil
 }
 
-func generateTags(dataDir string) {
-	log.Println("Generating tags.json file...")
+// audioFlags select the preferred audio rendition
+type audioFlags struct {
+	fs       *flag.FlagSet
+	formats  *string
+	bitrate  *int
+	smallest *bool
+}
 
-	tagSystem := generator.NewTagSystem(dataDir)
-	outputPath := "tags.json"
+func addAudioFlags(fs *flag.FlagSet) *audioFlags {
+	return &audioFlags{
+		fs:       fs,
+		formats:  fs.String("audioFormats", strings.Join(constants.AudioFormatPreference, ","), "preferred audio formats, most wanted first"),
+		bitrate:  fs.Int("audioBitrate", 0, "preferred audio bitrate in kbps (0 = highest available)"),
+		smallest: fs.Bool("audioSmallest", false, "pick the smallest audio rendition regardless of format"),
+	}
+}
 
-	if err := tagSystem.GenerateTagsFile(outputPath); err != nil {
-		log.Fatalf("Failed to generate tags file: %v", err)
+// apply overrides the configured audio preference with the flags given
+func (af *audioFlags) apply(cfg *config.Config) {
+	if isSet(af.fs, "audioFormats") {
+		cfg.Collector.AudioFormats = splitList(*af.formats)
+	}
+	if isSet(af.fs, "audioBitrate") {
+		cfg.Collector.AudioBitrate = *af.bitrate
 	}
+	if isSet(af.fs, "audioSmallest") {
+		cfg.Collector.AudioSmallest = *af.smallest
+	}
+}
+
+// metricsFlag overrides the configured metrics address
+type metricsFlag struct {
+	fs   *flag.FlagSet
+	addr *string
+}
+
+func addMetricsFlag(fs *flag.FlagSet) *metricsFlag {
+	return &metricsFlag{
+		fs:   fs,
+		addr: fs.String("metricsAddr", "", "serve metrics on this address, e.g. :9090 (default from the configuration)"),
+	}
+}
+
+func (mf *metricsFlag) apply(cfg *config.Config) {
+	if isSet(mf.fs, "metricsAddr") {
+		cfg.Metrics.Addr = *mf.addr
+	}
+}
+
+func dryRunFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("dry-run", false, "log the files that would be written without writing them")
+}
+
+// isSet reports whether a flag was given on the command line
+func isSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// splitList parses a comma separated flag value
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
 
-	log.Printf("Tags file generated successfully: %s", outputPath)
+// fail logs an error with its attributes and returns the failure exit code
+func fail(msg string, args ...any) int {
+	slog.Error(msg, args...)
+	return exitFailure
 }
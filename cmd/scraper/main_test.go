@@ -1,8 +1,29 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
 	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/config"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+	"github.com/p4u/enguardia-arxiu/internal/fake3cat"
+	"github.com/p4u/enguardia-arxiu/internal/fakestore"
+	"github.com/p4u/enguardia-arxiu/internal/generator"
+	"github.com/p4u/enguardia-arxiu/internal/hooks"
+	"github.com/p4u/enguardia-arxiu/internal/report"
+	"github.com/p4u/enguardia-arxiu/internal/storage"
 )
 
 func TestFlagDefaults(t *testing.T) {
@@ -89,3 +110,1111 @@ func TestMaxPagesFlag(t *testing.T) {
 		t.Errorf("Expected maxPages to be 5 when -maxPages 5 is passed, got %v", *maxPages)
 	}
 }
+
+func newFakeClients(t *testing.T, srv *fake3cat.Server, dataDir string) (*collector.Collector, *storage.Storage) {
+	t.Helper()
+
+	now := func() time.Time { return time.Date(2025, 9, 8, 10, 0, 0, 0, time.UTC) }
+	c := collector.NewCollectorWithOptions(collector.Options{
+		APIBaseURL:   srv.APIBaseURL(),
+		SiteURL:      srv.SiteURL(),
+		MediaBaseURL: srv.MediaBaseURL(),
+		Client:       srv.Client(),
+		Now:          now,
+	})
+	st := storage.NewStorageWithOptions(dataDir, storage.Options{Client: srv.Client(), Now: now})
+	return c, st
+}
+
+func TestScrapeEndToEnd(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	srv.FailMedia("jpg/1/0/1005.jpg", 404)
+
+	dataDir := t.TempDir()
+	c, st := newFakeClients(t, srv, dataDir)
+
+	failed, err := scrapeEpisodes(context.Background(), c, st, nil, nil, false, 0)
+	if err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+	if failed != 1 {
+		t.Errorf("Expected 1 episode with failed downloads, got %d", failed)
+	}
+
+	episodes, err := st.LoadEpisodes()
+	if err != nil {
+		t.Fatalf("Failed to load episodes: %v", err)
+	}
+	if len(episodes) != 5 {
+		t.Fatalf("Expected 5 stored episodes, got %d", len(episodes))
+	}
+
+	for _, name := range []string{"1245-la-batalla-de-l-ebre.mp3", "1245-la-batalla-de-l-ebre.jpg", "1244-els-almogàvers.mp3", "1243-la-pesta-negra.mp3"} {
+		info, err := os.Stat(filepath.Join(dataDir, name))
+		if err != nil {
+			t.Errorf("Expected %s to be downloaded: %v", name, err)
+			continue
+		}
+		if info.Size() == 0 {
+			t.Errorf("Expected %s to have content", name)
+		}
+	}
+
+	// The episode without audio is stored with the placeholder and no media
+	if _, err := os.Stat(filepath.Join(dataDir, "1242-els-templers-catalans.mp3")); !os.IsNotExist(err) {
+		t.Errorf("Expected no audio for the fallback episode, got %v", err)
+	}
+	// A failing image download does not prevent the audio download
+	if _, err := os.Stat(filepath.Join(dataDir, "1241-jaume-i-el-conqueridor.mp3")); err != nil {
+		t.Errorf("Expected audio despite the failed image: %v", err)
+	}
+
+	// The API eventually returns the missing audio and repair picks it up
+	srv.SetItem("1004", []byte(`{"resposta":{"status":"OK","item":{"audios":[{"text":"mp3/1/0/1004.mp3","format":"mp3"}]}}}`))
+	repairStorage := storage.NewStorageWithOptions(dataDir, storage.Options{
+		Client: srv.Client(),
+		Now:    func() time.Time { return time.Date(2025, 9, 10, 10, 0, 0, 0, time.UTC) },
+	})
+	if _, err := repairEpisodes(context.Background(), c, repairStorage, nil, false); err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "1242-els-templers-catalans.mp3")); err != nil {
+		t.Errorf("Expected repaired audio to be downloaded: %v", err)
+	}
+}
+
+func TestRepairTriesRenditions(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+
+	dataDir := t.TempDir()
+	c, st := newFakeClients(t, srv, dataDir)
+	if _, err := scrapeEpisodes(context.Background(), c, st, nil, nil, true, 0); err != nil {
+		t.Fatalf("Scrape failed: %v", err)
+	}
+	repair := func(day int, lazy bool) (int, collector.Episode) {
+		t.Helper()
+		repairStorage := storage.NewStorageWithOptions(dataDir, storage.Options{
+			Client: srv.Client(),
+			Now:    func() time.Time { return time.Date(2025, 10, day, 10, 0, 0, 0, time.UTC) },
+		})
+		failed, err := repairEpisodes(context.Background(), c, repairStorage, nil, lazy)
+		if err != nil {
+			t.Fatalf("Repair failed: %v", err)
+		}
+		episodes, err := repairStorage.LoadEpisodes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		episode, _ := findEpisode(episodes, "1242")
+		return failed, episode
+	}
+	renditions := func(name string) []byte {
+		return []byte(`{"resposta":{"status":"OK","item":{"audios":[` +
+			`{"text":"mp3/1/0/` + name + `.m4a","format":"m4a"},{"text":"mp3/1/0/` + name + `.mp3","format":"mp3"}]}}}`)
+	}
+
+	// No rendition is served: a failed attempt, still on the placeholder
+	srv.SetItem("1004", renditions("1004a"))
+	srv.FailMedia("mp3/1/0/1004a.mp3", 404)
+	srv.FailMedia("mp3/1/0/1004a.m4a", 404)
+	failed, episode := repair(1, true)
+	if failed != 1 || !episode.HasFallbackAudio() || episode.AudioFailures != 2 {
+		t.Errorf("Expected a failed attempt, got failed=%d %+v", failed, episode)
+	}
+
+	// The preferred MP3 fails to download, the M4A is used instead and
+	// replaces the stale file named after the MP3
+	stale := filepath.Join(dataDir, episode.Filename)
+	if err := os.WriteFile(stale, []byte("stale"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	srv.SetItem("1004", renditions("1004b"))
+	srv.FailMedia("mp3/1/0/1004b.mp3", 404)
+	failed, episode = repair(20, false)
+	if failed != 0 || !strings.HasSuffix(episode.AudioURL, "/1004b.m4a") || episode.AudioFailures != 0 {
+		t.Errorf("Expected the M4A rendition to be used, got failed=%d %+v", failed, episode)
+	}
+	if filepath.Ext(episode.Filename) != ".m4a" || filepath.Base(stale) == episode.Filename {
+		t.Errorf("Expected the file name to follow the M4A rendition, got %s", episode.Filename)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("Expected the stale MP3 file to be removed: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dataDir, episode.Filename)); err != nil || info.Size() != fake3cat.AudioSize {
+		t.Errorf("Expected the repaired audio to be downloaded: %v", err)
+	}
+}
+
+func newTestApp() (*app, *bytes.Buffer, *bytes.Buffer) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	return &app{stdout: stdout, stderr: stderr}, stdout, stderr
+}
+
+func TestRunUsage(t *testing.T) {
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{nil, exitUsage},
+		{[]string{"help"}, exitOK},
+		{[]string{"help", "scrape"}, exitOK},
+		{[]string{"unknown"}, exitUsage},
+		{[]string{"stats", "-unknownFlag"}, exitUsage},
+		{[]string{"export", "-format=xml"}, exitUsage},
+		{[]string{"config"}, exitUsage},
+	}
+
+	for _, tt := range tests {
+		a, _, _ := newTestApp()
+		if code := a.run(tt.args); code != tt.code {
+			t.Errorf("run(%q) = %d, want %d", tt.args, code, tt.code)
+		}
+	}
+
+	a, _, stderr := newTestApp()
+	a.run([]string{"help", "generate"})
+	for _, want := range []string{"Usage: scraper generate", "-dry-run", "-lazy", "-output"} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("Expected generate help to mention %q, got:\n%s", want, stderr.String())
+		}
+	}
+}
+
+func TestLegacyAction(t *testing.T) {
+	a, _, _ := newTestApp()
+
+	got := a.legacyAction([]string{"-action=config", "-dataDir=x", "print"})
+	want := []string{"config", "-dataDir=x", "print"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("legacyAction = %q, want %q", got, want)
+	}
+
+	got = a.legacyAction([]string{"-lazy", "-action", "scrape"})
+	if strings.Join(got, " ") != "scrape -lazy" {
+		t.Errorf("legacyAction = %q, want scrape -lazy", got)
+	}
+}
+
+// setFakeEnv points the configuration at the fake 3Cat server
+func setFakeEnv(t *testing.T, srv *fake3cat.Server) {
+	t.Helper()
+	t.Setenv("ENGUARDIA_COLLECTOR_API_BASE_URL", srv.APIBaseURL())
+	t.Setenv("ENGUARDIA_COLLECTOR_SITE_URL", srv.SiteURL())
+	t.Setenv("ENGUARDIA_COLLECTOR_MEDIA_BASE_URL", srv.MediaBaseURL())
+	t.Setenv("ENGUARDIA_COLLECTOR_REQUEST_DELAY", "1ms")
+	t.Setenv("ENGUARDIA_LOG_REPORT_DIR", t.TempDir())
+}
+
+func TestCommandsEndToEnd(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	srv.FailMedia("jpg/1/0/1005.jpg", 404)
+
+	setFakeEnv(t, srv)
+
+	dataDir := filepath.Join(t.TempDir(), "episodes")
+	outputDir := filepath.Join(t.TempDir(), "data")
+
+	// A dry run fetches the listing but writes nothing
+	a, _, _ := newTestApp()
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir, "-dry-run"}); code != exitOK {
+		t.Fatalf("scrape -dry-run exited with %d", code)
+	}
+	if _, err := os.Stat(dataDir); !os.IsNotExist(err) {
+		t.Fatalf("Expected dry run not to create %s, got %v", dataDir, err)
+	}
+
+	// Metadata only, then download the media separately
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir, "-lazy"}); code != exitOK {
+		t.Fatalf("scrape -lazy exited with %d", code)
+	}
+	if code := a.run([]string{"verify", "-dataDir=" + dataDir, "-metadataOnly"}); code != exitProblems {
+		t.Errorf("Expected verify to report the fallback audio episode, got %d", code)
+	}
+	if code := a.run([]string{"download", "-dataDir=" + dataDir}); code != exitProblems {
+		t.Errorf("Expected download to report the failed image, got %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "1245-la-batalla-de-l-ebre.mp3")); err != nil {
+		t.Errorf("Expected audio to be downloaded: %v", err)
+	}
+
+	a, stdout, _ := newTestApp()
+	if code := a.run([]string{"verify", "-dataDir=" + dataDir}); code != exitProblems {
+		t.Errorf("verify exited with %d, want %d", code, exitProblems)
+	}
+	for _, want := range []string{"fallback placeholder", "1241-jaume-i-el-conqueridor.jpg not downloaded"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("Expected verify to report %q, got:\n%s", want, stdout.String())
+		}
+	}
+
+	a, stdout, _ = newTestApp()
+	if code := a.run([]string{"export", "-dataDir=" + dataDir, "-format=csv"}); code != exitOK {
+		t.Fatalf("export exited with %d", code)
+	}
+	records, err := csv.NewReader(stdout).ReadAll()
+	if err != nil {
+		t.Fatalf("Invalid CSV: %v", err)
+	}
+	if len(records) != 6 {
+		t.Errorf("Expected header and 5 episodes, got %d rows", len(records))
+	}
+
+	a, stdout, _ = newTestApp()
+	if code := a.run([]string{"stats", "-dataDir=" + dataDir, "-json"}); code != exitOK {
+		t.Fatalf("stats exited with %d", code)
+	}
+	if !strings.Contains(stdout.String(), `"episodes": 5`) {
+		t.Errorf("Unexpected stats: %s", stdout.String())
+	}
+
+	if code := a.run([]string{"generate", "-dataDir=" + dataDir, "-output=" + outputDir, "-dry-run"}); code != exitOK {
+		t.Fatalf("generate -dry-run exited with %d", code)
+	}
+	if _, err := os.Stat(outputDir); !os.IsNotExist(err) {
+		t.Errorf("Expected dry run not to create %s, got %v", outputDir, err)
+	}
+	if code := a.run([]string{"generate", "-dataDir=" + dataDir, "-output=" + outputDir}); code != exitOK {
+		t.Fatalf("generate exited with %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "episodes.json")); err != nil {
+		t.Errorf("Expected episodes.json: %v", err)
+	}
+
+	// Generating again swaps the whole directory and leaves no staging copy
+	if code := a.run([]string{"generate", "-dataDir=" + dataDir, "-output=" + outputDir}); code != exitOK {
+		t.Fatalf("second generate exited with %d", code)
+	}
+	if entries, err := os.ReadDir(filepath.Dir(outputDir)); err != nil || len(entries) != 1 {
+		t.Errorf("Expected only the output directory, got %v (%v)", entries, err)
+	}
+}
+
+func TestRunReport(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	srv.FailMedia("jpg/1/0/1005.jpg", 404)
+	setFakeEnv(t, srv)
+
+	dataDir := t.TempDir()
+	reportPath := filepath.Join(t.TempDir(), "run.json")
+
+	a, _, stderr := newTestApp()
+	args := []string{"scrape", "-dataDir=" + dataDir, "-logFormat=json", "-report=" + reportPath}
+	if code := a.run(args); code != exitProblems {
+		t.Fatalf("scrape exited with %d, want %d", code, exitProblems)
+	}
+	if !strings.Contains(stderr.String(), `"msg":"Scraping completed"`) {
+		t.Errorf("Expected JSON log lines, got:\n%s", stderr.String())
+	}
+
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("Expected run report: %v", err)
+	}
+	var rep report.Report
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatalf("Invalid run report: %v", err)
+	}
+
+	if rep.Command != "scrape" || rep.ExitCode != exitProblems {
+		t.Errorf("Unexpected command %q and exit code %d", rep.Command, rep.ExitCode)
+	}
+	if len(rep.NewEpisodes) != 5 || rep.Counts[report.MetadataSaved] != 5 {
+		t.Errorf("Expected 5 new episodes, got %q", rep.NewEpisodes)
+	}
+	if rep.Counts[report.AudioDownloaded] != 4 || rep.Counts[report.FallbackAudio] != 1 {
+		t.Errorf("Unexpected counts: %v", rep.Counts)
+	}
+	if rep.BytesDownloaded == 0 {
+		t.Error("Expected downloaded bytes to be recorded")
+	}
+	// Errors are sorted by episode: the failed image and the unresolved audio
+	if len(rep.Errors) != 2 || rep.Errors[0].Stage != "image" || !strings.HasPrefix(rep.Errors[0].Episode, "1241") ||
+		rep.Errors[1].Stage != "resolve" || !strings.HasPrefix(rep.Errors[1].Episode, "1242") {
+		t.Errorf("Expected the episode 1241 image and 1242 audio failures, got %+v", rep.Errors)
+	}
+	for _, phase := range []string{"scrape", "download"} {
+		if _, ok := rep.PhaseSeconds[phase]; !ok {
+			t.Errorf("Expected the %s phase duration", phase)
+		}
+	}
+
+	// A second run finds nothing new and writes its report to the report directory
+	a, _, _ = newTestApp()
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir, "-lazy", "-logLevel=warn"}); code != exitOK {
+		t.Fatalf("scrape exited with %d", code)
+	}
+	reports, err := filepath.Glob(filepath.Join(os.Getenv("ENGUARDIA_LOG_REPORT_DIR"), "*-scrape.json"))
+	if err != nil || len(reports) != 1 {
+		t.Fatalf("Expected one report in the report directory, got %v (%v)", reports, err)
+	}
+
+	if code := a.run([]string{"stats", "-dataDir=" + dataDir, "-logLevel=verbose"}); code != exitFailure {
+		t.Errorf("Expected an invalid log level to fail, got %d", code)
+	}
+}
+
+func TestScrapeMetrics(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	srv.FailMedia("jpg/1/0/1005.jpg", 404)
+	setFakeEnv(t, srv)
+
+	dataDir := t.TempDir()
+	a, _, _ := newTestApp()
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir, "-metricsAddr=127.0.0.1:0"}); code != exitProblems {
+		t.Fatalf("scrape exited with %d, want %d", code, exitProblems)
+	}
+
+	var buf bytes.Buffer
+	if err := a.metrics.Registry.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"enguardia_api_pages_fetched_total 2",
+		`enguardia_api_request_duration_seconds_count{endpoint="list"} 2`,
+		`enguardia_downloads_total{media="audio"} 4`,
+		`enguardia_retries_total{operation="audio_resolve"} 2`,
+		`enguardia_failures_total{operation="resolve",class="api"} 1`,
+		`enguardia_failures_total{operation="image",class="http_status"} 1`,
+		`enguardia_episodes{program="en-guardia",availability="downloaded"} 4`,
+		`enguardia_episodes{program="en-guardia",availability="fallback"} 1`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected %q in:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestWatchOnce(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	setFakeEnv(t, srv)
+
+	dataDir := t.TempDir()
+	outputDir := filepath.Join(t.TempDir(), "data")
+	args := []string{"watch", "-once", "-lazy", "-dataDir=" + dataDir, "-output=" + outputDir}
+
+	a, _, _ := newTestApp()
+	if code := a.run(args); code != exitOK {
+		t.Fatalf("watch exited with %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "episodes.json")); err != nil {
+		t.Errorf("Expected the webapp data to be generated: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, constants.LockFile)); !os.IsNotExist(err) {
+		t.Errorf("Expected the lock to be released, got %v", err)
+	}
+
+	// Nothing new on the first page: the second page is not fetched again
+	countPages := func() int {
+		n := 0
+		for _, req := range srv.Requests() {
+			if strings.Contains(req, "origen=llistat") {
+				n++
+			}
+		}
+		return n
+	}
+	before := countPages()
+	a.run(args)
+	if fetched := countPages() - before; fetched != 1 {
+		t.Errorf("Expected the incremental scrape to fetch 1 page, got %d", fetched)
+	}
+
+	// A second instance can't run while the directory is locked
+	lock, err := storage.NewStorage(dataDir).Lock("watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Unlock()
+	if code := a.run(args); code != exitFailure {
+		t.Errorf("Expected watch to refuse a locked directory, got %d", code)
+	}
+	for _, args := range [][]string{
+		{"download", "-dataDir=" + dataDir},
+		{"generate", "-dataDir=" + dataDir, "-output=" + outputDir},
+		{"tags", "-dataDir=" + dataDir, "-tagsFile=" + filepath.Join(t.TempDir(), "tags.json")},
+		{"catalog", "-dataDir=" + dataDir, "import"},
+	} {
+		if code := a.run(args); code != exitFailure {
+			t.Errorf("Expected %s to refuse a locked directory, got %d", args[0], code)
+		}
+	}
+}
+
+func TestWatchStopsWhenCancelled(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	setFakeEnv(t, srv)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	a, _, _ := newTestApp()
+	a.ctx = ctx
+	args := []string{"watch", "-lazy", "-dataDir=" + t.TempDir(), "-output=" + t.TempDir(), "-interval=1h"}
+	if code := a.run(args); code != exitOK {
+		t.Errorf("Expected a cancelled watch to stop cleanly, got %d", code)
+	}
+}
+
+func TestServeStopsWhenCancelled(t *testing.T) {
+	t.Setenv("ENGUARDIA_LOG_REPORT_DIR", t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+
+	a, _, _ := newTestApp()
+	a.ctx = ctx
+	done := make(chan int, 1)
+	go func() {
+		done <- a.run([]string{"serve", "-port=0", "-staticDir=" + t.TempDir()})
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case code := <-done:
+		if code != exitOK {
+			t.Errorf("Expected a stopped serve to exit with %d, got %d", exitOK, code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not stop when cancelled")
+	}
+}
+
+func TestScrapeNotifiesHooks(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	setFakeEnv(t, srv)
+
+	var mu sync.Mutex
+	var titles []string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event hooks.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Invalid hook payload: %v", err)
+		}
+		mu.Lock()
+		titles = append(titles, event.Episode.Title)
+		mu.Unlock()
+	}))
+	defer hook.Close()
+	t.Setenv("ENGUARDIA_HOOKS_WEBHOOKS", hook.URL)
+
+	dataDir := t.TempDir()
+	args := []string{"scrape", "-lazy", "-dataDir=" + dataDir}
+	a, _, _ := newTestApp()
+	if code := a.run(args); code != exitOK {
+		t.Fatalf("scrape exited with %d", code)
+	}
+	if len(titles) != 5 || titles[0] != "1245 - La batalla de l'Ebre" {
+		t.Errorf("Expected the 5 new episodes to be notified, got %q", titles)
+	}
+
+	// Known episodes are not notified again
+	titles = nil
+	if code := a.run(args); code != exitOK {
+		t.Fatalf("scrape exited with %d", code)
+	}
+	if len(titles) != 0 {
+		t.Errorf("Expected no notifications for known episodes, got %q", titles)
+	}
+}
+
+func TestGC(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	setFakeEnv(t, srv)
+
+	dataDir := t.TempDir()
+	a, _, _ := newTestApp()
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir, "-lazy"}); code != exitOK {
+		t.Fatalf("scrape exited with %d", code)
+	}
+	for name, size := range map[string]int{
+		"1200-episodi-esborrat.mp3":                            2048,
+		"1245-la-batalla-de-l-ebre.mp3" + constants.TempSuffix: 10,
+	} {
+		if err := os.WriteFile(filepath.Join(dataDir, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a, stdout, _ := newTestApp()
+	if code := a.run([]string{"gc", "-dataDir=" + dataDir}); code != exitProblems {
+		t.Fatalf("gc exited with %d, want %d", code, exitProblems)
+	}
+	want := [][2]string{
+		{"1200-episodi-esborrat.mp3", "audio"},
+		{"1245-la-batalla-de-l-ebre.mp3.tmp", "temporary"},
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("Expected %d orphans, got:\n%s", len(want), stdout.String())
+	}
+	for i, w := range want {
+		if fields := strings.Fields(lines[i]); fields[len(fields)-1] != w[0] || fields[len(fields)-2] != w[1] {
+			t.Errorf("Line %d = %q, want %s (%s)", i, lines[i], w[0], w[1])
+		}
+	}
+	if !strings.Contains(lines[0], "2.0 KiB") {
+		t.Errorf("Expected the size to be listed, got %q", lines[0])
+	}
+
+	if code := a.run([]string{"gc", "-dataDir=" + dataDir, "-quarantine", "-delete"}); code != exitUsage {
+		t.Errorf("Expected -quarantine with -delete to be rejected, got %d", code)
+	}
+
+	a, _, _ = newTestApp()
+	if code := a.run([]string{"gc", "-dataDir=" + dataDir, "-quarantine"}); code != exitOK {
+		t.Fatalf("gc -quarantine exited with %d", code)
+	}
+	moved, err := filepath.Glob(filepath.Join(dataDir, constants.QuarantineDir, "*", "*"))
+	if err != nil || len(moved) != len(want) {
+		t.Errorf("Expected %d quarantined files, got %v (%v)", len(want), moved, err)
+	}
+
+	a, _, _ = newTestApp()
+	if code := a.run([]string{"gc", "-dataDir=" + dataDir}); code != exitOK {
+		t.Errorf("Expected nothing left to clean up, got %d", code)
+	}
+}
+
+func TestObjectsLayout(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	setFakeEnv(t, srv)
+	t.Setenv("ENGUARDIA_STORAGE_LAYOUT", storage.LayoutObjects)
+
+	dataDir := t.TempDir()
+	a, _, _ := newTestApp()
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir}); code != exitOK {
+		t.Fatalf("scrape exited with %d", code)
+	}
+
+	st := storage.NewStorage(dataDir)
+	manifest, err := st.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameObject := func(name string) bool {
+		file, errFile := os.Stat(filepath.Join(dataDir, name))
+		object, errObject := os.Stat(filepath.Join(dataDir, constants.ObjectsDir, manifest.Files[name]))
+		return errFile == nil && errObject == nil && os.SameFile(file, object)
+	}
+	if !sameObject("1245-la-batalla-de-l-ebre.mp3") || !sameObject("1245-la-batalla-de-l-ebre.jpg") {
+		t.Fatalf("Expected the media to be linked to its objects, manifest %+v", manifest.Files)
+	}
+
+	// A retitled episode reuses the stored object instead of downloading it again
+	episodes, err := st.LoadEpisodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ep := range episodes {
+		if ep.Number() == 1245 {
+			ep.Filename = "1245-la-batalla-de-l-ebre-retitulat.mp3"
+			if err := st.UpdateEpisode(ep); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	requests := len(srv.Requests())
+	a, _, _ = newTestApp()
+	if code := a.run([]string{"download", "-dataDir=" + dataDir}); code != exitOK {
+		t.Fatalf("download exited with %d", code)
+	}
+	for _, req := range srv.Requests()[requests:] {
+		if strings.HasPrefix(req, "/multimedia/") {
+			t.Errorf("Expected no media to be downloaded again, got %s", req)
+		}
+	}
+	if manifest, err = storage.NewStorage(dataDir).Manifest(); err != nil {
+		t.Fatal(err)
+	}
+	if !sameObject("1245-la-batalla-de-l-ebre-retitulat.mp3") {
+		t.Error("Expected the retitled audio to be linked to the stored object")
+	}
+
+	// The old name is an orphan, its object is still in use
+	a, stdout, _ := newTestApp()
+	if code := a.run([]string{"gc", "-dataDir=" + dataDir}); code != exitProblems {
+		t.Fatalf("gc exited with %d, want %d", code, exitProblems)
+	}
+	if out := strings.TrimSpace(stdout.String()); strings.Count(out, "\n") != 0 || !strings.HasSuffix(out, "1245-la-batalla-de-l-ebre.mp3") {
+		t.Errorf("Expected only the old audio name to be orphaned, got:\n%s", out)
+	}
+
+	// Objects are orphaned once no episode refers to them
+	if err := os.Remove(filepath.Join(dataDir, "1244-els-almogàvers.json")); err != nil {
+		t.Fatal(err)
+	}
+	a, stdout, _ = newTestApp()
+	a.run([]string{"gc", "-dataDir=" + dataDir})
+	if n := strings.Count(stdout.String(), " object "); n != 2 {
+		t.Errorf("Expected the 2 objects of episode 1244 to be orphaned, got:\n%s", stdout.String())
+	}
+}
+
+func TestBackendOptions(t *testing.T) {
+	cfg := config.Default()
+	err := cfg.ApplyEnv([]string{
+		"ENGUARDIA_STORAGE_BACKEND_TYPE=s3",
+		"ENGUARDIA_STORAGE_BACKEND_ENDPOINT=http://localhost:9000",
+		"ENGUARDIA_STORAGE_BACKEND_BUCKET=arxiu",
+		"ENGUARDIA_STORAGE_BACKEND_PREFIX=podcasts",
+		"ENGUARDIA_STORAGE_BACKEND_ACCESS_KEY=AKIATEST",
+		"ENGUARDIA_STORAGE_BACKEND_SECRET_KEY=molt-secret",
+		"ENGUARDIA_STORAGE_BACKEND_PUBLIC_URL=https://media.example.cat/podcasts/",
+	})
+	if err != nil {
+		t.Fatalf("ApplyEnv: %v", err)
+	}
+	if err := checkStorage(cfg); err != nil {
+		t.Fatalf("checkStorage: %v", err)
+	}
+
+	opts := backendOptions(cfg, "en-guardia")
+	if opts.Prefix != "podcasts/en-guardia" || opts.PublicURL != "https://media.example.cat/podcasts/en-guardia" {
+		t.Errorf("Expected one prefix per programme, got %q and %q", opts.Prefix, opts.PublicURL)
+	}
+	if storageOptions(cfg).Backend == nil {
+		t.Error("Expected the storage to use the s3 backend")
+	}
+
+	cfg.Storage.Layout = "objects"
+	if err := checkStorage(cfg); err == nil {
+		t.Error("Expected the objects layout to need the filesystem backend")
+	}
+	cfg.Storage.Layout = ""
+	cfg.Storage.Backend.Bucket = ""
+	if err := checkStorage(cfg); err == nil {
+		t.Error("Expected a missing bucket to be rejected")
+	}
+}
+
+func TestS3Backend(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	setFakeEnv(t, srv)
+	bucket := fakestore.NewS3("arxiu", "AKIATEST")
+	defer bucket.Close()
+	t.Setenv("ENGUARDIA_STORAGE_BACKEND_TYPE", "s3")
+	t.Setenv("ENGUARDIA_STORAGE_BACKEND_ENDPOINT", bucket.URL)
+	t.Setenv("ENGUARDIA_STORAGE_BACKEND_BUCKET", "arxiu")
+	t.Setenv("ENGUARDIA_STORAGE_BACKEND_ACCESS_KEY", "AKIATEST")
+	t.Setenv("ENGUARDIA_STORAGE_BACKEND_SECRET_KEY", "secret")
+	t.Setenv("ENGUARDIA_STORAGE_BACKEND_PUBLIC_URL", "https://media.example.cat")
+
+	dataDir := t.TempDir()
+	outputDir := filepath.Join(t.TempDir(), "data")
+	a, _, _ := newTestApp()
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir}); code != exitOK {
+		t.Fatalf("scrape exited with %d", code)
+	}
+
+	// Media goes to the bucket under the programme slug, metadata stays local
+	objects := bucket.Objects()
+	if _, ok := objects["en-guardia/1245-la-batalla-de-l-ebre.mp3"]; !ok {
+		t.Fatalf("Expected the audio in the bucket, got %d objects", len(objects))
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "1245-la-batalla-de-l-ebre.mp3")); !os.IsNotExist(err) {
+		t.Errorf("Expected no local audio, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "1245-la-batalla-de-l-ebre.json")); err != nil {
+		t.Errorf("Expected local metadata: %v", err)
+	}
+
+	// Stored media is found in the bucket and not downloaded again
+	requests := len(srv.Requests())
+	if code := a.run([]string{"download", "-dataDir=" + dataDir}); code != exitOK {
+		t.Fatalf("download exited with %d", code)
+	}
+	for _, req := range srv.Requests()[requests:] {
+		if strings.HasPrefix(req, "/multimedia/") {
+			t.Errorf("Expected no media to be downloaded again, got %s", req)
+		}
+	}
+	if code := a.run([]string{"verify", "-dataDir=" + dataDir}); code != exitProblems {
+		t.Errorf("Expected verify to only report the fallback audio, got %d", code)
+	}
+
+	if code := a.run([]string{"generate", "-dataDir=" + dataDir, "-output=" + outputDir}); code != exitOK {
+		t.Fatalf("generate exited with %d", code)
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "episodes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var webapp struct {
+		Episodes []struct {
+			AudioURL string `json:"audioUrl"`
+			Image    string `json:"image"`
+			Filename string `json:"filename"`
+			FileSize int64  `json:"fileSize"`
+		} `json:"episodes"`
+	}
+	if err := json.Unmarshal(data, &webapp); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, ep := range webapp.Episodes {
+		if ep.Filename == "1245-la-batalla-de-l-ebre.mp3" {
+			found = true
+			if ep.AudioURL != "https://media.example.cat/en-guardia/1245-la-batalla-de-l-ebre.mp3" || ep.FileSize != fake3cat.AudioSize {
+				t.Errorf("Expected the audio to point to the bucket, got %s (%d bytes)", ep.AudioURL, ep.FileSize)
+			}
+			if ep.Image != "https://media.example.cat/en-guardia/1245-la-batalla-de-l-ebre.jpg" {
+				t.Errorf("Expected the image to point to the bucket, got %s", ep.Image)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected episode 1245 in episodes.json")
+	}
+
+	// Orphans in the bucket are listed and quarantined locally
+	if err := os.Remove(filepath.Join(dataDir, "1244-els-almogàvers.json")); err != nil {
+		t.Fatal(err)
+	}
+	a, _, _ = newTestApp()
+	if code := a.run([]string{"gc", "-dataDir=" + dataDir, "-quarantine"}); code != exitOK {
+		t.Fatalf("gc -quarantine exited with %d", code)
+	}
+	if _, ok := bucket.Objects()["en-guardia/1244-els-almogàvers.mp3"]; ok {
+		t.Error("Expected the orphaned audio to be removed from the bucket")
+	}
+	moved, err := filepath.Glob(filepath.Join(dataDir, constants.QuarantineDir, "*", "1244-els-almogàvers.mp3"))
+	if err != nil || len(moved) != 1 {
+		t.Errorf("Expected the orphaned audio in the quarantine, got %v (%v)", moved, err)
+	}
+}
+
+func TestRetitledEpisode(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	setFakeEnv(t, srv)
+
+	dataDir := t.TempDir()
+	a, _, _ := newTestApp()
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir, "-lazy"}); code != exitOK {
+		t.Fatalf("scrape exited with %d", code)
+	}
+
+	// Store the episode as it was before 3Cat retitled it
+	st := storage.NewStorage(dataDir)
+	episodes, err := st.LoadEpisodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	episode, _ := findEpisode(episodes, "1241")
+	current := episode.JSONFile
+	episode.Title = "1241 - Jaume I"
+	episode.JSONFile = "1241-jaume-i.json"
+	if err := st.UpdateEpisode(episode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dataDir, current)); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir, "-lazy"}); code != exitOK {
+		t.Fatalf("scrape exited with %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, current)); !os.IsNotExist(err) {
+		t.Errorf("Expected the retitled episode to keep its file, found %s (%v)", current, err)
+	}
+
+	episodes, err = storage.NewStorage(dataDir).LoadEpisodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, ok := findEpisode(episodes, "1241")
+	if !ok || stored.JSONFile != "1241-jaume-i.json" || stored.Filename != episode.Filename {
+		t.Fatalf("Unexpected stored episode %+v", stored)
+	}
+	var events []string
+	for _, event := range stored.History {
+		events = append(events, event.Event+" "+event.Field)
+	}
+	if want := "first_seen , field_changed title"; strings.Join(events, ", ") != want {
+		t.Errorf("History = %v, want %s", events, want)
+	}
+	if last := stored.History[len(stored.History)-1]; last.Old != "1241 - Jaume I" || last.New != stored.Title {
+		t.Errorf("Unexpected change %+v", last)
+	}
+}
+
+func TestGenerateRemoteOptions(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	setFakeEnv(t, srv)
+	t.Setenv("ENGUARDIA_GENERATOR_PROBE_INTERVAL", "1ms")
+
+	dataDir := t.TempDir()
+	a, _, _ := newTestApp()
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir, "-lazy"}); code != exitOK {
+		t.Fatalf("scrape exited with %d", code)
+	}
+	srv.FailMedia("mp3/1/0/1001.mp3", http.StatusNotFound)
+
+	outputDir := filepath.Join(t.TempDir(), "data")
+	if code := a.run([]string{"generate", "-dataDir=" + dataDir, "-output=" + outputDir, "-lazy", "-probe", "-remoteThumbnails"}); code != exitOK {
+		t.Fatalf("generate exited with %d", code)
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "episodes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var generated struct {
+		Episodes []struct {
+			ID        string `json:"id"`
+			Available bool   `json:"available"`
+			Thumbnail string `json:"thumbnail"`
+		} `json:"episodes"`
+	}
+	if err := json.Unmarshal(data, &generated); err != nil {
+		t.Fatal(err)
+	}
+	thumbnails := 0
+	for _, ep := range generated.Episodes {
+		if ep.ID == "ep-1245" && ep.Available {
+			t.Error("Expected -probe to find the dead audio URL")
+		}
+		if ep.Thumbnail != "" {
+			thumbnails++
+		}
+	}
+	if thumbnails != 4 {
+		t.Errorf("Expected -remoteThumbnails to build 4 thumbnails, got %d", thumbnails)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, constants.ProbeCacheFile)); err != nil {
+		t.Errorf("Expected the probe cache: %v", err)
+	}
+}
+
+func TestGenerateProbeInterrupted(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	setFakeEnv(t, srv)
+	t.Setenv("ENGUARDIA_GENERATOR_PROBE_INTERVAL", "1h")
+	t.Setenv("ENGUARDIA_GENERATOR_PROBE_CONCURRENCY", "1")
+
+	dataDir := t.TempDir()
+	a, _, _ := newTestApp()
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir, "-lazy"}); code != exitOK {
+		t.Fatalf("scrape exited with %d", code)
+	}
+
+	// Cancelled while waiting to send the second probe
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	outputDir := filepath.Join(t.TempDir(), "data")
+	a, _, _ = newTestApp()
+	a.ctx = ctx
+	done := make(chan int, 1)
+	go func() {
+		done <- a.run([]string{"generate", "-dataDir=" + dataDir, "-output=" + outputDir, "-lazy", "-probe"})
+	}()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		probed := false
+		for _, uri := range srv.Requests() {
+			probed = probed || strings.HasPrefix(uri, "/multimedia/mp3/")
+		}
+		if probed {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("No probe was sent")
+		}
+	}
+	cancel()
+
+	select {
+	case code := <-done:
+		if code != exitInterrupted {
+			t.Errorf("Expected an interrupted generate to exit with %d, got %d", exitInterrupted, code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("generate did not stop when cancelled")
+	}
+	if _, err := os.Stat(outputDir); !os.IsNotExist(err) {
+		t.Errorf("Expected no output from an interrupted generate: %v", err)
+	}
+}
+
+func TestGeneratePages(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	setFakeEnv(t, srv)
+	t.Setenv("ENGUARDIA_GENERATOR_SITE_URL", "https://arxiu.example.cat/enguardia")
+
+	dataDir := t.TempDir()
+	a, _, _ := newTestApp()
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir, "-lazy"}); code != exitOK {
+		t.Fatalf("scrape exited with %d", code)
+	}
+
+	siteDir := t.TempDir()
+	outputDir := filepath.Join(t.TempDir(), "data")
+	if code := a.run([]string{"generate", "-dataDir=" + dataDir, "-output=" + outputDir, "-lazy", "-site=" + siteDir}); code != exitOK {
+		t.Fatalf("generate exited with %d", code)
+	}
+	data, err := os.ReadFile(filepath.Join(siteDir, constants.EpisodePagesDir, "ep-1245", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<link rel="canonical" href="https://arxiu.example.cat/enguardia/episodes/ep-1245/" />`; !strings.Contains(string(data), want) {
+		t.Errorf("Expected the page to contain %q, got:\n%s", want, data)
+	}
+	for _, name := range []string{constants.SitemapFile, constants.RobotsFile} {
+		if _, err := os.Stat(filepath.Join(siteDir, name)); err != nil {
+			t.Errorf("Expected %s in the site directory: %v", name, err)
+		}
+	}
+
+	a, stdout, _ := newTestApp()
+	if code := a.run([]string{"config", "base-path"}); code != exitOK || stdout.String() != "/enguardia/\n" {
+		t.Errorf("config base-path = %d, %q", code, stdout.String())
+	}
+}
+
+func TestGenerateSiteConfig(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	setFakeEnv(t, srv)
+	t.Setenv("ENGUARDIA_GENERATOR_SITE_TITLE", "Arxiu d'En Guàrdia")
+	t.Setenv("ENGUARDIA_GENERATOR_AUDIO_BASE_URL", "https://media.example.cat/audio/")
+	t.Setenv("ENGUARDIA_GENERATOR_THEME_PRIMARY_COLOR", "#004d40")
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	dataDir := t.TempDir()
+	a, _, _ := newTestApp()
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir, "-lazy"}); code != exitOK {
+		t.Fatalf("scrape exited with %d", code)
+	}
+
+	generate := func() []byte {
+		t.Helper()
+		outputDir := filepath.Join(t.TempDir(), "data")
+		if code := a.run([]string{"generate", "-dataDir=" + dataDir, "-output=" + outputDir}); code != exitOK {
+			t.Fatalf("generate exited with %d", code)
+		}
+		data, err := os.ReadFile(filepath.Join(outputDir, "config.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	data := generate()
+	var cfg struct {
+		Title        string `json:"title"`
+		Description  string `json:"description"`
+		AudioBaseURL string `json:"audioBaseUrl"`
+		Version      string `json:"version"`
+		BuildTime    string `json:"buildTime"`
+		Theme        struct {
+			PrimaryColor   string `json:"primaryColor"`
+			SecondaryColor string `json:"secondaryColor"`
+		} `json:"theme"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Title != "Arxiu d'En Guàrdia" || cfg.Description == "" || cfg.AudioBaseURL != "https://media.example.cat/audio" {
+		t.Errorf("Unexpected site settings %+v", cfg)
+	}
+	if cfg.Theme.PrimaryColor != "#004d40" || cfg.Theme.SecondaryColor != "#1976d2" {
+		t.Errorf("Expected the unset colours to keep their defaults, got %+v", cfg.Theme)
+	}
+	if cfg.BuildTime != "2023-11-14T22:13:20Z" || cfg.Version == "" || cfg.Version == "2.0.0" {
+		t.Errorf("Unexpected build %q at %q", cfg.Version, cfg.BuildTime)
+	}
+	if again := generate(); !bytes.Equal(again, data) {
+		t.Errorf("Two builds of the same data differ:\n%s\n%s", data, again)
+	}
+}
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of TestGenerateGolden")
+
+func TestGenerateGolden(t *testing.T) {
+	t.Setenv("ENGUARDIA_LOG_REPORT_DIR", t.TempDir())
+	t.Setenv("ENGUARDIA_GENERATOR_SITE_URL", "https://example.cat/arxiu/")
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+
+	// The fixtures are copied, generating must not depend on the data directory
+	dataDir := t.TempDir()
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "golden", "capitols", "*.json"))
+	if err != nil || len(fixtures) == 0 {
+		t.Fatalf("No fixtures: %v", err)
+	}
+	for _, fixture := range fixtures {
+		data, err := os.ReadFile(fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dataDir, filepath.Base(fixture)), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a, _, _ := newTestApp()
+	generate := func() string {
+		t.Helper()
+		outDir := t.TempDir()
+		tagsFile := filepath.Join(outDir, "tags.json")
+		if code := a.run([]string{"tags", "-dataDir=" + dataDir, "-tagsFile=" + tagsFile}); code != exitOK {
+			t.Fatalf("tags exited with %d", code)
+		}
+		t.Setenv("ENGUARDIA_GENERATOR_TAGS_FILE", tagsFile)
+		args := []string{"generate", "-dataDir=" + dataDir, "-lazy", "-output=" + filepath.Join(outDir, "data"), "-site=" + filepath.Join(outDir, "site")}
+		if code := a.run(args); code != exitOK {
+			t.Fatalf("generate exited with %d", code)
+		}
+		return outDir
+	}
+
+	first, second := generate(), generate()
+	files := []string{
+		"tags.json",
+		"data/episodes.json",
+		"data/stats.json",
+		"data/config.json",
+		"site/sitemap.xml",
+		"site/robots.txt",
+		"site/episodes/ep-2/index.html",
+	}
+	for _, name := range files {
+		got, err := os.ReadFile(filepath.Join(first, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again, err := os.ReadFile(filepath.Join(second, name)); err != nil || !bytes.Equal(again, got) {
+			t.Errorf("Two runs wrote different %s (%v)", name, err)
+		}
+		// The version follows the checkout, not the data
+		got = bytes.ReplaceAll(got, []byte(`"version": "`+generator.Version()+`"`), []byte(`"version": "dev"`))
+
+		golden := filepath.Join("testdata", "golden", "want", filepath.FromSlash(name))
+		if *updateGolden {
+			if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(golden, got, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("%v (run go test -run TestGenerateGolden -update to create it)", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s differs from %s:\n%s", name, golden, got)
+		}
+	}
+}
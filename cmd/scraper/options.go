@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/backend"
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/config"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+	"github.com/p4u/enguardia-arxiu/internal/generator"
+	"github.com/p4u/enguardia-arxiu/internal/hooks"
+	"github.com/p4u/enguardia-arxiu/internal/program"
+	"github.com/p4u/enguardia-arxiu/internal/storage"
+)
+
+// collectorOptions returns the collector options for a programme
+func collectorOptions(c *config.Config, p program.Program) collector.Options {
+	opts := collector.DefaultOptions()
+	opts.APIBaseURL = c.Collector.APIBaseURL
+	opts.SiteURL = c.Collector.SiteURL
+	opts.MediaBaseURL = c.Collector.MediaBaseURL
+	opts.Client = &http.Client{Timeout: time.Duration(c.Collector.HTTPTimeout)}
+	opts.Delay = time.Duration(c.Collector.RequestDelay)
+	opts.MaxFilename = c.Collector.MaxFilename
+	opts.Program = p
+	opts.AudioPreference = collector.AudioPreference{
+		Formats:  c.Collector.AudioFormats,
+		Bitrate:  c.Collector.AudioBitrate,
+		Smallest: c.Collector.AudioSmallest,
+	}
+	return opts
+}
+
+// storageOptions returns the storage options
+func storageOptions(c *config.Config) storage.Options {
+	opts := storage.Options{
+		DownloadTimeout: time.Duration(c.Storage.DownloadTimeout),
+		HTTPTimeout:     time.Duration(c.Collector.HTTPTimeout),
+		Limits: storage.Limits{
+			MinAudioFileSize: c.Storage.MinAudioFileSize,
+			MinImageFileSize: c.Storage.MinImageFileSize,
+			MinDownloadSize:  c.Storage.MinDownloadSize,
+		},
+		Layout: c.Storage.Layout,
+	}
+	// The filesystem backend is the data directory the storage is created with
+	if media := backend.New(c.DataDir, backendOptions(c, c.Program)); !backend.IsLocal(media) {
+		opts.Backend = media
+	}
+	return opts
+}
+
+// backendOptions returns the media backend options of a programme
+func backendOptions(c *config.Config, slug string) backend.Options {
+	b := c.Storage.Backend
+	opts := backend.Options{
+		Type:      b.Type,
+		Endpoint:  b.Endpoint,
+		Bucket:    b.Bucket,
+		Region:    b.Region,
+		Prefix:    path.Join(b.Prefix, slug),
+		AccessKey: b.AccessKey,
+		SecretKey: b.SecretKey,
+		Username:  b.Username,
+		Password:  b.Password,
+		Client:    &http.Client{Timeout: time.Duration(c.Storage.DownloadTimeout)},
+	}
+	if b.PublicURL != "" {
+		opts.PublicURL = strings.TrimSuffix(b.PublicURL, "/") + "/" + slug
+	}
+	return opts
+}
+
+// checkStorage validates the media layout and backend
+func checkStorage(c *config.Config) error {
+	if err := storage.CheckLayout(c.Storage.Layout); err != nil {
+		return err
+	}
+	opts := backendOptions(c, c.Program)
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if c.Storage.Layout == storage.LayoutObjects && !backend.IsLocal(backend.New(c.DataDir, opts)) {
+		return fmt.Errorf("the %s layout needs the %s backend", storage.LayoutObjects, backend.TypeFilesystem)
+	}
+	return nil
+}
+
+// hooksOptions returns the new episode hook options for a programme, failed
+// deliveries are kept in the data directory
+func hooksOptions(c *config.Config, p program.Program) hooks.Options {
+	return hooks.Options{
+		Webhooks:       c.Hooks.Webhooks,
+		Commands:       c.Hooks.Commands,
+		Retries:        c.Hooks.Retries,
+		RetryDelay:     time.Duration(c.Hooks.RetryDelay),
+		Timeout:        time.Duration(c.Hooks.Timeout),
+		DeadLetterFile: filepath.Join(c.DataDir, constants.HookDeadLetterFile),
+		Program:        p.Slug,
+	}
+}
+
+// generatorOptions returns the generator options for a programme
+func generatorOptions(c *config.Config, p program.Program) generator.Options {
+	return generator.Options{
+		Program:          p,
+		TagsFile:         c.Generator.TagsFile,
+		ThumbnailWidth:   c.Generator.ThumbnailWidth,
+		ThumbnailQuality: c.Generator.ThumbnailQuality,
+		RemoteThumbnails: c.Generator.RemoteThumbnails,
+		MinAudioFileSize: c.Storage.MinAudioFileSize,
+		Catalog:          c.Storage.Catalog,
+		ProbeAudio:       c.Generator.ProbeAudio,
+		ProbeConcurrency: c.Generator.ProbeConcurrency,
+		ProbeInterval:    time.Duration(c.Generator.ProbeInterval),
+		ProbeTTL:         time.Duration(c.Generator.ProbeTTL),
+		HTTPClient:       &http.Client{Timeout: time.Duration(c.Collector.HTTPTimeout)},
+		SiteDir:          c.Generator.SiteDir,
+		SiteURL:          c.Generator.SiteURL,
+		Title:            c.Generator.SiteTitle,
+		Description:      c.Generator.SiteDescription,
+		Language:         c.Generator.SiteLanguage,
+		AudioBaseURL:     c.Generator.AudioBaseURL,
+		Backend: func(dataDir string, p program.Program) backend.Backend {
+			return backend.New(dataDir, backendOptions(c, p.Slug))
+		},
+		Theme: generator.Theme{
+			PrimaryColor:   c.Generator.Theme.PrimaryColor,
+			SecondaryColor: c.Generator.Theme.SecondaryColor,
+			AccentColor:    c.Generator.Theme.AccentColor,
+			BackgroundURL:  c.Generator.Theme.BackgroundURL,
+		},
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/report"
+	"github.com/p4u/enguardia-arxiu/internal/storage"
+)
+
+func (a *app) reconcile(args []string) int {
+	fs := a.newFlagSet()
+	common := a.addCommonFlags(fs)
+	dryRun := dryRunFlag(fs)
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+
+	cfg, prog, err := common.loadProgram()
+	if err != nil {
+		return fail("Invalid configuration", "error", err)
+	}
+	rep := a.startReport(cfg, common, *dryRun)
+
+	storageOpts := storageOptions(cfg)
+	storageOpts.Report = rep
+	st, err := newStorage(cfg.DataDir, storageOpts, *dryRun)
+	if err != nil {
+		return fail("Failed to prepare data directory", "error", err)
+	}
+	unlock, err := a.lockDataDir(st)
+	if err != nil {
+		return fail("Failed to lock data directory", "error", err)
+	}
+	defer unlock()
+	collectorOpts := collectorOptions(cfg, prog)
+	collectorOpts.Report = rep
+	c := collector.NewCollectorWithOptions(collectorOpts)
+
+	// Only a complete listing tells which episodes were removed
+	listed, err := c.ScrapeEpisodes(a.ctx)
+	if err != nil {
+		return fail("Failed to fetch the full listing", "error", err)
+	}
+	if len(listed) == 0 {
+		return fail("The listing is empty, refusing to treat every episode as removed")
+	}
+	failed, err := reconcileEpisodes(a.ctx, st, rep, listed, a.stdout)
+	if err != nil {
+		return fail("Failed to reconcile episodes", "error", err)
+	}
+	return resultCode(failed)
+}
+
+// reconcileEpisodes sets the upstream status of every stored episode from the
+// full listing. Episodes missing from it are probed: while 3Cat still serves
+// their audio they stay upstream, otherwise they are local-only when the audio
+// is archived and lost when it isn't. Probe failures leave the status as it
+// was and are counted.
+func reconcileEpisodes(ctx context.Context, st *storage.Storage, rep *report.Report, listed []collector.Episode, out io.Writer) (int, error) {
+	upstream := make(map[string]bool, len(listed))
+	for _, ep := range listed {
+		upstream[episodeKey(ep)] = true
+	}
+
+	episodes, err := st.LoadEpisodes()
+	if err != nil {
+		return 0, err
+	}
+
+	counts := make(map[string]int)
+	failed := 0
+	for _, episode := range episodes {
+		if err := ctx.Err(); err != nil {
+			return failed, fmt.Errorf("reconciliation interrupted: %w", err)
+		}
+
+		status := collector.StatusUpstream
+		if !upstream[episodeKey(episode)] {
+			served, err := st.ProbeAudio(ctx, episode)
+			switch {
+			case err != nil:
+				slog.Warn("Failed to probe removed episode", "episode", episode.Title, "error", err)
+				rep.Fail(episode.Title, "probe", err)
+				failed++
+				counts[episode.Status]++
+				continue
+			case served:
+				slog.Info("Episode removed from the listing but its audio is still served", "episode", episode.Title)
+			case st.HasAudio(episode):
+				status = collector.StatusLocalOnly
+			default:
+				status = collector.StatusLost
+			}
+		}
+		counts[status]++
+
+		if status != collector.StatusUpstream {
+			fmt.Fprintf(out, "%-10s  %s\n", status, episode.Title)
+		}
+		if status == episode.Status {
+			continue
+		}
+		slog.Info("Episode status changed", "episode", episode.Title, "old", episode.Status, "new", status)
+		episode.Status = status
+		if err := st.UpdateEpisode(episode); err != nil {
+			slog.Error("Failed to update episode metadata", "episode", episode.Title, "error", err)
+			rep.Fail(episode.Title, "metadata", err)
+			failed++
+		}
+	}
+
+	slog.Info("Reconciliation completed", "episodes", len(episodes), "listed", len(listed),
+		"upstream", counts[collector.StatusUpstream], "local_only", counts[collector.StatusLocalOnly],
+		"lost", counts[collector.StatusLost], "failed", failed)
+	return failed, nil
+}
+
+// episodeKey identifies an episode across scrapes by its 3Cat item ID, which
+// survives retitling, falling back to its JSON file
+func episodeKey(ep collector.Episode) string {
+	if id := ep.ItemID(); id != "" {
+		return id
+	}
+	return ep.JSONFile
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/p4u/enguardia-arxiu/internal/fake3cat"
+	"github.com/p4u/enguardia-arxiu/internal/storage"
+)
+
+func TestReconcile(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	setFakeEnv(t, srv)
+
+	dataDir := t.TempDir()
+	a, _, _ := newTestApp()
+	if code := a.run([]string{"scrape", "-dataDir=" + dataDir, "-lazy"}); code != exitOK {
+		t.Fatalf("scrape exited with %d", code)
+	}
+	if code := a.run([]string{"download", "-dataDir=" + dataDir, "-from=1245"}); code != exitOK {
+		t.Fatalf("download exited with %d", code)
+	}
+
+	// 1245 is archived, 1244 was never downloaded, 1241 is delisted but still served
+	for _, id := range []int{1001, 1002, 1005} {
+		srv.RemoveItem(id)
+	}
+	for _, media := range []string{"mp3/1/0/1001.mp3", "mp3/1/0/1002_64k.mp3", "mp3/1/0/1002_128k.mp3"} {
+		srv.FailMedia(media, http.StatusNotFound)
+	}
+
+	a, stdout, _ := newTestApp()
+	if code := a.run([]string{"reconcile", "-dataDir=" + dataDir}); code != exitOK {
+		t.Fatalf("reconcile exited with %d", code)
+	}
+	for _, want := range []string{"local-only  1245 - La batalla de l'Ebre", "lost        1244 - Els almogàvers"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("Expected reconcile to report %q, got:\n%s", want, stdout.String())
+		}
+	}
+
+	episodes, err := storage.NewStorage(dataDir).LoadEpisodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := make(map[int]string)
+	for _, ep := range episodes {
+		statuses[ep.Number()] = ep.Status
+	}
+	want := map[int]string{1245: "local-only", 1244: "lost", 1243: "upstream", 1242: "upstream", 1241: "upstream"}
+	for number, status := range want {
+		if statuses[number] != status {
+			t.Errorf("Episode %d status = %q, want %q", number, statuses[number], status)
+		}
+	}
+
+	outputDir := filepath.Join(t.TempDir(), "data")
+	if code := a.run([]string{"generate", "-dataDir=" + dataDir, "-output=" + outputDir, "-lazy"}); code != exitOK {
+		t.Fatalf("generate exited with %d", code)
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "episodes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var generated struct {
+		Episodes []struct {
+			Title     string `json:"title"`
+			Available bool   `json:"available"`
+			Status    string `json:"status"`
+		} `json:"episodes"`
+		Stats struct {
+			AvailableCount int `json:"availableCount"`
+			LocalOnlyCount int `json:"localOnlyCount"`
+			LostCount      int `json:"lostCount"`
+		} `json:"stats"`
+	}
+	if err := json.Unmarshal(data, &generated); err != nil {
+		t.Fatal(err)
+	}
+	for _, ep := range generated.Episodes {
+		if ep.Available == (ep.Status == "local-only" || ep.Status == "lost") {
+			t.Errorf("Lazy episode %q with status %q has available = %v", ep.Title, ep.Status, ep.Available)
+		}
+	}
+	if s := generated.Stats; s.LocalOnlyCount != 1 || s.LostCount != 1 || s.AvailableCount != 3 {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+}
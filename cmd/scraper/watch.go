@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/config"
+	"github.com/p4u/enguardia-arxiu/internal/generator"
+	"github.com/p4u/enguardia-arxiu/internal/metrics"
+	"github.com/p4u/enguardia-arxiu/internal/program"
+	"github.com/p4u/enguardia-arxiu/internal/storage"
+)
+
+func (a *app) watch(args []string) int {
+	fs := a.newFlagSet()
+	common := a.addCommonFlags(fs)
+	audio := addAudioFlags(fs)
+	metricsAddr := addMetricsFlag(fs)
+	interval := fs.Duration("interval", time.Duration(config.Default().Watch.Interval), "pause between scrape cycles (default from the configuration)")
+	jitter := fs.Duration("jitter", time.Duration(config.Default().Watch.Jitter), "maximum random delay added to the interval (default from the configuration)")
+	outputDir := fs.String("output", "data", "output directory for webapp JSON files")
+	lazy := fs.Bool("lazy", false, "only save metadata and link the remote audio and images from the webapp data")
+	once := fs.Bool("once", false, "run a single cycle and exit with its result")
+	if code, ok := parse(fs, args); !ok {
+		return code
+	}
+
+	cfg, prog, err := common.loadProgram()
+	if err != nil {
+		return fail("Invalid configuration", "error", err)
+	}
+	audio.apply(cfg)
+	metricsAddr.apply(cfg)
+	if isSet(fs, "interval") {
+		cfg.Watch.Interval = config.Duration(*interval)
+	}
+	if isSet(fs, "jitter") {
+		cfg.Watch.Jitter = config.Duration(*jitter)
+	}
+	if isSet(fs, "output") {
+		cfg.OutputDir = *outputDir
+	}
+	if cfg.Watch.Interval <= 0 || cfg.Watch.Jitter < 0 {
+		fmt.Fprintf(a.stderr, "Invalid watch interval %s or jitter %s\n", time.Duration(cfg.Watch.Interval), time.Duration(cfg.Watch.Jitter))
+		return exitUsage
+	}
+
+	st, err := newStorage(cfg.DataDir, storageOptions(cfg), false)
+	if err != nil {
+		return fail("Failed to prepare data directory", "error", err)
+	}
+	// Held for the whole process so two instances never work on the same directory
+	unlock, err := a.lockDataDir(st)
+	if err != nil {
+		return fail("Failed to lock data directory", "error", err)
+	}
+	defer unlock()
+
+	m, err := a.startMetrics(cfg)
+	if err != nil {
+		return fail("Failed to start metrics", "error", err)
+	}
+
+	slog.Info("Watching for new episodes", "program", prog.Slug, "data_dir", cfg.DataDir,
+		"interval", time.Duration(cfg.Watch.Interval).String(), "jitter", time.Duration(cfg.Watch.Jitter).String())
+
+	for {
+		a.startReport(cfg, common, false)
+		code := a.watchCycle(cfg, prog, m, *lazy)
+		a.writeReport(code)
+		a.report = nil
+
+		if *once {
+			return code
+		}
+		if a.ctx.Err() != nil {
+			slog.Info("Watch stopped")
+			return exitOK
+		}
+
+		delay := nextDelay(time.Duration(cfg.Watch.Interval), time.Duration(cfg.Watch.Jitter))
+		slog.Info("Waiting for the next cycle", "delay", delay.Round(time.Second).String(), "next", time.Now().Add(delay).Format(time.RFC3339))
+		select {
+		case <-a.ctx.Done():
+			slog.Info("Watch stopped")
+			return exitOK
+		case <-time.After(delay):
+		}
+	}
+}
+
+// watchCycle runs an incremental scrape, repairs the episodes due, downloads
+// the new media and regenerates the webapp data
+func (a *app) watchCycle(cfg *config.Config, prog program.Program, m *metrics.Metrics, lazy bool) int {
+	storageOpts := storageOptions(cfg)
+	storageOpts.Report = a.report
+	storageOpts.Metrics = m
+	st := storage.NewStorageWithOptions(cfg.DataDir, storageOpts)
+
+	collectorOpts := collectorOptions(cfg, prog)
+	collectorOpts.Report = a.report
+	collectorOpts.Metrics = m
+	c := collector.NewCollectorWithOptions(collectorOpts)
+
+	failed, err := saveEpisodes(a.ctx, st, a.report, newHooks(cfg, prog, false, a.report, m), lazy, func() ([]collector.Episode, error) {
+		return c.ScrapeNewEpisodes(a.ctx, st.HasEpisode)
+	})
+	if a.ctx.Err() != nil {
+		return exitInterrupted
+	}
+	if err != nil {
+		return fail("Failed to scrape new episodes", "error", err)
+	}
+
+	repairFailed, err := repairEpisodes(a.ctx, c, st, a.report, lazy)
+	if a.ctx.Err() != nil {
+		return exitInterrupted
+	}
+	if err != nil {
+		return fail("Failed to repair episodes", "error", err)
+	}
+
+	endGenerate := a.report.Phase("generate")
+	gen := generator.NewGeneratorWithOptions(cfg.DataDir, generatorOptions(cfg, prog))
+	err = gen.GenerateWebappData(a.ctx, cfg.OutputDir, lazy)
+	endGenerate()
+	if err != nil {
+		return fail("Failed to generate webapp data", "error", err)
+	}
+
+	return resultCode(failed + repairFailed)
+}
+
+// nextDelay returns the interval plus a random delay of up to jitter, so
+// several deployments don't hit the API at the same time
+func nextDelay(interval, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+	return interval + time.Duration(rand.Int63n(int64(jitter)+1))
+}
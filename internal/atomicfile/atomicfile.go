@@ -0,0 +1,319 @@
+// Package atomicfile writes files and directories so readers and crashes never
+// see them half written: content goes to a temporary file in the same
+// directory, is synced to disk and then renamed over the final path.
+package atomicfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+)
+
+// WriteFile atomically replaces path with data
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	return Write(path, perm, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// Write atomically replaces path with the content written by write. When
+// write fails the temporary file is removed and path is left untouched.
+func Write(path string, perm os.FileMode, write func(w io.Writer) error) (err error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	file, err := os.CreateTemp(dir, "."+base+".*"+constants.TempSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tempPath := file.Name()
+	defer func() {
+		if err == nil {
+			return
+		}
+		_ = file.Close()
+		if removeErr := os.Remove(tempPath); removeErr != nil && !os.IsNotExist(removeErr) {
+			slog.Warn("Failed to remove temp file", "file", tempPath, "error", removeErr)
+		}
+	}()
+
+	if err := write(file); err != nil {
+		return err
+	}
+	if err := file.Chmod(perm); err != nil {
+		return fmt.Errorf("failed to set permissions of temp file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+	syncDir(dir)
+	return nil
+}
+
+// ReplaceDir atomically replaces dir with the result of build. build receives
+// a staging directory next to dir that already holds hard links to the
+// current files, so unchanged files can be kept; files must be replaced with
+// Write rather than modified in place. On success the staging directory takes
+// the place of dir, otherwise dir is left untouched.
+func ReplaceDir(dir string, build func(staging string) error) error {
+	return ReplaceDirs([]string{dir}, func(staging []string) error {
+		return build(staging[0])
+	})
+}
+
+// ReplaceDirs replaces several directories with the result of a single build,
+// so they are published together. build receives a staging directory per
+// directory, in the same order, and nothing is replaced unless it succeeds. A
+// directory inside another one is staged within the staging copy of the outer
+// one and changes in the same swap; separate directories are swapped one
+// after the other once all of them are built.
+func ReplaceDirs(dirs []string, build func(staging []string) error) (err error) {
+	resolved := make([]string, len(dirs))
+	for i, dir := range dirs {
+		if resolved[i], err = resolveDir(dir); err != nil {
+			return err
+		}
+	}
+
+	// Only the outermost directories are staged and swapped
+	var outer []string
+	for _, dir := range resolved {
+		nested := slices.ContainsFunc(resolved, func(other string) bool { return within(dir, other) })
+		if !nested && !slices.Contains(outer, dir) {
+			outer = append(outer, dir)
+		}
+	}
+
+	stagings := make(map[string]string, len(outer))
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, staging := range stagings {
+			if removeErr := os.RemoveAll(staging); removeErr != nil {
+				slog.Warn("Failed to remove staging directory", "dir", staging, "error", removeErr)
+			}
+		}
+	}()
+	for _, dir := range outer {
+		staging, err := stageDir(dir)
+		if err != nil {
+			return err
+		}
+		stagings[dir] = staging
+	}
+
+	staged := make([]string, len(resolved))
+	for i, dir := range resolved {
+		for _, o := range outer {
+			if dir == o || within(dir, o) {
+				rel, _ := filepath.Rel(o, dir)
+				staged[i] = filepath.Join(stagings[o], rel)
+				break
+			}
+		}
+		if err := os.MkdirAll(staged[i], constants.DirPermissions); err != nil {
+			return fmt.Errorf("failed to create staging directory: %w", err)
+		}
+	}
+
+	if err := build(staged); err != nil {
+		return err
+	}
+
+	for _, dir := range outer {
+		if err := swapDir(stagings[dir], dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveDir returns the absolute path of dir. The target of a symlinked
+// directory is replaced, keeping the link.
+func resolveDir(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	return dir, nil
+}
+
+// within reports whether dir is a subdirectory of parent
+func within(dir, parent string) bool {
+	rel, err := filepath.Rel(parent, dir)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// stageDir creates the staging directory of dir, holding hard links to its files
+func stageDir(dir string) (string, error) {
+	parent, base := filepath.Split(dir)
+	if err := os.MkdirAll(parent, constants.DirPermissions); err != nil {
+		return "", fmt.Errorf("failed to create parent directory: %w", err)
+	}
+	restoreAside(dir)
+
+	staging, err := os.MkdirTemp(parent, "."+base+".*"+constants.TempSuffix)
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	if err := os.Chmod(staging, constants.DirPermissions); err != nil {
+		_ = os.RemoveAll(staging)
+		return "", fmt.Errorf("failed to set permissions of staging directory: %w", err)
+	}
+	if err := linkTree(dir, staging); err != nil {
+		_ = os.RemoveAll(staging)
+		return "", fmt.Errorf("failed to prepare staging directory: %w", err)
+	}
+	return staging, nil
+}
+
+// swapDir puts staging in the place of dir. Where the platform can exchange
+// two directories atomically dir always exists; elsewhere the current one is
+// moved aside first, and restored by the next swap if a crash leaves no dir.
+func swapDir(staging, dir string) error {
+	if _, err := os.Stat(dir); err == nil {
+		err := exchange(staging, dir)
+		if err == nil {
+			syncDir(filepath.Dir(dir))
+			// The staging path now holds the previous directory
+			if err := os.RemoveAll(staging); err != nil {
+				slog.Warn("Failed to remove previous directory", "dir", staging, "error", err)
+			}
+			return nil
+		}
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return fmt.Errorf("failed to exchange directories: %w", err)
+		}
+		slog.Debug("Atomic directory exchange not supported, moving aside", "dir", dir, "error", err)
+	}
+
+	old := ""
+	if _, err := os.Stat(dir); err == nil {
+		old = staging + asideSuffix
+		if err := os.Rename(dir, old); err != nil {
+			return fmt.Errorf("failed to move previous directory aside: %w", err)
+		}
+	}
+
+	if err := os.Rename(staging, dir); err != nil {
+		if old != "" {
+			if restoreErr := os.Rename(old, dir); restoreErr != nil {
+				slog.Error("Failed to restore previous directory", "dir", dir, "from", old, "error", restoreErr)
+			}
+		}
+		return fmt.Errorf("failed to rename staging directory: %w", err)
+	}
+	syncDir(filepath.Dir(dir))
+
+	if old != "" {
+		if err := os.RemoveAll(old); err != nil {
+			slog.Warn("Failed to remove previous directory", "dir", old, "error", err)
+		}
+	}
+	return nil
+}
+
+// asideSuffix marks a previous directory moved aside during a swap
+const asideSuffix = ".old"
+
+// restoreAside puts back the previous directory when a swap that moved it
+// aside did not complete
+func restoreAside(dir string) {
+	if _, err := os.Lstat(dir); !os.IsNotExist(err) {
+		return
+	}
+	parent, base := filepath.Split(dir)
+	matches, err := filepath.Glob(filepath.Join(parent, "."+base+".*"+constants.TempSuffix+asideSuffix))
+	if err != nil || len(matches) == 0 {
+		return
+	}
+	if err := os.Rename(matches[0], dir); err != nil {
+		slog.Warn("Failed to restore previous directory", "dir", dir, "from", matches[0], "error", err)
+		return
+	}
+	slog.Warn("Restored the previous directory of an interrupted swap", "dir", dir, "from", matches[0])
+}
+
+// linkTree recreates the tree under src in dst with hard links to its files,
+// copying them when links are not supported
+func linkTree(src, dst string) error {
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil // Nothing generated yet
+	}
+	return filepath.WalkDir(src, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		// Leftovers of interrupted writes
+		if strings.HasSuffix(d.Name(), constants.TempSuffix) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, constants.DirPermissions)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if err := os.Link(path, target); err == nil {
+			return nil
+		}
+		return copyFile(path, target)
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	return Write(dst, info.Mode().Perm(), func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
+
+// syncDir flushes a directory entry change to disk. Not every platform
+// supports it, so failures are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
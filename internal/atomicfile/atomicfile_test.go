@@ -0,0 +1,224 @@
+package atomicfile
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// leftovers returns the entries of dir other than the expected ones
+func leftovers(t *testing.T, dir string, expected ...string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := make(map[string]bool)
+	for _, name := range expected {
+		want[name] = true
+	}
+	var extra []string
+	for _, entry := range entries {
+		if !want[entry.Name()] {
+			extra = append(extra, entry.Name())
+		}
+	}
+	return extra
+}
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "episodes.json")
+
+	if err := WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v (%v)", info.Mode(), err)
+	}
+
+	// A failed write leaves the previous content and no temporary file
+	failure := errors.New("disk full")
+	err := Write(path, 0644, func(w io.Writer) error {
+		if _, err := w.Write([]byte("half")); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("Expected the write error, got %v", err)
+	}
+	if got := readFile(t, path); got != "old" {
+		t.Errorf("Content = %q, want the previous content", got)
+	}
+	if extra := leftovers(t, dir, "episodes.json"); len(extra) != 0 {
+		t.Errorf("Unexpected files left: %v", extra)
+	}
+
+	if err := WriteFile(path, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != "new" {
+		t.Errorf("Content = %q, want new", got)
+	}
+}
+
+func TestReplaceDir(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "data")
+
+	build := func(files map[string]string) func(string) error {
+		return func(staging string) error {
+			for name, content := range files {
+				path := filepath.Join(staging, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					return err
+				}
+				if err := WriteFile(path, []byte(content), 0644); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	if err := ReplaceDir(dir, build(map[string]string{"episodes.json": "v1", "thumbnails/a.jpg": "thumb"})); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files not rewritten are carried over, rewritten ones replaced
+	if err := ReplaceDir(dir, build(map[string]string{"episodes.json": "v2"})); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "episodes.json")); got != "v2" {
+		t.Errorf("episodes.json = %q, want v2", got)
+	}
+	if got := readFile(t, filepath.Join(dir, "thumbnails", "a.jpg")); got != "thumb" {
+		t.Errorf("thumbnails/a.jpg = %q, want it kept", got)
+	}
+
+	// A failed build leaves the directory as it was
+	var staged string
+	err := ReplaceDir(dir, func(staging string) error {
+		staged = staging
+		if err := build(map[string]string{"episodes.json": "v3"})(staging); err != nil {
+			return err
+		}
+		return errors.New("generation failed")
+	})
+	if err == nil {
+		t.Fatal("Expected the build error")
+	}
+	if got := readFile(t, filepath.Join(dir, "episodes.json")); got != "v2" {
+		t.Errorf("episodes.json = %q, want v2 after a failed build", got)
+	}
+	if _, err := os.Stat(staged); !os.IsNotExist(err) {
+		t.Errorf("Expected the staging directory to be removed, got %v", err)
+	}
+	if extra := leftovers(t, root, "data"); len(extra) != 0 {
+		t.Errorf("Unexpected entries left: %v", extra)
+	}
+}
+
+func TestReplaceDirSymlink(t *testing.T) {
+	root := t.TempDir()
+	target := filepath.Join(root, "build")
+	link := filepath.Join(root, "public")
+	if err := os.Mkdir(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	err := ReplaceDir(link, func(staging string) error {
+		return WriteFile(filepath.Join(staging, "config.json"), []byte("{}"), 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Expected the symlink to be kept (%v)", err)
+	}
+	if got := readFile(t, filepath.Join(target, "config.json")); got != "{}" {
+		t.Errorf("config.json = %q", got)
+	}
+}
+
+func TestReplaceDirs(t *testing.T) {
+	root := t.TempDir()
+	site := filepath.Join(root, "public")
+	data := filepath.Join(site, "data")
+	pages := filepath.Join(root, "pages")
+
+	publish := func(version string, fail bool) error {
+		return ReplaceDirs([]string{data, site, pages}, func(staging []string) error {
+			for i, name := range []string{"episodes.json", "sitemap.xml", "index.html"} {
+				if err := WriteFile(filepath.Join(staging[i], name), []byte(version), 0644); err != nil {
+					return err
+				}
+			}
+			if fail {
+				return errors.New("generation failed")
+			}
+			return nil
+		})
+	}
+
+	if err := publish("v1", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := publish("v2", true); err == nil {
+		t.Fatal("Expected the build error")
+	}
+
+	// The data inside the site changes with it, nothing of a failed build is published
+	for _, path := range []string{filepath.Join(data, "episodes.json"), filepath.Join(site, "sitemap.xml"), filepath.Join(pages, "index.html")} {
+		if got := readFile(t, path); got != "v1" {
+			t.Errorf("%s = %q, want v1", path, got)
+		}
+	}
+	if extra := leftovers(t, root, "public", "pages"); len(extra) != 0 {
+		t.Errorf("Unexpected entries left: %v", extra)
+	}
+}
+
+func TestReplaceDirRestoresAside(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "data")
+
+	// A crash between the two renames of a swap leaves only the previous directory
+	aside := filepath.Join(root, ".data.123"+constants.TempSuffix+asideSuffix)
+	if err := os.Mkdir(aside, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(filepath.Join(aside, "stats.json"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := ReplaceDir(dir, func(staging string) error {
+		return WriteFile(filepath.Join(staging, "episodes.json"), []byte("new"), 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "stats.json")); got != "old" {
+		t.Errorf("stats.json = %q, want the restored file", got)
+	}
+	if extra := leftovers(t, root, "data"); len(extra) != 0 {
+		t.Errorf("Unexpected entries left: %v", extra)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package atomicfile
+
+import "errors"
+
+// exchange atomically swaps two directories, which needs renameat2 on Linux
+func exchange(a, b string) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,160 @@
+// Package backend stores the downloaded media on the local filesystem or on
+// remote storage: an S3-compatible bucket or a WebDAV collection.
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// Backend types
+const (
+	TypeFilesystem = "filesystem" // Files in the data directory
+	TypeS3         = "s3"         // Objects in an S3-compatible bucket
+	TypeWebDAV     = "webdav"     // Files in a WebDAV collection
+)
+
+// ErrNotExist is returned, wrapped, for files missing from a backend
+var ErrNotExist = fs.ErrNotExist
+
+// Info describes a stored file
+type Info struct {
+	Name    string // File name relative to the backend root
+	Size    int64
+	ModTime time.Time
+}
+
+// Backend stores media files by name. Names are slash-separated and relative
+// to the backend root; List only returns the files directly under the root.
+type Backend interface {
+	// Put streams r into name, replacing it only once the whole content has
+	// been stored. size is the content length, or -1 when unknown.
+	Put(ctx context.Context, name string, r io.Reader, size int64) (int64, error)
+	// Get opens name for reading, the caller closes it
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// Stat describes name, returning an error wrapping ErrNotExist when missing
+	Stat(ctx context.Context, name string) (Info, error)
+	// List returns the files whose name starts with prefix
+	List(ctx context.Context, prefix string) ([]Info, error)
+	// Delete removes name, missing files are not an error
+	Delete(ctx context.Context, name string) error
+	// URL returns the public URL of name, empty when the media is published
+	// with the data directory
+	URL(name string) string
+}
+
+// Options configures a backend
+type Options struct {
+	Type      string       // TypeFilesystem, TypeS3 or TypeWebDAV (empty = filesystem)
+	Endpoint  string       // S3 endpoint or WebDAV collection URL
+	Bucket    string       // S3 bucket
+	Region    string       // S3 region (empty = us-east-1)
+	Prefix    string       // Path of the files inside the bucket or collection
+	AccessKey string       // S3 access key
+	SecretKey string       // S3 secret key
+	Username  string       // WebDAV user
+	Password  string       // WebDAV password
+	PublicURL string       // Base URL the webapp uses for the media (empty = endpoint)
+	Client    *http.Client // HTTP client of remote backends (nil = default client)
+}
+
+// Validate reports missing or invalid options
+func (o Options) Validate() error {
+	switch o.Type {
+	case "", TypeFilesystem:
+		return nil
+	case TypeS3:
+		if o.Endpoint == "" || o.Bucket == "" {
+			return fmt.Errorf("the s3 backend needs an endpoint and a bucket")
+		}
+		if o.AccessKey == "" || o.SecretKey == "" {
+			return fmt.Errorf("the s3 backend needs an access key and a secret key")
+		}
+	case TypeWebDAV:
+		if o.Endpoint == "" {
+			return fmt.Errorf("the webdav backend needs an endpoint")
+		}
+	default:
+		return fmt.Errorf("invalid storage backend %q (use %s, %s or %s)", o.Type, TypeFilesystem, TypeS3, TypeWebDAV)
+	}
+	if !strings.HasPrefix(o.Endpoint, "http://") && !strings.HasPrefix(o.Endpoint, "https://") {
+		return fmt.Errorf("invalid %s endpoint %q", o.Type, o.Endpoint)
+	}
+	return nil
+}
+
+// New creates the backend of a data directory. Options are expected to be
+// valid, see Validate; unknown types fall back to the filesystem.
+func New(dataDir string, opts Options) Backend {
+	if opts.Client == nil {
+		opts.Client = &http.Client{}
+	}
+	switch opts.Type {
+	case TypeS3:
+		return newS3(opts)
+	case TypeWebDAV:
+		return newWebDAV(opts)
+	default:
+		return NewFilesystem(dataDir)
+	}
+}
+
+// IsLocal reports whether b keeps the files in the local data directory
+func IsLocal(b Backend) bool {
+	_, ok := b.(*Filesystem)
+	return ok
+}
+
+// checkName rejects names escaping the backend root
+func checkName(name string) error {
+	if name == "" || strings.HasPrefix(name, "/") || path.Clean(name) != name || name == ".." || strings.HasPrefix(name, "../") {
+		return fmt.Errorf("invalid file name %q", name)
+	}
+	return nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// escapePath percent-encodes every segment of a slash-separated path
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// joinURL appends an escaped path to a base URL
+func joinURL(base, p string) string {
+	return strings.TrimSuffix(base, "/") + "/" + escapePath(p)
+}
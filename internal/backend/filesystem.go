@@ -0,0 +1,119 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/p4u/enguardia-arxiu/internal/atomicfile"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+)
+
+// Filesystem stores the files in a local directory
+type Filesystem struct {
+	root string
+}
+
+// NewFilesystem creates a backend rooted at dir
+func NewFilesystem(dir string) *Filesystem {
+	return &Filesystem{root: dir}
+}
+
+// Path returns the local path of name
+func (f *Filesystem) Path(name string) (string, error) {
+	if err := checkName(name); err != nil {
+		return "", err
+	}
+	return filepath.Join(f.root, filepath.FromSlash(name)), nil
+}
+
+// Put implements Backend, writing through a temporary file
+func (f *Filesystem) Put(ctx context.Context, name string, r io.Reader, size int64) (int64, error) {
+	path, err := f.Path(name)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), constants.DirPermissions); err != nil {
+		return 0, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	counter := &countingReader{r: r}
+	err = atomicfile.Write(path, constants.FilePermissions, func(w io.Writer) error {
+		_, err := io.Copy(w, counter)
+		return err
+	})
+	return counter.n, err
+}
+
+// Get implements Backend
+func (f *Filesystem) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	path, err := f.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// Stat implements Backend
+func (f *Filesystem) Stat(ctx context.Context, name string) (Info, error) {
+	path, err := f.Path(name)
+	if err != nil {
+		return Info{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return Info{}, err
+	}
+	if info.IsDir() {
+		return Info{}, fmt.Errorf("%s is a directory: %w", name, ErrNotExist)
+	}
+	return Info{Name: name, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// List implements Backend, a missing root holds no files
+func (f *Filesystem) List(ctx context.Context, prefix string) ([]Info, error) {
+	entries, err := os.ReadDir(f.root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", f.root, err)
+	}
+
+	var files []Info
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // Removed meanwhile
+		}
+		files = append(files, Info{Name: entry.Name(), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// Delete implements Backend
+func (f *Filesystem) Delete(ctx context.Context, name string) error {
+	path, err := f.Path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// URL implements Backend, local media is published with the data directory
+func (f *Filesystem) URL(name string) string {
+	return ""
+}
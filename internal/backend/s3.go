@@ -0,0 +1,343 @@
+package backend
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/metrics"
+)
+
+// unsignedPayload lets uploads be streamed without hashing them first
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3 stores the files as objects of an S3-compatible bucket, addressed with
+// path-style URLs and signed with AWS Signature Version 4
+type S3 struct {
+	opts Options
+	now  func() time.Time
+}
+
+func newS3(opts Options) *S3 {
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	opts.Endpoint = strings.TrimSuffix(opts.Endpoint, "/")
+	opts.Prefix = strings.Trim(opts.Prefix, "/")
+	return &S3{opts: opts, now: time.Now}
+}
+
+// key returns the object key of name
+func (s *S3) key(name string) string {
+	if s.opts.Prefix == "" {
+		return name
+	}
+	return s.opts.Prefix + "/" + name
+}
+
+// Put implements Backend. S3 needs the content length up front, content of
+// unknown size is spooled to a temporary file first.
+func (s *S3) Put(ctx context.Context, name string, r io.Reader, size int64) (int64, error) {
+	if err := checkName(name); err != nil {
+		return 0, err
+	}
+	if size < 0 {
+		spool, err := os.CreateTemp("", "enguardia-upload-*")
+		if err != nil {
+			return 0, fmt.Errorf("failed to create upload spool: %w", err)
+		}
+		defer func() {
+			_ = spool.Close()
+			_ = os.Remove(spool.Name())
+		}()
+		if size, err = io.Copy(spool, r); err != nil {
+			return 0, err
+		}
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			return 0, fmt.Errorf("failed to rewind upload spool: %w", err)
+		}
+		r = spool
+	}
+
+	counter := &countingReader{r: r}
+	resp, err := s.do(ctx, http.MethodPut, s.key(name), nil, counter, size)
+	if err != nil {
+		return counter.n, err
+	}
+	defer closeBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		return counter.n, statusError(resp, name)
+	}
+	return counter.n, nil
+}
+
+// Get implements Backend
+func (s *S3) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, s.key(name), nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer closeBody(resp)
+		return nil, statusError(resp, name)
+	}
+	return resp.Body, nil
+}
+
+// Stat implements Backend
+func (s *S3) Stat(ctx context.Context, name string) (Info, error) {
+	if err := checkName(name); err != nil {
+		return Info{}, err
+	}
+	resp, err := s.do(ctx, http.MethodHead, s.key(name), nil, nil, 0)
+	if err != nil {
+		return Info{}, err
+	}
+	defer closeBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		return Info{}, statusError(resp, name)
+	}
+	return headerInfo(name, resp), nil
+}
+
+// listResult is the ListObjectsV2 response
+type listResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+// List implements Backend, following continuation tokens
+func (s *S3) List(ctx context.Context, prefix string) ([]Info, error) {
+	root := ""
+	if s.opts.Prefix != "" {
+		root = s.opts.Prefix + "/"
+	}
+
+	var files []Info
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {root + prefix}, "delimiter": {"/"}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		var result listResult
+		if resp.StatusCode != http.StatusOK {
+			err = statusError(resp, "bucket listing")
+		} else if decodeErr := xml.NewDecoder(resp.Body).Decode(&result); decodeErr != nil {
+			err = fmt.Errorf("failed to parse bucket listing: %w", decodeErr)
+		}
+		closeBody(resp)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			files = append(files, Info{
+				Name:    strings.TrimPrefix(object.Key, root),
+				Size:    object.Size,
+				ModTime: object.LastModified,
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// Delete implements Backend
+func (s *S3) Delete(ctx context.Context, name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, s.key(name), nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return statusError(resp, name)
+	}
+	return nil
+}
+
+// URL implements Backend
+func (s *S3) URL(name string) string {
+	if s.opts.PublicURL != "" {
+		return joinURL(s.opts.PublicURL, name)
+	}
+	return joinURL(s.opts.Endpoint, s.opts.Bucket+"/"+s.key(name))
+}
+
+// do sends a signed request for an object key, or for the bucket when key is empty
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, body io.Reader, size int64) (*http.Response, error) {
+	target := s.opts.Endpoint + "/" + escapePath(s.opts.Bucket)
+	if key != "" {
+		target += "/" + escapePath(key)
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 URL: %w", err)
+	}
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 request: %w", err)
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	signV4(req, s.opts.AccessKey, s.opts.SecretKey, s.opts.Region, unsignedPayload, s.now())
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s failed: %w", method, err)
+	}
+	return resp, nil
+}
+
+// signV4 signs an S3 request with AWS Signature Version 4. The host, range,
+// content type and x-amz-* headers are signed.
+func signV4(req *http.Request, accessKey, secretKey, region, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "range" || lower == "content-type" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalURI := req.URL.EscapedPath()
+	if canonicalURI == "" {
+		canonicalURI = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex(canonicalRequest)}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes a query sorted by key, as the signature requires
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, uriEncode(key)+"="+uriEncode(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// headerInfo describes a file from the headers of a HEAD response
+func headerInfo(name string, resp *http.Response) Info {
+	info := Info{Name: name, Size: resp.ContentLength}
+	if info.Size < 0 {
+		info.Size, _ = strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = modTime
+	}
+	return info
+}
+
+func closeBody(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if err := resp.Body.Close(); err != nil {
+		slog.Warn("Failed to close response body", "error", err)
+	}
+}
+
+// statusError describes an unexpected response, wrapping ErrNotExist for 404
+func statusError(resp *http.Response, name string) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", path.Base(name), ErrNotExist)
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if message := strings.TrimSpace(string(detail)); message != "" {
+		return metrics.WithClass(metrics.ClassHTTPStatus, fmt.Errorf("%s: %s %s returned status %s: %s", name, resp.Request.Method, resp.Request.URL.Redacted(), resp.Status, message))
+	}
+	return metrics.WithClass(metrics.ClassHTTPStatus, fmt.Errorf("%s: %s %s returned status %s", name, resp.Request.Method, resp.Request.URL.Redacted(), resp.Status))
+}
@@ -0,0 +1,257 @@
+package backend
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+)
+
+// WebDAV stores the files in a WebDAV collection. Uploads go to a temporary
+// name that is moved over the final one once complete.
+type WebDAV struct {
+	opts Options
+	base string // Collection URL including the prefix
+
+	mu      sync.Mutex
+	created bool // The collection and its parents exist
+}
+
+func newWebDAV(opts Options) *WebDAV {
+	opts.Prefix = strings.Trim(opts.Prefix, "/")
+	base := strings.TrimSuffix(opts.Endpoint, "/")
+	if opts.Prefix != "" {
+		base = joinURL(base, opts.Prefix)
+	}
+	return &WebDAV{opts: opts, base: base}
+}
+
+func (d *WebDAV) fileURL(name string) string {
+	return joinURL(d.base, name)
+}
+
+// Put implements Backend
+func (d *WebDAV) Put(ctx context.Context, name string, r io.Reader, size int64) (int64, error) {
+	if err := checkName(name); err != nil {
+		return 0, err
+	}
+	if err := d.createCollection(ctx); err != nil {
+		return 0, err
+	}
+
+	dir, base := path.Split(name)
+	temp := dir + "." + base + constants.TempSuffix
+	counter := &countingReader{r: r}
+	resp, err := d.do(ctx, http.MethodPut, d.fileURL(temp), counter, size, nil)
+	if err != nil {
+		return counter.n, err
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		defer closeBody(resp)
+		return counter.n, statusError(resp, name)
+	}
+	closeBody(resp)
+
+	resp, err = d.do(ctx, "MOVE", d.fileURL(temp), nil, 0, map[string]string{
+		"Destination": d.fileURL(name),
+		"Overwrite":   "T",
+	})
+	if err != nil {
+		return counter.n, err
+	}
+	defer closeBody(resp)
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return counter.n, statusError(resp, name)
+	}
+	return counter.n, nil
+}
+
+// createCollection creates the prefix collections once, existing ones are kept
+func (d *WebDAV) createCollection(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.created || d.opts.Prefix == "" {
+		return nil
+	}
+
+	collection := strings.TrimSuffix(d.opts.Endpoint, "/")
+	for _, segment := range strings.Split(d.opts.Prefix, "/") {
+		collection = joinURL(collection, segment)
+		resp, err := d.do(ctx, "MKCOL", collection+"/", nil, 0, nil)
+		if err != nil {
+			return err
+		}
+		// 405 Method Not Allowed: the collection already exists
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed {
+			defer closeBody(resp)
+			return statusError(resp, segment)
+		}
+		closeBody(resp)
+	}
+	d.created = true
+	return nil
+}
+
+// Get implements Backend
+func (d *WebDAV) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	resp, err := d.do(ctx, http.MethodGet, d.fileURL(name), nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer closeBody(resp)
+		return nil, statusError(resp, name)
+	}
+	return resp.Body, nil
+}
+
+// Stat implements Backend
+func (d *WebDAV) Stat(ctx context.Context, name string) (Info, error) {
+	if err := checkName(name); err != nil {
+		return Info{}, err
+	}
+	resp, err := d.do(ctx, http.MethodHead, d.fileURL(name), nil, 0, nil)
+	if err != nil {
+		return Info{}, err
+	}
+	defer closeBody(resp)
+	if resp.StatusCode != http.StatusOK {
+		return Info{}, statusError(resp, name)
+	}
+	return headerInfo(name, resp), nil
+}
+
+// multistatus is the PROPFIND response
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ContentLength string `xml:"DAV: getcontentlength"`
+				LastModified  string `xml:"DAV: getlastmodified"`
+				ResourceType  struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<propfind xmlns="DAV:"><prop><resourcetype/><getcontentlength/><getlastmodified/></prop></propfind>`
+
+// List implements Backend, a missing collection holds no files
+func (d *WebDAV) List(ctx context.Context, prefix string) ([]Info, error) {
+	resp, err := d.do(ctx, "PROPFIND", d.base+"/", strings.NewReader(propfindBody), int64(len(propfindBody)), map[string]string{
+		"Depth":        "1",
+		"Content-Type": "application/xml",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp)
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, statusError(resp, "collection listing")
+	}
+
+	var result multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse collection listing: %w", err)
+	}
+
+	var files []Info
+	for _, r := range result.Responses {
+		href, err := url.PathUnescape(r.Href)
+		if err != nil || strings.HasSuffix(href, "/") {
+			continue
+		}
+		name := path.Base(href)
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		info := Info{Name: name}
+		collection := false
+		for _, propstat := range r.Propstat {
+			// Properties the server doesn't know come in a separate 404 propstat
+			if !strings.Contains(propstat.Status, " 200 ") {
+				continue
+			}
+			collection = propstat.Prop.ResourceType.Collection != nil
+			info.Size, _ = strconv.ParseInt(propstat.Prop.ContentLength, 10, 64)
+			if modTime, err := http.ParseTime(propstat.Prop.LastModified); err == nil {
+				info.ModTime = modTime
+			}
+		}
+		if !collection {
+			files = append(files, info)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// Delete implements Backend
+func (d *WebDAV) Delete(ctx context.Context, name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	resp, err := d.do(ctx, http.MethodDelete, d.fileURL(name), nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp)
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return statusError(resp, name)
+	}
+	return nil
+}
+
+// URL implements Backend
+func (d *WebDAV) URL(name string) string {
+	if d.opts.PublicURL != "" {
+		return joinURL(d.opts.PublicURL, name)
+	}
+	return d.fileURL(name)
+}
+
+func (d *WebDAV) do(ctx context.Context, method, target string, body io.Reader, size int64, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webdav request: %w", err)
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if d.opts.Username != "" {
+		req.SetBasicAuth(d.opts.Username, d.opts.Password)
+	}
+
+	resp, err := d.opts.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("webdav %s failed: %w", method, err)
+	}
+	return resp, nil
+}
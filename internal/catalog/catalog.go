@@ -0,0 +1,203 @@
+// Package catalog keeps the stored episodes, their media state, tags and scrape
+// history in an embedded SQLite database. The JSON file of each episode stays
+// the source of truth: the catalogue is synced from the data directory and can
+// export the episodes back to it.
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"path/filepath"
+
+	_ "modernc.org/sqlite" // Pure-Go SQLite driver
+
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+)
+
+// migrations upgrade the schema one version at a time, the version applied
+// last is kept in PRAGMA user_version
+var migrations = []string{
+	`CREATE TABLE episodes (
+		json_file      TEXT PRIMARY KEY,
+		number         INTEGER NOT NULL,
+		item_id        TEXT NOT NULL,
+		title          TEXT NOT NULL,
+		description    TEXT NOT NULL,
+		date           TEXT NOT NULL,
+		year           INTEGER,
+		duration       TEXT NOT NULL,
+		link           TEXT NOT NULL,
+		audio_url      TEXT NOT NULL,
+		image_url      TEXT NOT NULL,
+		filename       TEXT NOT NULL,
+		image_filename TEXT NOT NULL,
+		data           TEXT NOT NULL,
+		sha256         TEXT NOT NULL,
+		file_size      INTEGER NOT NULL,
+		file_mtime     INTEGER NOT NULL
+	);
+	CREATE INDEX episodes_year ON episodes (year);
+	CREATE TABLE media (
+		json_file TEXT NOT NULL REFERENCES episodes ON DELETE CASCADE,
+		kind      TEXT NOT NULL,
+		filename  TEXT NOT NULL,
+		size      INTEGER,
+		present   INTEGER NOT NULL,
+		PRIMARY KEY (json_file, kind)
+	);
+	CREATE TABLE tags (
+		json_file TEXT NOT NULL REFERENCES episodes ON DELETE CASCADE,
+		category  TEXT NOT NULL,
+		tag       TEXT NOT NULL,
+		PRIMARY KEY (json_file, category, tag)
+	);
+	CREATE INDEX tags_tag ON tags (tag);
+	CREATE TABLE tag_evidence (
+		json_file TEXT NOT NULL REFERENCES episodes ON DELETE CASCADE,
+		category  TEXT NOT NULL,
+		tag       TEXT NOT NULL,
+		keyword   TEXT NOT NULL,
+		PRIMARY KEY (json_file, category, tag, keyword)
+	);
+	CREATE TABLE scrape_history (
+		id        INTEGER PRIMARY KEY,
+		json_file TEXT NOT NULL,
+		at        TEXT NOT NULL,
+		event     TEXT NOT NULL,
+		sha256    TEXT NOT NULL
+	);
+	CREATE INDEX scrape_history_file ON scrape_history (json_file);`,
+	`ALTER TABLE episodes ADD COLUMN status TEXT NOT NULL DEFAULT '';
+	UPDATE episodes SET status = coalesce(json_extract(data, '$.status'), '');`,
+}
+
+// Media kinds
+const (
+	MediaAudio = "audio"
+	MediaImage = "image"
+)
+
+// History events
+const (
+	EventAdded   = "added"   // The episode JSON appeared
+	EventChanged = "changed" // The episode JSON content changed
+	EventRemoved = "removed" // The episode JSON was deleted
+)
+
+// Catalog is an open catalogue database
+type Catalog struct {
+	db *sql.DB
+}
+
+// Path returns the catalogue file of a data directory
+func Path(dataDir string) string {
+	return filepath.Join(dataDir, constants.CatalogFile)
+}
+
+// Open opens or creates the catalogue at path and brings its schema up to date
+func Open(path string) (*Catalog, error) {
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath() + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open catalog: %w", err)
+	}
+	// A single connection keeps the pragmas and serializes the writers
+	db.SetMaxOpenConns(1)
+
+	c := &Catalog{db: db}
+	if err := c.migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close closes the database
+func (c *Catalog) Close() error {
+	return c.db.Close()
+}
+
+// migrate applies the migrations newer than the database schema
+func (c *Catalog) migrate() error {
+	var version int
+	if err := c.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read catalog version: %w", err)
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("catalog schema version %d is newer than this program supports (%d)", version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := c.db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to migrate catalog: %w", err)
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to migrate catalog to version %d: %w", i+1, err)
+		}
+		// PRAGMA doesn't take parameters
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to migrate catalog to version %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to migrate catalog to version %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Rows is the result of a query, every value formatted as text
+type Rows struct {
+	Columns []string
+	Values  [][]string
+}
+
+// Query runs a read-only SQL statement
+func (c *Catalog) Query(ctx context.Context, query string) (Rows, error) {
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return Rows{}, fmt.Errorf("failed to query catalog: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA query_only = 1"); err != nil {
+		return Rows{}, fmt.Errorf("failed to query catalog: %w", err)
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), "PRAGMA query_only = 0")
+	}()
+
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return Rows{}, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var result Rows
+	if result.Columns, err = rows.Columns(); err != nil {
+		return Rows{}, fmt.Errorf("query failed: %w", err)
+	}
+	for rows.Next() {
+		values := make([]sql.NullString, len(result.Columns))
+		targets := make([]any, len(values))
+		for i := range values {
+			targets[i] = &values[i]
+		}
+		if err := rows.Scan(targets...); err != nil {
+			return Rows{}, fmt.Errorf("query failed: %w", err)
+		}
+		row := make([]string, len(values))
+		for i, value := range values {
+			row[i] = value.String // NULL prints as empty
+		}
+		result.Values = append(result.Values, row)
+	}
+	if err := rows.Err(); err != nil {
+		return Rows{}, fmt.Errorf("query failed: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,141 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/backend"
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+)
+
+func writeEpisode(t *testing.T, dir string, ep collector.Episode) {
+	t.Helper()
+	data, err := json.MarshalIndent(ep, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ep.JSONFile), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	dataDir := t.TempDir()
+	episodes := []collector.Episode{
+		{Title: "1245 - La batalla de l'Ebre", Date: "25/07/2010 10:00:00", Filename: "1245-la-batalla-de-l'ebre.mp3", JSONFile: "1245-la-batalla-de-l'ebre.json"},
+		{Title: "1244 - Els almogàvers", Description: "Els almogàvers a Orient", Status: collector.StatusLost, Date: "18/07/2010 10:00:00", Filename: "1244-els-almogàvers.mp3", JSONFile: "1244-els-almogàvers.json"},
+		{Title: "1243 - La Renaixença", Date: "2011-03-02", Filename: "1243-la-renaixença.mp3", JSONFile: "1243-la-renaixença.json"},
+	}
+	for _, ep := range episodes {
+		writeEpisode(t, dataDir, ep)
+	}
+
+	c, err := Open(filepath.Join(t.TempDir(), "catalog.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	opts := SyncOptions{
+		Media: []backend.Info{
+			{Name: "1245-la-batalla-de-l'ebre.mp3", Size: 2 << 20},
+			{Name: "1243-la-renaixença.mp3", Size: 2 << 20},
+		},
+		Tagger: func(title, description string) []Evidence {
+			if strings.Contains(strings.ToLower(title+" "+description), "orient") {
+				return []Evidence{{Category: "locations", Tag: "asia", Keyword: "orient"}}
+			}
+			return nil
+		},
+	}
+	stats, err := c.Sync(ctx, dataDir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Added != 3 || stats.Episodes != 3 {
+		t.Errorf("first sync = %+v, want 3 added", stats)
+	}
+
+	rows, err := c.Query(ctx, `SELECT e.number FROM episodes e JOIN media m USING (json_file)
+		WHERE m.kind = 'audio' AND NOT m.present AND e.year = 2010`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"1244"}}; !reflect.DeepEqual(rows.Values, want) {
+		t.Errorf("episodes without audio in 2010 = %v, want %v", rows.Values, want)
+	}
+	rows, err = c.Query(ctx, `SELECT number FROM episodes WHERE status = 'lost'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"1244"}}; !reflect.DeepEqual(rows.Values, want) {
+		t.Errorf("lost episodes = %v, want %v", rows.Values, want)
+	}
+	rows, err = c.Query(ctx, `SELECT json_file, keyword FROM tag_evidence WHERE tag = 'asia'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"1244-els-almogàvers.json", "orient"}}; !reflect.DeepEqual(rows.Values, want) {
+		t.Errorf("tag evidence = %v, want %v", rows.Values, want)
+	}
+	if _, err := c.Query(ctx, `DELETE FROM episodes`); err == nil {
+		t.Error("Query ran a write statement")
+	}
+
+	// Unchanged files are skipped, edits and removals are recorded
+	changed := episodes[0]
+	changed.Description = "Juliol de 1938"
+	writeEpisode(t, dataDir, changed)
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(dataDir, changed.JSONFile), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dataDir, episodes[2].JSONFile)); err != nil {
+		t.Fatal(err)
+	}
+	stats, err = c.Sync(ctx, dataDir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (SyncStats{Episodes: 2, Changed: 1, Removed: 1, Unchanged: 1}) {
+		t.Errorf("second sync = %+v", stats)
+	}
+	rows, err = c.Query(ctx, `SELECT event FROM scrape_history WHERE json_file = '1245-la-batalla-de-l''ebre.json' ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{EventAdded}, {EventChanged}}; !reflect.DeepEqual(rows.Values, want) {
+		t.Errorf("history = %v, want %v", rows.Values, want)
+	}
+
+	got, err := c.Episodes(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Number() != 1244 || got[1].Description != "Juliol de 1938" {
+		t.Errorf("Episodes = %+v", got)
+	}
+
+	// Export restores the JSON files byte for byte
+	exportDir := t.TempDir()
+	if n, err := c.Export(ctx, exportDir, false); err != nil || n != 2 {
+		t.Fatalf("Export = %d, %v", n, err)
+	}
+	for _, name := range []string{changed.JSONFile, episodes[1].JSONFile} {
+		want, _ := os.ReadFile(filepath.Join(dataDir, name))
+		exported, err := os.ReadFile(filepath.Join(exportDir, name))
+		if err != nil || string(exported) != string(want) {
+			t.Errorf("exported %s differs: %v", name, err)
+		}
+	}
+	if n, err := c.Export(ctx, exportDir, false); err != nil || n != 0 {
+		t.Errorf("second Export = %d, %v, want nothing written", n, err)
+	}
+}
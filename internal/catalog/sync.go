@@ -0,0 +1,413 @@
+package catalog
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/atomicfile"
+	"github.com/p4u/enguardia-arxiu/internal/backend"
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+)
+
+// Evidence is a tag of an episode and the keyword that triggered it
+type Evidence struct {
+	Category string
+	Tag      string
+	Keyword  string
+}
+
+// SyncOptions configures a sync
+type SyncOptions struct {
+	Media            []backend.Info // Media files of the backend, nil keeps the stored media state
+	MinAudioFileSize int64          // Audio must exceed this size to be present (0 = default)
+	MinImageFileSize int64          // Images must exceed this size to be present (0 = default)
+	// Tagger returns the tags of an episode, nil keeps the stored tags
+	Tagger func(title, description string) []Evidence
+}
+
+// SyncStats counts the changes made by a sync
+type SyncStats struct {
+	Episodes  int // Episodes in the catalogue after the sync
+	Added     int
+	Changed   int
+	Removed   int
+	Unchanged int // Files skipped because their size and modification time match
+}
+
+// stored is the change detection state of a catalogued episode
+type stored struct {
+	sum   string
+	size  int64
+	mtime int64
+}
+
+// Sync brings the catalogue up to date with the episode JSON files of dataDir.
+// Files whose size and modification time are unchanged are not read again;
+// the media state and tags of every episode are refreshed when given.
+func (c *Catalog) Sync(ctx context.Context, dataDir string, opts SyncOptions) (SyncStats, error) {
+	if opts.MinAudioFileSize <= 0 {
+		opts.MinAudioFileSize = constants.MinAudioFileSize
+	}
+	if opts.MinImageFileSize <= 0 {
+		opts.MinImageFileSize = constants.MinImageFileSize
+	}
+
+	files, err := filepath.Glob(filepath.Join(dataDir, "*"+constants.JSONExtension))
+	if err != nil {
+		return SyncStats{}, fmt.Errorf("failed to glob JSON files: %w", err)
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return SyncStats{}, fmt.Errorf("failed to sync catalog: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	known, err := storedEpisodes(ctx, tx)
+	if err != nil {
+		return SyncStats{}, err
+	}
+
+	var stats SyncStats
+	now := time.Now().UTC().Format(time.RFC3339)
+	seen := make(map[string]bool, len(files))
+	for _, file := range files {
+		name := filepath.Base(file)
+		info, err := os.Stat(file)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		seen[name] = true
+
+		previous, ok := known[name]
+		if ok && previous.size == info.Size() && previous.mtime == info.ModTime().UnixNano() {
+			stats.Unchanged++
+			continue
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			slog.Warn("Failed to read episode file", "file", file, "error", err)
+			continue
+		}
+		var episode collector.Episode
+		if err := json.Unmarshal(data, &episode); err != nil {
+			slog.Warn("Failed to parse episode file", "file", file, "error", err)
+			continue
+		}
+		episode.JSONFile = name
+
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])
+		if err := putEpisode(ctx, tx, episode, data, hash, info); err != nil {
+			return SyncStats{}, err
+		}
+		switch {
+		case !ok:
+			stats.Added++
+			err = addHistory(ctx, tx, name, now, EventAdded, hash)
+		case previous.sum != hash:
+			stats.Changed++
+			err = addHistory(ctx, tx, name, now, EventChanged, hash)
+		default:
+			stats.Unchanged++ // Touched but identical
+		}
+		if err != nil {
+			return SyncStats{}, err
+		}
+	}
+
+	for name, previous := range known {
+		if seen[name] {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM episodes WHERE json_file = ?`, name); err != nil {
+			return SyncStats{}, fmt.Errorf("failed to remove %s from catalog: %w", name, err)
+		}
+		if err := addHistory(ctx, tx, name, now, EventRemoved, previous.sum); err != nil {
+			return SyncStats{}, err
+		}
+		stats.Removed++
+	}
+
+	if opts.Media != nil {
+		if err := refreshMedia(ctx, tx, opts); err != nil {
+			return SyncStats{}, err
+		}
+	}
+	if opts.Tagger != nil {
+		if err := refreshTags(ctx, tx, opts.Tagger); err != nil {
+			return SyncStats{}, err
+		}
+	}
+
+	if err := tx.QueryRowContext(ctx, `SELECT count(*) FROM episodes`).Scan(&stats.Episodes); err != nil {
+		return SyncStats{}, fmt.Errorf("failed to count catalog episodes: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return SyncStats{}, fmt.Errorf("failed to sync catalog: %w", err)
+	}
+	return stats, nil
+}
+
+func storedEpisodes(ctx context.Context, tx *sql.Tx) (map[string]stored, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT json_file, sha256, file_size, file_mtime FROM episodes`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog: %w", err)
+	}
+	defer rows.Close()
+
+	known := make(map[string]stored)
+	for rows.Next() {
+		var name string
+		var s stored
+		if err := rows.Scan(&name, &s.sum, &s.size, &s.mtime); err != nil {
+			return nil, fmt.Errorf("failed to read catalog: %w", err)
+		}
+		known[name] = s
+	}
+	return known, rows.Err()
+}
+
+func putEpisode(ctx context.Context, tx *sql.Tx, ep collector.Episode, data []byte, sum string, info os.FileInfo) error {
+	var year sql.NullInt64
+	if date := parseDate(ep.Date); !date.IsZero() {
+		year = sql.NullInt64{Int64: int64(date.Year()), Valid: true}
+	}
+	// An upsert keeps the rows referencing the episode, REPLACE would delete them
+	_, err := tx.ExecContext(ctx, `INSERT INTO episodes (
+		json_file, number, item_id, title, description, date, year, duration, link,
+		audio_url, image_url, filename, image_filename, status, data, sha256, file_size, file_mtime
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (json_file) DO UPDATE SET
+		number = excluded.number, item_id = excluded.item_id, title = excluded.title,
+		description = excluded.description, date = excluded.date, year = excluded.year,
+		duration = excluded.duration, link = excluded.link, audio_url = excluded.audio_url,
+		image_url = excluded.image_url, filename = excluded.filename,
+		image_filename = excluded.image_filename, status = excluded.status, data = excluded.data, sha256 = excluded.sha256,
+		file_size = excluded.file_size, file_mtime = excluded.file_mtime`,
+		ep.JSONFile, ep.Number(), ep.ItemID(), ep.Title, ep.Description, ep.Date, year, ep.Duration, ep.Link,
+		ep.AudioURL, ep.Image, ep.Filename, ep.ImageFilename, ep.Status, string(data), sum, info.Size(), info.ModTime().UnixNano())
+	if err != nil {
+		return fmt.Errorf("failed to catalog %s: %w", ep.JSONFile, err)
+	}
+	return nil
+}
+
+func addHistory(ctx context.Context, tx *sql.Tx, name, at, event, sum string) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO scrape_history (json_file, at, event, sha256) VALUES (?, ?, ?, ?)`,
+		name, at, event, sum)
+	if err != nil {
+		return fmt.Errorf("failed to record history of %s: %w", name, err)
+	}
+	return nil
+}
+
+// refreshMedia records whether the audio and image of every episode are stored
+func refreshMedia(ctx context.Context, tx *sql.Tx, opts SyncOptions) error {
+	sizes := make(map[string]int64, len(opts.Media))
+	for _, info := range opts.Media {
+		sizes[info.Name] = info.Size
+	}
+
+	type media struct{ file, audio, image string }
+	rows, err := tx.QueryContext(ctx, `SELECT json_file, filename, image_filename FROM episodes`)
+	if err != nil {
+		return fmt.Errorf("failed to read catalog: %w", err)
+	}
+	var episodes []media
+	for rows.Next() {
+		var m media
+		if err := rows.Scan(&m.file, &m.audio, &m.image); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read catalog: %w", err)
+		}
+		episodes = append(episodes, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read catalog: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM media`); err != nil {
+		return fmt.Errorf("failed to refresh media state: %w", err)
+	}
+	insert, err := tx.PrepareContext(ctx, `INSERT INTO media (json_file, kind, filename, size, present) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to refresh media state: %w", err)
+	}
+	defer insert.Close()
+
+	put := func(file, kind, name string, minSize int64) error {
+		size, ok := sizes[name]
+		if name == "" {
+			ok = false
+		}
+		var stored sql.NullInt64
+		if ok {
+			stored = sql.NullInt64{Int64: size, Valid: true}
+		}
+		if _, err := insert.ExecContext(ctx, file, kind, name, stored, ok && size > minSize); err != nil {
+			return fmt.Errorf("failed to refresh media state of %s: %w", file, err)
+		}
+		return nil
+	}
+	for _, m := range episodes {
+		if err := put(m.file, MediaAudio, m.audio, opts.MinAudioFileSize); err != nil {
+			return err
+		}
+		if err := put(m.file, MediaImage, m.image, opts.MinImageFileSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshTags replaces the tags and their evidence of every episode
+func refreshTags(ctx context.Context, tx *sql.Tx, tagger func(title, description string) []Evidence) error {
+	type text struct{ file, title, description string }
+	rows, err := tx.QueryContext(ctx, `SELECT json_file, title, description FROM episodes`)
+	if err != nil {
+		return fmt.Errorf("failed to read catalog: %w", err)
+	}
+	var episodes []text
+	for rows.Next() {
+		var t text
+		if err := rows.Scan(&t.file, &t.title, &t.description); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read catalog: %w", err)
+		}
+		episodes = append(episodes, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read catalog: %w", err)
+	}
+
+	for _, statement := range []string{`DELETE FROM tag_evidence`, `DELETE FROM tags`} {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to refresh tags: %w", err)
+		}
+	}
+	insertTag, err := tx.PrepareContext(ctx, `INSERT OR IGNORE INTO tags (json_file, category, tag) VALUES (?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to refresh tags: %w", err)
+	}
+	defer insertTag.Close()
+	insertEvidence, err := tx.PrepareContext(ctx, `INSERT OR IGNORE INTO tag_evidence (json_file, category, tag, keyword) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to refresh tags: %w", err)
+	}
+	defer insertEvidence.Close()
+
+	for _, ep := range episodes {
+		for _, e := range tagger(ep.title, ep.description) {
+			if _, err := insertTag.ExecContext(ctx, ep.file, e.Category, e.Tag); err != nil {
+				return fmt.Errorf("failed to tag %s: %w", ep.file, err)
+			}
+			if _, err := insertEvidence.ExecContext(ctx, ep.file, e.Category, e.Tag, e.Keyword); err != nil {
+				return fmt.Errorf("failed to tag %s: %w", ep.file, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Episodes returns the catalogued episodes ordered by episode number
+func (c *Catalog) Episodes(ctx context.Context) ([]collector.Episode, error) {
+	rows, err := c.db.QueryContext(ctx, `SELECT json_file, data FROM episodes ORDER BY number, json_file`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog: %w", err)
+	}
+	defer rows.Close()
+
+	var episodes []collector.Episode
+	for rows.Next() {
+		var name, data string
+		if err := rows.Scan(&name, &data); err != nil {
+			return nil, fmt.Errorf("failed to read catalog: %w", err)
+		}
+		var episode collector.Episode
+		if err := json.Unmarshal([]byte(data), &episode); err != nil {
+			slog.Warn("Failed to parse catalogued episode", "file", name, "error", err)
+			continue
+		}
+		episode.JSONFile = name
+		episodes = append(episodes, episode)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read catalog: %w", err)
+	}
+	return episodes, nil
+}
+
+// Export writes the JSON file of every catalogued episode to dir exactly as
+// it was imported. Files already holding the same content are left untouched
+// and the number of files written is returned.
+func (c *Catalog) Export(ctx context.Context, dir string, dryRun bool) (int, error) {
+	rows, err := c.db.QueryContext(ctx, `SELECT json_file, data FROM episodes`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read catalog: %w", err)
+	}
+	defer rows.Close()
+
+	files := make(map[string]string)
+	for rows.Next() {
+		var name, data string
+		if err := rows.Scan(&name, &data); err != nil {
+			return 0, fmt.Errorf("failed to read catalog: %w", err)
+		}
+		files[name] = data
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read catalog: %w", err)
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if !dryRun {
+		if err := os.MkdirAll(dir, constants.DirPermissions); err != nil {
+			return 0, fmt.Errorf("failed to create export directory: %w", err)
+		}
+	}
+	written := 0
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if current, err := os.ReadFile(path); err == nil && string(current) == files[name] {
+			continue
+		}
+		written++
+		if dryRun {
+			slog.Info("Dry run: would export episode", "file", path)
+			continue
+		}
+		if err := atomicfile.WriteFile(path, []byte(files[name]), constants.FilePermissions); err != nil {
+			return written, fmt.Errorf("failed to export %s: %w", name, err)
+		}
+	}
+	return written, nil
+}
+
+// parseDate parses the publication dates found in the episode files
+func parseDate(date string) time.Time {
+	for _, format := range []string{"02/01/2006 15:04:05", "2006-01-02 15:04:05", "2006-01-02", "02/01/2006"} {
+		if t, err := time.Parse(format, date); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
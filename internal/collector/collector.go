@@ -1,16 +1,21 @@
 package collector
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
 
 	"github.com/p4u/enguardia-arxiu/internal/constants"
+	"github.com/p4u/enguardia-arxiu/internal/metrics"
+	"github.com/p4u/enguardia-arxiu/internal/program"
+	"github.com/p4u/enguardia-arxiu/internal/report"
 )
 
 type Episode struct {
@@ -23,78 +28,271 @@ type Episode struct {
 	Image         string `json:"image"`
 	Filename      string `json:"filename"`
 	ImageFilename string `json:"image_filename,omitempty"`
+	ImageAlt      string `json:"image_alt,omitempty"`
 	JSONFile      string `json:"-"`
+
+	// Every audio file offered by the API, AudioURL is the preferred one
+	AudioRenditions []AudioRendition `json:"audio_renditions,omitempty"`
+
+	// Audio repair bookkeeping for episodes stuck on the fallback URL
+	AudioFailures    int    `json:"audio_failures,omitempty"`
+	LastAudioAttempt string `json:"last_audio_attempt,omitempty"`
+
+	// Whether 3Cat still lists the episode, set by reconciliation (empty = not checked)
+	Status string `json:"status,omitempty"`
+
+	// Change log of the episode, oldest first
+	History []HistoryEvent `json:"history,omitempty"`
+}
+
+// ItemID returns the 3Cat item ID encoded in the episode link
+func (e Episode) ItemID() string {
+	matches := regexp.MustCompile(constants.ItemIDPattern).FindStringSubmatch(e.Link)
+	if len(matches) < 2 {
+		return ""
+	}
+	return matches[1]
+}
+
+// Number returns the episode number that prefixes the title, or 0 if there is none
+func (e Episode) Number() int {
+	matches := regexp.MustCompile(constants.TitleNumPattern).FindStringSubmatch(e.Title)
+	if len(matches) < 2 {
+		return 0
+	}
+	num, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return 0
+	}
+	return num
+}
+
+// PublishedAt returns the broadcast date, or the zero time if it cannot be parsed
+func (e Episode) PublishedAt() time.Time {
+	for _, layout := range constants.DateLayouts {
+		if t, err := time.Parse(layout, e.Date); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Upstream statuses of an episode
+const (
+	StatusUpstream  = "upstream"   // Listed by 3Cat, or its audio is still served
+	StatusLocalOnly = "local-only" // Removed from 3Cat, the audio only exists in the archive
+	StatusLost      = "lost"       // Removed from 3Cat and never downloaded
+)
+
+// RemoteAudio reports whether the 3Cat audio URL of the episode can be used
+func (e Episode) RemoteAudio() bool {
+	return e.AudioURL != "" && e.Status != StatusLocalOnly && e.Status != StatusLost
+}
+
+// HasFallbackAudio reports whether the episode points at the placeholder audio URL
+func (e Episode) HasFallbackAudio() bool {
+	return strings.Contains(e.AudioURL, constants.FailedAudioKeyword)
+}
+
+// AudioRetryDue reports whether a placeholder audio URL should be resolved again.
+// Each failure doubles the wait, and episodes stop being retried after
+// constants.MaxAudioRepairAttempts failures.
+func (e Episode) AudioRetryDue(now time.Time) bool {
+	if !e.HasFallbackAudio() {
+		return false
+	}
+	if e.AudioFailures >= constants.MaxAudioRepairAttempts {
+		return false
+	}
+	if e.LastAudioAttempt == "" || e.AudioFailures == 0 {
+		return true
+	}
+
+	last, err := time.Parse(time.RFC3339, e.LastAudioAttempt)
+	if err != nil {
+		return true
+	}
+
+	backoff := constants.AudioRepairBackoff << uint(e.AudioFailures-1)
+	return !now.Before(last.Add(backoff))
 }
 
 type Collector struct {
-	client *http.Client
+	program      program.Program
+	client       *http.Client
+	preference   AudioPreference
+	apiBaseURL   string
+	siteURL      string
+	mediaBaseURL string
+	now          func() time.Time
+	delay        time.Duration
+	maxFilename  int
+	report       *report.Report
+	metrics      *metrics.Metrics
 }
 
-func NewCollector() *Collector {
-	return &Collector{
-		client: &http.Client{
+// Options configures the endpoints and dependencies used by a Collector
+type Options struct {
+	APIBaseURL   string           // 3Cat API base URL
+	SiteURL      string           // Public site base URL used for episode links
+	MediaBaseURL string           // Base URL for relative audio and image paths
+	Client       *http.Client     // HTTP client for API requests
+	Now          func() time.Time // Clock used for timestamps
+	Delay        time.Duration    // Delay between API requests (0 = no delay)
+	Program      program.Program  // Programme to scrape
+	MaxFilename  int              // Maximum length of generated file names
+	Report       *report.Report   // Run report receiving page counts and failures (nil = none)
+	Metrics      *metrics.Metrics // Metrics receiving API requests and failures (nil = none)
+
+	AudioPreference AudioPreference
+}
+
+// DefaultOptions returns the options for the live 3Cat API
+func DefaultOptions() Options {
+	return Options{
+		APIBaseURL:   constants.CCMAAPIBaseURL,
+		SiteURL:      constants.BaseURL,
+		MediaBaseURL: constants.CCMAMediaBaseURL,
+		Client: &http.Client{
 			Timeout: constants.HTTPTimeout,
 		},
+		Now:             time.Now,
+		Delay:           constants.APIRequestDelay,
+		Program:         program.EnGuardia(),
+		MaxFilename:     constants.MaxFilenameLen,
+		AudioPreference: DefaultAudioPreference(),
 	}
 }
 
-func (c *Collector) ScrapeEpisodes() ([]Episode, error) {
-	return c.ScrapeEpisodesWithLimit(0)
+func NewCollector() *Collector {
+	return NewCollectorWithOptions(DefaultOptions())
 }
 
-func (c *Collector) ScrapeEpisodesWithLimit(maxPages int) ([]Episode, error) {
-	if maxPages > 0 {
-		log.Printf("Starting API-based scraping for En Guàrdia episodes (max %d pages)", maxPages)
-	} else {
-		log.Println("Starting API-based scraping for all En Guàrdia episodes")
+// NewCollectorWithOptions creates a collector, empty options fall back to the defaults
+// except Delay, where zero disables the pause between requests
+func NewCollectorWithOptions(opts Options) *Collector {
+	defaults := DefaultOptions()
+	if opts.APIBaseURL == "" {
+		opts.APIBaseURL = defaults.APIBaseURL
+	}
+	if opts.SiteURL == "" {
+		opts.SiteURL = defaults.SiteURL
+	}
+	if opts.MediaBaseURL == "" {
+		opts.MediaBaseURL = defaults.MediaBaseURL
+	}
+	if opts.Client == nil {
+		opts.Client = defaults.Client
+	}
+	if opts.Now == nil {
+		opts.Now = defaults.Now
+	}
+	if opts.Program.ID == "" {
+		opts.Program = defaults.Program
+	}
+	if opts.MaxFilename <= 0 {
+		opts.MaxFilename = defaults.MaxFilename
+	}
+	if opts.Program.AudioType == "" {
+		opts.Program.AudioType = constants.AudioType
 	}
 
-	var allEpisodes []Episode
-	pageNum := 1
+	c := &Collector{
+		program:      opts.Program,
+		client:       opts.Client,
+		apiBaseURL:   strings.TrimSuffix(opts.APIBaseURL, "/"),
+		siteURL:      strings.TrimSuffix(opts.SiteURL, "/"),
+		mediaBaseURL: strings.TrimSuffix(opts.MediaBaseURL, "/"),
+		now:          opts.Now,
+		delay:        opts.Delay,
+		maxFilename:  opts.MaxFilename,
+		report:       opts.Report,
+		metrics:      opts.Metrics,
+	}
+	c.SetAudioPreference(opts.AudioPreference)
+	return c
+}
 
-	for {
-		// Construct API URL with correct parameters for En Guàrdia program
-		apiURL := fmt.Sprintf("%s%s?_format=json&ordre=-data_publicacio&origen=llistat&programaradio_id=%s&tipus_audio=%s&pagina=%d&sdom=img&version=%s&cache=%s&https=true&master=yes",
-			constants.CCMAAPIBaseURL, constants.AudiosAPIEndpoint, constants.ProgramRadioID, constants.AudioType, pageNum, constants.APIVersion, constants.CacheSeconds)
+// SetAudioPreference changes how the episode audio is chosen among the renditions
+func (c *Collector) SetAudioPreference(pref AudioPreference) {
+	if len(pref.Formats) == 0 {
+		pref.Formats = DefaultAudioPreference().Formats
+	}
+	c.preference = pref
+}
 
-		log.Printf("Fetching page %d from API: %s", pageNum, apiURL)
+// Now returns the current time according to the collector clock
+func (c *Collector) Now() time.Time {
+	return c.now()
+}
 
-		// Make request to API
-		resp, err := c.client.Get(apiURL)
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch API data for page %d: %w", pageNum, err)
-		}
+// Wait pauses for the configured delay between API requests, returning early
+// with the context error when it is cancelled
+func (c *Collector) Wait(ctx context.Context) error {
+	if c.delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(c.delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
 
-		if resp.StatusCode != http.StatusOK {
-			if err := resp.Body.Close(); err != nil {
-				log.Printf("Failed to close response body: %v", err)
-			}
-			return nil, fmt.Errorf("API returned status %d for page %d", resp.StatusCode, pageNum)
-		}
+func (c *Collector) ScrapeEpisodes(ctx context.Context) ([]Episode, error) {
+	return c.ScrapeEpisodesWithLimit(ctx, 0)
+}
+
+func (c *Collector) ScrapeEpisodesWithLimit(ctx context.Context, maxPages int) ([]Episode, error) {
+	if maxPages > 0 {
+		slog.Info("Starting API-based scraping", "program", c.program.Name, "max_pages", maxPages)
+	} else {
+		slog.Info("Starting API-based scraping of all episodes", "program", c.program.Name)
+	}
+	return c.scrapePages(ctx, maxPages, nil)
+}
 
-		// Parse JSON response
-		var listResp CCMAListResponse
-		if err := json.NewDecoder(resp.Body).Decode(&listResp); err != nil {
-			if closeErr := resp.Body.Close(); closeErr != nil {
-				log.Printf("Failed to close response body: %v", closeErr)
+// ScrapeNewEpisodes fetches the listing, newest first, until a page holds only
+// episodes for which known returns true. The known episodes of the pages
+// fetched are returned too.
+func (c *Collector) ScrapeNewEpisodes(ctx context.Context, known func(Episode) bool) ([]Episode, error) {
+	slog.Info("Starting incremental scraping", "program", c.program.Name)
+	return c.scrapePages(ctx, 0, func(page []Episode) bool {
+		for _, episode := range page {
+			if !known(episode) {
+				return false
 			}
-			return nil, fmt.Errorf("failed to parse API response for page %d: %w", pageNum, err)
-		}
-		if err := resp.Body.Close(); err != nil {
-			log.Printf("Failed to close response body: %v", err)
 		}
+		return true
+	})
+}
+
+// scrapePages fetches listing pages until the last one, maxPages (0 = no limit)
+// or a page for which stop returns true. A cancelled context interrupts the
+// scraping between requests.
+func (c *Collector) scrapePages(ctx context.Context, maxPages int, stop func(page []Episode) bool) ([]Episode, error) {
+	var allEpisodes []Episode
+	pageNum := 1
 
-		// Check if response is valid
-		if listResp.Resposta.Status != constants.APIStatusOK {
-			return nil, fmt.Errorf("API returned status: %s for page %d", listResp.Resposta.Status, pageNum)
+	for {
+		listResp, err := c.fetchPage(ctx, pageNum)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("scraping interrupted at page %d: %w", pageNum, ctx.Err())
+		}
+		if err != nil {
+			c.metrics.Fail("list", err)
+			return nil, err
 		}
 
 		// Log pagination info on first page
 		if pageNum == 1 {
-			log.Printf("API pagination info - Current page: %d, Total pages: %d, Total items: %d",
-				listResp.Resposta.Paginacio.PaginaActual,
-				listResp.Resposta.Paginacio.TotalPagines,
-				listResp.Resposta.Paginacio.TotalItems)
+			slog.Info("API pagination info",
+				"current_page", listResp.Resposta.Paginacio.PaginaActual,
+				"total_pages", listResp.Resposta.Paginacio.TotalPagines,
+				"total_items", listResp.Resposta.Paginacio.TotalItems)
 		}
 
 		// Process episodes from this page
@@ -106,77 +304,70 @@ func (c *Collector) ScrapeEpisodesWithLimit(maxPages int) ([]Episode, error) {
 				Description: c.cleanDescription(item.Entradeta),
 				Duration:    item.Durada,
 				Date:        item.DataPublicacio,
-				Link:        fmt.Sprintf("%s%s/%d/", constants.BaseURL, constants.EpisodeURLPattern, item.ID),
+				Link:        fmt.Sprintf("%s%s/%d/", c.siteURL, c.program.URLPattern, item.ID),
 			}
 
-			// Create safe filename
-			episode.Filename = c.createSafeFilename(episode.Title) + constants.MP3Extension
+			// Create safe filename, the audio extension is known once the rendition is chosen
 			episode.JSONFile = c.createSafeFilename(episode.Title) + constants.JSONExtension
 
-			// Extract image URL if available
-			if len(item.Imatges) > 0 && item.Imatges[0].Text != "" {
-				imageText := item.Imatges[0].Text
-				// Check if the image text is already a full URL
-				if strings.HasPrefix(imageText, "http://") || strings.HasPrefix(imageText, "https://") {
-					episode.Image = imageText
-				} else if strings.HasPrefix(imageText, "/") {
-					// It's an absolute path, prepend only the domain
-					episode.Image = fmt.Sprintf("https://img.3cat.cat%s", imageText)
-				} else {
-					// It's a relative path, prepend the full base URL
-					episode.Image = fmt.Sprintf("%s/%s", constants.CCMAMediaBaseURL, imageText)
-				}
-
-				// Generate image filename based on the image URL extension
-				imageExt := constants.JPGExtension // default to jpg
-				if strings.Contains(strings.ToLower(episode.Image), ".png") {
-					imageExt = constants.PNGExtension
-				}
-				episode.ImageFilename = c.createSafeFilename(episode.Title) + imageExt
+			// Extract the largest image if available
+			if image, ok := SelectLargestImage(item.Imatges); ok {
+				episode.Image = c.imageURL(image.Text)
+				episode.ImageAlt = c.cleanTitle(image.Alt)
+				episode.ImageFilename = c.createSafeFilename(episode.Title) + imageExtension(episode.Image)
 			}
 
 			// Extract audio URL if available in the API response
-			if len(item.Audios) > 0 && item.Audios[0].Text != "" {
-				audioText := item.Audios[0].Text
-				// Check if the audio text is already a full URL
-				if strings.HasPrefix(audioText, "http://") || strings.HasPrefix(audioText, "https://") {
-					episode.AudioURL = audioText
-				} else {
-					// It's a relative path, prepend the base URL
-					episode.AudioURL = fmt.Sprintf("%s/%s", constants.CCMAMediaBaseURL, audioText)
-				}
+			episode.AudioRenditions = c.audioRenditions(item.Audios)
+			if selected, ok := SelectAudioRendition(episode.AudioRenditions, c.preference); ok {
+				episode.AudioURL = selected.URL
 			} else {
 				// Fallback: try to extract audio URL using the individual episode API
-				audioURL, err := c.extractAudioURL(fmt.Sprintf("%d", item.ID))
+				audioURL, renditions, err := c.ResolveAudio(ctx, fmt.Sprintf("%d", item.ID))
+				episode.AudioRenditions = renditions
+				if ctx.Err() != nil {
+					return nil, fmt.Errorf("scraping interrupted at page %d: %w", pageNum, ctx.Err())
+				}
 				if err != nil {
-					log.Printf("Failed to extract audio URL for episode %s (%d): %v", episode.Title, item.ID, err)
+					slog.Warn("Failed to extract audio URL", "episode", episode.Title, "id", item.ID, "error", err)
+					c.report.Fail(episode.Title, "resolve", err)
+					c.report.Add(report.FallbackAudio, 1)
 					episode.AudioURL = fmt.Sprintf("%s-%d%s", constants.FallbackAudioURL, item.ID, constants.MP3Extension)
+					episode.AudioFailures = 1
+					episode.LastAudioAttempt = c.now().UTC().Format(time.RFC3339)
 				} else {
 					episode.AudioURL = audioURL
 				}
 			}
+			episode.Filename = c.createSafeFilename(episode.Title) + audioExtension(episode.AudioURL, episode.AudioRenditions)
 
 			allEpisodes = append(allEpisodes, episode)
 			pageEpisodes++
 		}
 
-		log.Printf("Page %d: processed %d episodes (total so far: %d)", pageNum, pageEpisodes, len(allEpisodes))
+		slog.Info("Page processed", "page", pageNum, "episodes", pageEpisodes, "total", len(allEpisodes))
 
 		// Check if we've reached the last page
 		if pageNum >= listResp.Resposta.Paginacio.TotalPagines {
-			log.Printf("Reached last page (%d), stopping", listResp.Resposta.Paginacio.TotalPagines)
+			slog.Debug("Reached last page, stopping", "page", listResp.Resposta.Paginacio.TotalPagines)
+			break
+		}
+
+		// Stop at the first page without anything new
+		if stop != nil && stop(allEpisodes[len(allEpisodes)-pageEpisodes:]) {
+			slog.Info("Reached already known episodes, stopping", "page", pageNum)
 			break
 		}
 
 		// Check if we've reached the maximum pages limit
 		if maxPages > 0 && pageNum >= maxPages {
-			log.Printf("Reached maximum pages limit (%d), stopping", maxPages)
+			slog.Info("Reached maximum pages limit, stopping", "max_pages", maxPages)
 			break
 		}
 
 		// Check if this page had no episodes (safety check)
 		if pageEpisodes == 0 {
-			log.Printf("Page %d had no episodes, stopping", pageNum)
+			slog.Warn("Page had no episodes, stopping", "page", pageNum)
 			break
 		}
 
@@ -184,13 +375,60 @@ func (c *Collector) ScrapeEpisodesWithLimit(maxPages int) ([]Episode, error) {
 		pageNum++
 
 		// Add delay between API requests to be respectful
-		time.Sleep(constants.APIRequestDelay)
+		if err := c.Wait(ctx); err != nil {
+			return nil, fmt.Errorf("scraping interrupted at page %d: %w", pageNum, err)
+		}
 	}
 
-	log.Printf("API-based scraping completed: found %d total episodes across %d pages", len(allEpisodes), pageNum)
+	slog.Info("API-based scraping completed", "episodes", len(allEpisodes), "pages", pageNum)
+	c.report.Add(report.EpisodesFound, len(allEpisodes))
 	return allEpisodes, nil
 }
 
+// fetchPage requests a page of the programme listing
+func (c *Collector) fetchPage(ctx context.Context, pageNum int) (*CCMAListResponse, error) {
+	// Construct API URL with the listing parameters for the program
+	apiURL := fmt.Sprintf("%s%s?_format=json&ordre=-data_publicacio&origen=llistat&programaradio_id=%s&tipus_audio=%s&pagina=%d&sdom=img&version=%s&cache=%s&https=true&master=yes",
+		c.apiBaseURL, constants.AudiosAPIEndpoint, c.program.ID, c.program.AudioType, pageNum, constants.APIVersion, constants.CacheSeconds)
+
+	slog.Debug("Fetching page from API", "page", pageNum, "url", apiURL)
+	c.report.Add(report.PagesFetched, 1)
+	c.metrics.PageFetched()
+
+	// Make request to API
+	start := time.Now()
+	resp, err := c.get(ctx, apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch API data for page %d: %w", pageNum, err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.Warn("Failed to close response body", "error", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, metrics.WithClass(metrics.ClassHTTPStatus,
+			fmt.Errorf("API returned status %d for page %d", resp.StatusCode, pageNum))
+	}
+
+	// Parse JSON response
+	var listResp CCMAListResponse
+	err = json.NewDecoder(resp.Body).Decode(&listResp)
+	c.metrics.APIRequest("list", time.Since(start))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse API response for page %d: %w", pageNum, err)
+	}
+
+	// Check if response is valid
+	if listResp.Resposta.Status != constants.APIStatusOK {
+		return nil, metrics.WithClass(metrics.ClassAPI,
+			fmt.Errorf("API returned status: %s for page %d", listResp.Resposta.Status, pageNum))
+	}
+
+	return &listResp, nil
+}
+
 // cleanTitle removes HTML tags and cleans up the title text
 func (c *Collector) cleanTitle(title string) string {
 	// Remove HTML tags using regex
@@ -268,14 +506,14 @@ func (c *Collector) createSafeFilename(title string) string {
 	filename = strings.Trim(filename, "-")
 
 	// Limit length to prevent "file name too long" errors
-	if len(filename) > constants.MaxFilenameLen {
+	if len(filename) > c.maxFilename {
 		// Try to cut at word boundary
 		words := strings.Split(filename, "-")
 		var truncated strings.Builder
 		currentLength := 0
 
 		for _, word := range words {
-			if currentLength+len(word)+1 > constants.MaxFilenameLen {
+			if currentLength+len(word)+1 > c.maxFilename {
 				break
 			}
 			if truncated.Len() > 0 {
@@ -289,33 +527,43 @@ func (c *Collector) createSafeFilename(title string) string {
 		filename = truncated.String()
 
 		// If still too long, just truncate
-		if len(filename) > constants.MaxFilenameLen {
-			filename = filename[:constants.MaxFilenameLen]
+		if len(filename) > c.maxFilename {
+			filename = filename[:c.maxFilename]
 		}
 	}
 
 	// Ensure we have a valid filename
 	if filename == "" || filename == "-" {
-		filename = "episode-" + fmt.Sprintf("%d", time.Now().Unix())
+		filename = "episode-" + fmt.Sprintf("%d", c.now().Unix())
 	}
 
 	return filename
 }
 
+// CCMAAudio represents an audio file entry in a CCMA API item
+type CCMAAudio struct {
+	Text   string `json:"text"`
+	Format string `json:"format"`
+	Durada string `json:"durada"`
+}
+
+// CCMAImage represents an image entry in a CCMA API item
+type CCMAImage struct {
+	Text string `json:"text"`
+	Mida string `json:"mida"`
+	Alt  string `json:"alt"`
+}
+
 // CCMAAudioResponse represents the actual response from CCMA API for single episode
 type CCMAAudioResponse struct {
 	Resposta struct {
 		Status string `json:"status"`
 		Item   struct {
-			Durada    string `json:"durada"`
-			Entradeta string `json:"entradeta"`
-			Titol     string `json:"titol"`
-			Audios    []struct {
-				Text   string `json:"text"`
-				Format string `json:"format"`
-				Durada string `json:"durada"`
-			} `json:"audios"`
-			DataPublicacio string `json:"data_publicacio"`
+			Durada         string      `json:"durada"`
+			Entradeta      string      `json:"entradeta"`
+			Titol          string      `json:"titol"`
+			Audios         []CCMAAudio `json:"audios"`
+			DataPublicacio string      `json:"data_publicacio"`
 		} `json:"item"`
 	} `json:"resposta"`
 }
@@ -327,21 +575,13 @@ type CCMAListResponse struct {
 		Items  struct {
 			Num  int `json:"num"`
 			Item []struct {
-				ID             int    `json:"id"`
-				Titol          string `json:"titol"`
-				Entradeta      string `json:"entradeta"`
-				DataPublicacio string `json:"data_publicacio"`
-				Durada         string `json:"durada"`
-				Imatges        []struct {
-					Text string `json:"text"`
-					Mida string `json:"mida"`
-					Alt  string `json:"alt"`
-				} `json:"imatges"`
-				Audios []struct {
-					Text   string `json:"text"`
-					Format string `json:"format"`
-					Durada string `json:"durada"`
-				} `json:"audios"`
+				ID             int         `json:"id"`
+				Titol          string      `json:"titol"`
+				Entradeta      string      `json:"entradeta"`
+				DataPublicacio string      `json:"data_publicacio"`
+				Durada         string      `json:"durada"`
+				Imatges        []CCMAImage `json:"imatges"`
+				Audios         []CCMAAudio `json:"audios"`
 			} `json:"item"`
 		} `json:"items"`
 		Paginacio struct {
@@ -353,52 +593,110 @@ type CCMAListResponse struct {
 	} `json:"resposta"`
 }
 
-// extractAudioURL fetches the real audio URL from CCMA API
-func (c *Collector) extractAudioURL(episodeID string) (string, error) {
+// extractAudioRenditions fetches the audio files of an episode from the CCMA API
+func (c *Collector) extractAudioRenditions(ctx context.Context, episodeID string) ([]AudioRendition, error) {
 	// Construct CCMA API URL
 	apiURL := fmt.Sprintf("%s%s?_format=json&id=%s&origen=item&pagina=1&sdom=img&version=%s&cache=%s&https=true&master=yes",
-		constants.CCMAAPIBaseURL, constants.AudiosAPIEndpoint, episodeID, constants.APIVersion, constants.CacheSeconds)
+		c.apiBaseURL, constants.AudiosAPIEndpoint, episodeID, constants.APIVersion, constants.CacheSeconds)
 
 	// Make request to CCMA API
-	resp, err := c.client.Get(apiURL)
+	start := time.Now()
+	resp, err := c.get(ctx, apiURL)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch API data: %w", err)
+		return nil, fmt.Errorf("failed to fetch API data: %w", err)
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			log.Printf("Failed to close response body: %v", err)
+			slog.Warn("Failed to close response body", "error", err)
 		}
 	}()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API returned status %d", resp.StatusCode)
+		return nil, metrics.WithClass(metrics.ClassHTTPStatus, fmt.Errorf("API returned status %d", resp.StatusCode))
 	}
 
 	// Parse JSON response
 	var audioResp CCMAAudioResponse
-	if err := json.NewDecoder(resp.Body).Decode(&audioResp); err != nil {
-		return "", fmt.Errorf("failed to parse API response: %w", err)
+	err = json.NewDecoder(resp.Body).Decode(&audioResp)
+	c.metrics.APIRequest("item", time.Since(start))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse API response: %w", err)
 	}
 
 	// Check if response is valid
 	if audioResp.Resposta.Status != constants.APIStatusOK {
-		return "", fmt.Errorf("API returned status: %s", audioResp.Resposta.Status)
+		return nil, metrics.WithClass(metrics.ClassAPI, fmt.Errorf("API returned status: %s", audioResp.Resposta.Status))
 	}
 
-	// Extract audio file URL from the audios array
+	// Extract audio file URLs from the audios array
 	if len(audioResp.Resposta.Item.Audios) == 0 {
-		return "", fmt.Errorf("no audio files found in API response")
+		return nil, metrics.WithClass(metrics.ClassAPI, fmt.Errorf("no audio files found in API response"))
 	}
 
-	// Get the first audio file (usually MP3)
-	audioFile := audioResp.Resposta.Item.Audios[0]
-	if audioFile.Text == "" {
-		return "", fmt.Errorf("audio file path is empty")
+	renditions := c.audioRenditions(audioResp.Resposta.Item.Audios)
+	if len(renditions) == 0 {
+		return nil, metrics.WithClass(metrics.ClassAPI, fmt.Errorf("audio file path is empty"))
 	}
 
-	// Construct full URL - the API returns relative path like "mp3/8/1/1719914131118.mp3"
-	fullAudioURL := fmt.Sprintf("%s/%s", constants.CCMAMediaBaseURL, audioFile.Text)
+	return renditions, nil
+}
+
+// ResolveAudio queries the single-item API for an episode and returns the preferred
+// audio URL together with every rendition offered. It is only needed when the
+// listing had no usable audio, so every call counts as a retry.
+func (c *Collector) ResolveAudio(ctx context.Context, episodeID string) (string, []AudioRendition, error) {
+	c.metrics.Retry("audio_resolve")
 
-	log.Printf("Successfully extracted audio URL for episode %s: %s", episodeID, fullAudioURL)
-	return fullAudioURL, nil
+	renditions, err := c.extractAudioRenditions(ctx, episodeID)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.metrics.Fail("resolve", err)
+		}
+		return "", nil, err
+	}
+
+	selected, ok := SelectAudioRendition(renditions, c.preference)
+	if !ok {
+		err := metrics.WithClass(metrics.ClassAPI, fmt.Errorf("no usable audio rendition"))
+		c.metrics.Fail("resolve", err)
+		return "", renditions, err
+	}
+
+	slog.Debug("Extracted audio URL", "id", episodeID, "url", selected.URL, "format", selected.Format)
+	return selected.URL, renditions, nil
+}
+
+// RankAudio returns the renditions with a URL, the preferred one first
+func (c *Collector) RankAudio(renditions []AudioRendition) []AudioRendition {
+	return RankAudioRenditions(renditions, c.preference)
+}
+
+// get sends a GET request bound to the context
+func (c *Collector) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.client.Do(req)
+}
+
+// audioRenditions converts API audio entries into renditions with absolute URLs
+func (c *Collector) audioRenditions(audios []CCMAAudio) []AudioRendition {
+	var renditions []AudioRendition
+	for _, audio := range audios {
+		if audio.Text == "" {
+			continue
+		}
+		// The API returns relative paths like "mp3/8/1/1719914131118.mp3"
+		renditions = append(renditions, newAudioRendition(c.audioURL(audio.Text), audio.Format, audio.Durada))
+	}
+	return renditions
+}
+
+// audioURL builds an absolute audio URL from the text returned by the API
+func (c *Collector) audioURL(audioText string) string {
+	if strings.HasPrefix(audioText, "http://") || strings.HasPrefix(audioText, "https://") {
+		return audioText
+	}
+	return fmt.Sprintf("%s/%s", c.mediaBaseURL, audioText)
 }
@@ -2,6 +2,9 @@ package collector
 
 import (
 	"testing"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/constants"
 )
 
 func TestImageURLConstruction(t *testing.T) {
@@ -101,3 +104,146 @@ func TestAudioURLConstruction(t *testing.T) {
 		})
 	}
 }
+
+func TestEpisodeItemID(t *testing.T) {
+	tests := []struct {
+		link     string
+		expected string
+	}{
+		{"https://www.3cat.cat/3cat/en-guardia/audio/99527/", "99527"},
+		{"https://www.3cat.cat/3cat/en-guardia/audio/99527", "99527"},
+		{"https://www.3cat.cat/3cat/en-guardia/", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		ep := Episode{Link: tt.link}
+		if got := ep.ItemID(); got != tt.expected {
+			t.Errorf("ItemID(%q): expected %q, got %q", tt.link, tt.expected, got)
+		}
+	}
+}
+
+func TestEpisodeNumberAndDate(t *testing.T) {
+	ep := Episode{Title: "1245 - La batalla de l'Ebre", Date: "07/09/2025 00:01:00"}
+	if got := ep.Number(); got != 1245 {
+		t.Errorf("Number: expected 1245, got %d", got)
+	}
+	if got := ep.PublishedAt(); !got.Equal(time.Date(2025, 9, 7, 0, 1, 0, 0, time.UTC)) {
+		t.Errorf("PublishedAt: unexpected %v", got)
+	}
+
+	ep = Episode{Title: "Especial Sant Jordi", Date: "ahir"}
+	if got := ep.Number(); got != 0 {
+		t.Errorf("Number without prefix: expected 0, got %d", got)
+	}
+	if got := ep.PublishedAt(); !got.IsZero() {
+		t.Errorf("PublishedAt of an invalid date: expected zero time, got %v", got)
+	}
+}
+
+func TestAudioRetryDue(t *testing.T) {
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	fallback := "https://example.com/failed-audio-123.mp3"
+
+	tests := []struct {
+		name     string
+		episode  Episode
+		expected bool
+	}{
+		{
+			name:     "Real audio URL",
+			episode:  Episode{AudioURL: "https://img.3cat.cat/multimedia/mp3/1.mp3"},
+			expected: false,
+		},
+		{
+			name:     "Never attempted",
+			episode:  Episode{AudioURL: fallback},
+			expected: true,
+		},
+		{
+			name:     "First failure within backoff",
+			episode:  Episode{AudioURL: fallback, AudioFailures: 1, LastAudioAttempt: now.Add(-12 * time.Hour).Format(time.RFC3339)},
+			expected: false,
+		},
+		{
+			name:     "First failure after backoff",
+			episode:  Episode{AudioURL: fallback, AudioFailures: 1, LastAudioAttempt: now.Add(-25 * time.Hour).Format(time.RFC3339)},
+			expected: true,
+		},
+		{
+			name:     "Third failure doubles backoff",
+			episode:  Episode{AudioURL: fallback, AudioFailures: 3, LastAudioAttempt: now.Add(-72 * time.Hour).Format(time.RFC3339)},
+			expected: false,
+		},
+		{
+			name:     "Too many failures",
+			episode:  Episode{AudioURL: fallback, AudioFailures: 5, LastAudioAttempt: now.Add(-365 * 24 * time.Hour).Format(time.RFC3339)},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.episode.AudioRetryDue(now); got != tt.expected {
+				t.Errorf("Test %s failed: expected %v, got %v", tt.name, tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestEpisodeUpdate(t *testing.T) {
+	stored := Episode{
+		Title:    "1245 - La batalla de l'Ebre",
+		AudioURL: "https://example.cat/1245.mp3",
+		Filename: "1245-la-batalla-de-l-ebre.mp3",
+		History:  []HistoryEvent{{At: "2025-01-01T00:00:00Z", Event: EventFirstSeen}},
+	}
+
+	fresh := stored
+	fresh.History = nil
+	fresh.Description = "Juliol de 1938"
+	fresh.Filename = "retitled.mp3"
+	updated, events := stored.Update(fresh, "2025-02-01T00:00:00Z")
+	if len(events) != 1 || events[0].Field != "description" || events[0].New != "Juliol de 1938" {
+		t.Fatalf("Update events = %+v", events)
+	}
+	if updated.Description != "Juliol de 1938" || updated.Filename != stored.Filename {
+		t.Errorf("Update kept %q and file %q", updated.Description, updated.Filename)
+	}
+	if updated.FirstSeen() != "2025-01-01T00:00:00Z" || updated.LastModified() != "2025-02-01T00:00:00Z" {
+		t.Errorf("FirstSeen = %q, LastModified = %q", updated.FirstSeen(), updated.LastModified())
+	}
+	if len(stored.History) != 1 {
+		t.Errorf("Update modified the stored history: %+v", stored.History)
+	}
+
+	// A new image format changes the extension of the stored image
+	stored.Image = "https://example.cat/1245.jpg"
+	stored.ImageFilename = "1245-la-batalla-de-l-ebre.jpg"
+	fresh = stored
+	fresh.Image = "https://example.cat/1245.webp"
+	fresh.ImageFilename = "retitled.webp"
+	if updated, _ := stored.Update(fresh, "2025-02-01T00:00:00Z"); updated.ImageFilename != "1245-la-batalla-de-l-ebre.webp" {
+		t.Errorf("Expected the image name to follow the new format, got %q", updated.ImageFilename)
+	}
+	fresh.Image = "https://example.cat/1245-large.jpg"
+	if updated, _ := stored.Update(fresh, "2025-02-01T00:00:00Z"); updated.ImageFilename != stored.ImageFilename {
+		t.Errorf("Expected the image name to be kept, got %q", updated.ImageFilename)
+	}
+	stored.Image, stored.ImageFilename = "", ""
+
+	// The placeholder never replaces a real audio URL
+	fresh = stored
+	fresh.AudioURL = "https://example.cat/" + constants.FailedAudioKeyword + ".mp3"
+	if _, events := stored.Update(fresh, "2025-02-01T00:00:00Z"); len(events) != 0 {
+		t.Errorf("Expected no changes for a fallback audio URL, got %+v", events)
+	}
+
+	// A lost episode listed again is upstream
+	stored.Status = StatusLost
+	updated, events = stored.Update(Episode{Title: stored.Title, AudioURL: stored.AudioURL}, "2025-03-01T00:00:00Z")
+	if len(events) != 1 || updated.Status != StatusUpstream || !updated.RemoteAudio() {
+		t.Errorf("Expected the status to change to upstream, got %q and %+v", updated.Status, events)
+	}
+}
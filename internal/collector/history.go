@@ -0,0 +1,116 @@
+package collector
+
+import (
+	"path"
+	"strings"
+)
+
+// History events of an episode
+const (
+	EventFirstSeen       = "first_seen"       // The episode was stored for the first time
+	EventFieldChanged    = "field_changed"    // A metadata field changed from Old to New
+	EventMediaDownloaded = "media_downloaded" // The Field media (audio or image) was downloaded to New
+	EventMediaFailed     = "media_failed"     // Downloading the Field media failed with Error
+)
+
+// HistoryEvent is an entry of the change log of an episode
+type HistoryEvent struct {
+	At    string `json:"at"` // RFC 3339 time of the event
+	Event string `json:"event"`
+	Field string `json:"field,omitempty"` // Changed field, or audio and image for media events
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// trackedFields are the metadata fields whose changes are recorded, by JSON name
+var trackedFields = []struct {
+	name  string
+	value func(e *Episode) *string
+}{
+	{"title", func(e *Episode) *string { return &e.Title }},
+	{"description", func(e *Episode) *string { return &e.Description }},
+	{"duration", func(e *Episode) *string { return &e.Duration }},
+	{"date", func(e *Episode) *string { return &e.Date }},
+	{"link", func(e *Episode) *string { return &e.Link }},
+	{"audio_url", func(e *Episode) *string { return &e.AudioURL }},
+	{"image", func(e *Episode) *string { return &e.Image }},
+	{"image_alt", func(e *Episode) *string { return &e.ImageAlt }},
+	{"status", func(e *Episode) *string { return &e.Status }},
+}
+
+// Changes returns a field_changed event for every tracked field that differs
+// between two versions of an episode
+func Changes(old, new Episode, at string) []HistoryEvent {
+	var events []HistoryEvent
+	for _, field := range trackedFields {
+		if before, after := *field.value(&old), *field.value(&new); before != after {
+			events = append(events, HistoryEvent{At: at, Event: EventFieldChanged, Field: field.name, Old: before, New: after})
+		}
+	}
+	return events
+}
+
+// Update returns the stored episode with the metadata of a fresh scrape and
+// the events of the changes. The file names are kept so the stored media
+// stays with the episode, except for the extension of an image whose format
+// changed, and a real audio URL is never replaced by the placeholder.
+func (e Episode) Update(fresh Episode, at string) (Episode, []HistoryEvent) {
+	if fresh.HasFallbackAudio() && !e.HasFallbackAudio() {
+		fresh.AudioURL = e.AudioURL
+		fresh.AudioRenditions = e.AudioRenditions
+	}
+	// A scraped episode is listed again, unchecked episodes stay unchecked
+	fresh.Status = ""
+	if e.Status != "" {
+		fresh.Status = StatusUpstream
+	}
+
+	events := Changes(e, fresh, at)
+	if len(events) == 0 {
+		return e, nil
+	}
+
+	updated := e
+	for _, field := range trackedFields {
+		*field.value(&updated) = *field.value(&fresh)
+	}
+	if updated.Image != e.Image {
+		// The stored image name follows the format of the new image
+		switch ext := imageExtension(updated.Image); {
+		case updated.ImageFilename == "":
+			updated.ImageFilename = fresh.ImageFilename
+		case updated.Image != "" && ext != path.Ext(updated.ImageFilename):
+			updated.ImageFilename = strings.TrimSuffix(updated.ImageFilename, path.Ext(updated.ImageFilename)) + ext
+		}
+	}
+	if updated.AudioURL != e.AudioURL {
+		// A new audio URL starts the repair bookkeeping over
+		updated.AudioRenditions = fresh.AudioRenditions
+		updated.AudioFailures = fresh.AudioFailures
+		updated.LastAudioAttempt = fresh.LastAudioAttempt
+	}
+	updated.History = append(append([]HistoryEvent(nil), e.History...), events...)
+	return updated, events
+}
+
+// FirstSeen returns when the episode was first stored, empty if unknown
+func (e Episode) FirstSeen() string {
+	for _, event := range e.History {
+		if event.Event == EventFirstSeen {
+			return event.At
+		}
+	}
+	return ""
+}
+
+// LastModified returns when the episode metadata last changed, or when it was
+// first stored if it never did; empty if unknown
+func (e Episode) LastModified() string {
+	for i := len(e.History) - 1; i >= 0; i-- {
+		if event := e.History[i]; event.Event == EventFieldChanged || event.Event == EventFirstSeen {
+			return event.At
+		}
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+package collector
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+)
+
+var imageSizeRegex = regexp.MustCompile(`(\d+)\s*[xX×]\s*(\d+)`)
+
+// imageArea returns the pixel area described by a "Mida" field such as "670x378".
+// A single number is taken as the width of a square image, anything else is 0.
+func imageArea(mida string) int {
+	if matches := imageSizeRegex.FindStringSubmatch(mida); len(matches) == 3 {
+		width, errW := strconv.Atoi(matches[1])
+		height, errH := strconv.Atoi(matches[2])
+		if errW == nil && errH == nil {
+			return width * height
+		}
+	}
+
+	if side, err := strconv.Atoi(strings.TrimSpace(mida)); err == nil {
+		return side * side
+	}
+
+	return 0
+}
+
+// SelectLargestImage picks the image with the largest "Mida" among the API entries.
+// When no size can be parsed the first non-empty image is returned.
+func SelectLargestImage(images []CCMAImage) (CCMAImage, bool) {
+	var best CCMAImage
+	bestArea := -1
+
+	for _, image := range images {
+		if image.Text == "" {
+			continue
+		}
+		if area := imageArea(image.Mida); area > bestArea {
+			best = image
+			bestArea = area
+		}
+	}
+
+	return best, bestArea >= 0
+}
+
+// imageURL builds an absolute image URL from the text returned by the API
+func (c *Collector) imageURL(imageText string) string {
+	// Check if the image text is already a full URL
+	if strings.HasPrefix(imageText, "http://") || strings.HasPrefix(imageText, "https://") {
+		return imageText
+	}
+	// It's an absolute path, prepend only the scheme and host of the media server
+	if strings.HasPrefix(imageText, "/") {
+		if u, err := url.Parse(c.mediaBaseURL); err == nil && u.Host != "" {
+			return fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, imageText)
+		}
+	}
+	// It's a relative path, prepend the full base URL
+	return fmt.Sprintf("%s/%s", c.mediaBaseURL, strings.TrimPrefix(imageText, "/"))
+}
+
+// imageExtension returns the local file extension for an image URL, defaulting to jpg
+func imageExtension(imageURL string) string {
+	p := imageURL
+	if u, err := url.Parse(imageURL); err == nil {
+		p = u.Path
+	}
+
+	switch strings.ToLower(path.Ext(p)) {
+	case constants.PNGExtension:
+		return constants.PNGExtension
+	case constants.WebPExtension:
+		return constants.WebPExtension
+	default:
+		return constants.JPGExtension
+	}
+}
@@ -0,0 +1,51 @@
+package collector
+
+import (
+	"testing"
+)
+
+func TestSelectLargestImage(t *testing.T) {
+	images := []CCMAImage{
+		{Text: "jpg/1/small.jpg", Mida: "320x180", Alt: "small"},
+		{Text: "jpg/1/large.jpg", Mida: "1280x720", Alt: "large"},
+		{Text: "", Mida: "4000x4000"},
+		{Text: "jpg/1/medium.jpg", Mida: "670x378", Alt: "medium"},
+	}
+
+	selected, ok := SelectLargestImage(images)
+	if !ok {
+		t.Fatal("Expected an image to be selected")
+	}
+	if selected.Alt != "large" {
+		t.Errorf("Expected the large image, got %s", selected.Text)
+	}
+
+	// Unparseable sizes fall back to the first image
+	selected, ok = SelectLargestImage([]CCMAImage{{Text: "a.jpg", Mida: "gran"}, {Text: "b.jpg"}})
+	if !ok || selected.Text != "a.jpg" {
+		t.Errorf("Expected the first image, got %s", selected.Text)
+	}
+
+	if _, ok := SelectLargestImage(nil); ok {
+		t.Error("Expected no image to be selected from an empty list")
+	}
+}
+
+func TestImageExtension(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://img.3cat.cat/multimedia/jpg/6/2/1472799754526.jpg", ".jpg"},
+		{"https://img.3cat.cat/multimedia/png/6/2/1472799754526.PNG", ".png"},
+		{"https://img.3cat.cat/multimedia/webp/6/2/1472799754526.webp?w=100", ".webp"},
+		{"https://img.3cat.cat/multimedia/jpg/6/2/1472799754526.jpeg", ".jpg"},
+		{"https://img.3cat.cat/png/image", ".jpg"},
+	}
+
+	for _, tt := range tests {
+		if got := imageExtension(tt.url); got != tt.expected {
+			t.Errorf("imageExtension(%q): expected %s, got %s", tt.url, tt.expected, got)
+		}
+	}
+}
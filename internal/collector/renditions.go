@@ -0,0 +1,161 @@
+package collector
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+)
+
+// AudioRendition describes one of the audio files offered by the API for an episode
+type AudioRendition struct {
+	URL      string `json:"url"`
+	Format   string `json:"format,omitempty"`
+	Duration string `json:"duration,omitempty"`
+	Bitrate  int    `json:"bitrate,omitempty"` // kbps, when it can be inferred
+}
+
+// AudioPreference controls which rendition is chosen as the episode audio
+type AudioPreference struct {
+	Formats  []string // Preferred formats, most wanted first
+	Bitrate  int      // Preferred bitrate in kbps (0 = highest available)
+	Smallest bool     // Pick the lowest bitrate regardless of format
+}
+
+// DefaultAudioPreference returns the preference used when none is configured
+func DefaultAudioPreference() AudioPreference {
+	return AudioPreference{
+		Formats: append([]string(nil), constants.AudioFormatPreference...),
+	}
+}
+
+var (
+	formatBitrateRegex = regexp.MustCompile(`(\d{2,3})`)
+	urlBitrateRegex    = regexp.MustCompile(`(?i)(?:^|[^0-9])(\d{2,3})k(?:bps)?(?:[^a-z0-9]|$)`)
+)
+
+// newAudioRendition builds a rendition from the raw API fields
+func newAudioRendition(audioURL, format, duration string) AudioRendition {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(path.Ext(audioURL)), ".")
+	}
+
+	return AudioRendition{
+		URL:      audioURL,
+		Format:   format,
+		Duration: duration,
+		Bitrate:  parseBitrate(format, audioURL),
+	}
+}
+
+// parseBitrate infers the bitrate from the format label (e.g. "mp3_128")
+// or from the file name (e.g. "episode_64k.mp3")
+func parseBitrate(format, audioURL string) int {
+	if matches := formatBitrateRegex.FindStringSubmatch(format); len(matches) > 1 {
+		if bitrate, err := strconv.Atoi(matches[1]); err == nil {
+			return bitrate
+		}
+	}
+
+	if matches := urlBitrateRegex.FindStringSubmatch(path.Base(audioURL)); len(matches) > 1 {
+		if bitrate, err := strconv.Atoi(matches[1]); err == nil {
+			return bitrate
+		}
+	}
+
+	return 0
+}
+
+// Extension returns the file extension of the rendition audio, mp3 when the
+// format is unknown
+func (r AudioRendition) Extension() string {
+	switch {
+	case strings.HasPrefix(r.Format, "aac"):
+		return constants.AACExtension
+	case strings.HasPrefix(r.Format, "m4a"):
+		return constants.M4AExtension
+	case strings.HasPrefix(r.Format, "mp4"):
+		return constants.MP4Extension
+	default:
+		return constants.MP3Extension
+	}
+}
+
+// audioExtension returns the file extension of the audio at audioURL, from
+// the format of its rendition or else from the URL
+func audioExtension(audioURL string, renditions []AudioRendition) string {
+	for _, r := range renditions {
+		if r.URL == audioURL {
+			return r.Extension()
+		}
+	}
+	return newAudioRendition(audioURL, "", "").Extension()
+}
+
+// SelectAudioRendition picks the rendition that best matches the preference
+func SelectAudioRendition(renditions []AudioRendition, pref AudioPreference) (AudioRendition, bool) {
+	candidates := RankAudioRenditions(renditions, pref)
+	if len(candidates) == 0 {
+		return AudioRendition{}, false
+	}
+	return candidates[0], true
+}
+
+// RankAudioRenditions returns the renditions with a URL, the best match of the
+// preference first
+func RankAudioRenditions(renditions []AudioRendition, pref AudioPreference) []AudioRendition {
+	var candidates []AudioRendition
+	for _, r := range renditions {
+		if r.URL != "" {
+			candidates = append(candidates, r)
+		}
+	}
+
+	formatRank := func(r AudioRendition) int {
+		for i, format := range pref.Formats {
+			if strings.HasPrefix(r.Format, strings.ToLower(format)) {
+				return i
+			}
+		}
+		return len(pref.Formats)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+
+		if pref.Smallest {
+			// Unknown bitrates sort last, they may well be the largest files
+			if (a.Bitrate == 0) != (b.Bitrate == 0) {
+				return a.Bitrate != 0
+			}
+			if a.Bitrate != b.Bitrate {
+				return a.Bitrate < b.Bitrate
+			}
+			return formatRank(a) < formatRank(b)
+		}
+
+		if ra, rb := formatRank(a), formatRank(b); ra != rb {
+			return ra < rb
+		}
+		if pref.Bitrate > 0 {
+			return bitrateDistance(a.Bitrate, pref.Bitrate) < bitrateDistance(b.Bitrate, pref.Bitrate)
+		}
+		return a.Bitrate > b.Bitrate
+	})
+
+	return candidates
+}
+
+func bitrateDistance(bitrate, preferred int) int {
+	if bitrate == 0 {
+		return preferred
+	}
+	if bitrate > preferred {
+		return bitrate - preferred
+	}
+	return preferred - bitrate
+}
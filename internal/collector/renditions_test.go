@@ -0,0 +1,77 @@
+package collector
+
+import (
+	"testing"
+)
+
+func TestParseBitrate(t *testing.T) {
+	tests := []struct {
+		format   string
+		url      string
+		expected int
+	}{
+		{"mp3_128", "https://img.3cat.cat/multimedia/mp3/8/1/1719914131118.mp3", 128},
+		{"mp3", "https://img.3cat.cat/multimedia/mp3/8/1/1719914131118_64k.mp3", 64},
+		{"mp3", "https://img.3cat.cat/multimedia/mp3/8/1/1719914131118.mp3", 0},
+		{"aac", "", 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseBitrate(tt.format, tt.url); got != tt.expected {
+			t.Errorf("parseBitrate(%q, %q): expected %d, got %d", tt.format, tt.url, tt.expected, got)
+		}
+	}
+}
+
+func TestSelectAudioRendition(t *testing.T) {
+	renditions := []AudioRendition{
+		{URL: "https://example.com/a.m4a", Format: "m4a", Bitrate: 96},
+		{URL: "https://example.com/b.mp3", Format: "mp3", Bitrate: 64},
+		{URL: "https://example.com/c.mp3", Format: "mp3", Bitrate: 192},
+		{URL: "https://example.com/d.aac", Format: "aac", Bitrate: 32},
+		{URL: "", Format: "mp3", Bitrate: 320},
+	}
+
+	tests := []struct {
+		name     string
+		pref     AudioPreference
+		expected string
+	}{
+		{
+			name:     "Default prefers highest bitrate mp3",
+			pref:     DefaultAudioPreference(),
+			expected: "https://example.com/c.mp3",
+		},
+		{
+			name:     "Preferred bitrate",
+			pref:     AudioPreference{Formats: []string{"mp3"}, Bitrate: 64},
+			expected: "https://example.com/b.mp3",
+		},
+		{
+			name:     "Format order",
+			pref:     AudioPreference{Formats: []string{"m4a", "mp3"}},
+			expected: "https://example.com/a.m4a",
+		},
+		{
+			name:     "Smallest file",
+			pref:     AudioPreference{Formats: []string{"mp3"}, Smallest: true},
+			expected: "https://example.com/d.aac",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, ok := SelectAudioRendition(renditions, tt.pref)
+			if !ok {
+				t.Fatalf("Test %s failed: no rendition selected", tt.name)
+			}
+			if selected.URL != tt.expected {
+				t.Errorf("Test %s failed: expected %s, got %s", tt.name, tt.expected, selected.URL)
+			}
+		})
+	}
+
+	if _, ok := SelectAudioRendition(nil, DefaultAudioPreference()); ok {
+		t.Error("Expected no rendition to be selected from an empty list")
+	}
+}
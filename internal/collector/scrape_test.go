@@ -0,0 +1,155 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/fake3cat"
+)
+
+func newFakeCollector(srv *fake3cat.Server) *Collector {
+	return NewCollectorWithOptions(Options{
+		APIBaseURL:   srv.APIBaseURL(),
+		SiteURL:      srv.SiteURL(),
+		MediaBaseURL: srv.MediaBaseURL(),
+		Client:       srv.Client(),
+		Now: func() time.Time {
+			return time.Date(2025, 9, 8, 10, 0, 0, 0, time.UTC)
+		},
+	})
+}
+
+func TestScrapeEpisodesFromFakeServer(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+
+	episodes, err := newFakeCollector(srv).ScrapeEpisodes(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to scrape episodes: %v", err)
+	}
+
+	if len(episodes) != 5 {
+		t.Fatalf("Expected 5 episodes across both pages, got %d", len(episodes))
+	}
+
+	first := episodes[0]
+	if first.Title != "1245 - La batalla de l'Ebre" {
+		t.Errorf("Unexpected cleaned title: %q", first.Title)
+	}
+	if first.ItemID() != "1001" {
+		t.Errorf("Expected item ID 1001, got %q", first.ItemID())
+	}
+	if !strings.HasSuffix(first.Image, "1001_1280x720.jpg") || first.ImageAlt != "Soldats travessant l'Ebre" {
+		t.Errorf("Expected the largest image to be selected, got %s (%s)", first.Image, first.ImageAlt)
+	}
+
+	// Highest bitrate rendition wins by default
+	if !strings.HasSuffix(episodes[1].AudioURL, "1002_128k.mp3") || len(episodes[1].AudioRenditions) != 2 {
+		t.Errorf("Expected the 128k rendition, got %s", episodes[1].AudioURL)
+	}
+	if episodes[1].Image != srv.URL+"/multimedia/png/1/0/1002.png" || episodes[1].ImageFilename != "1244-els-almogàvers.png" {
+		t.Errorf("Unexpected image for absolute path: %s (%s)", episodes[1].Image, episodes[1].ImageFilename)
+	}
+
+	// Missing audio in the listing is resolved through the item API
+	if !strings.HasSuffix(episodes[2].AudioURL, "1003.mp3") {
+		t.Errorf("Expected audio from the item API, got %s", episodes[2].AudioURL)
+	}
+
+	// Missing everywhere falls back to the placeholder
+	if !episodes[3].HasFallbackAudio() || episodes[3].AudioFailures != 1 || episodes[3].LastAudioAttempt != "2025-09-08T10:00:00Z" {
+		t.Errorf("Expected fallback audio with one failure, got %+v", episodes[3])
+	}
+}
+
+func TestScrapeEpisodesAudioExtension(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+
+	c := newFakeCollector(srv)
+	c.SetAudioPreference(AudioPreference{Formats: []string{"m4a", "mp3"}})
+	episodes, err := c.ScrapeEpisodes(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to scrape episodes: %v", err)
+	}
+
+	// The file name follows the format of the chosen rendition
+	if !strings.HasSuffix(episodes[2].AudioURL, "1003.m4a") || episodes[2].Filename != "1243-la-pesta-negra.m4a" {
+		t.Errorf("Expected the m4a rendition stored as .m4a, got %s (%s)", episodes[2].AudioURL, episodes[2].Filename)
+	}
+	if episodes[0].Filename != "1245-la-batalla-de-l-ebre.mp3" {
+		t.Errorf("Expected an mp3 file name without an m4a rendition, got %s", episodes[0].Filename)
+	}
+}
+
+func TestScrapeEpisodesErrorPages(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+	}{
+		{"Server error", 500},
+		{"HTML error page", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := fake3cat.NewServer()
+			defer srv.Close()
+			srv.FailPage(2, tt.status)
+
+			if _, err := newFakeCollector(srv).ScrapeEpisodes(context.Background()); err == nil {
+				t.Errorf("Test %s failed: expected an error for page 2", tt.name)
+			}
+		})
+	}
+}
+
+func TestScrapeEpisodesMaxPages(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+
+	episodes, err := newFakeCollector(srv).ScrapeEpisodesWithLimit(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Failed to scrape episodes: %v", err)
+	}
+	if len(episodes) != 3 {
+		t.Errorf("Expected 3 episodes from the first page, got %d", len(episodes))
+	}
+}
+
+func TestScrapeNewEpisodes(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+
+	// Nothing new on the first page, the second one is never fetched
+	episodes, err := newFakeCollector(srv).ScrapeNewEpisodes(context.Background(), func(Episode) bool { return true })
+	if err != nil {
+		t.Fatalf("Failed to scrape episodes: %v", err)
+	}
+	if len(episodes) != 3 {
+		t.Errorf("Expected the 3 episodes of the first page, got %d", len(episodes))
+	}
+
+	// One unknown episode on the first page is enough to continue
+	episodes, err = newFakeCollector(srv).ScrapeNewEpisodes(context.Background(), func(ep Episode) bool { return ep.Number() != 1243 })
+	if err != nil {
+		t.Fatalf("Failed to scrape episodes: %v", err)
+	}
+	if len(episodes) != 5 {
+		t.Errorf("Expected every episode, got %d", len(episodes))
+	}
+}
+
+func TestScrapeEpisodesCancelled(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := newFakeCollector(srv).ScrapeEpisodes(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a cancelled scrape to fail with context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,345 @@
+// Package config loads the scraper configuration from a JSON file with
+// environment variable overrides.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/backend"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+	"github.com/p4u/enguardia-arxiu/internal/logging"
+)
+
+// EnvPrefix is the prefix of environment variables overriding configuration values.
+// The rest of the name is the JSON path in upper case joined by underscores,
+// e.g. ENGUARDIA_COLLECTOR_REQUEST_DELAY=2s.
+const EnvPrefix = "ENGUARDIA"
+
+// hiddenSecret replaces the backend credentials in the printed configuration
+const hiddenSecret = "********"
+
+// Config is the complete scraper configuration
+type Config struct {
+	DataDir      string `json:"data_dir"`      // Empty = programme data directory
+	OutputDir    string `json:"output_dir"`    // Webapp data output directory
+	ProgramsFile string `json:"programs_file"` // Programme registry
+	Program      string `json:"program"`       // Programme slug (empty = registry default)
+
+	Collector CollectorConfig `json:"collector"`
+	Storage   StorageConfig   `json:"storage"`
+	Generator GeneratorConfig `json:"generator"`
+	Log       LogConfig       `json:"log"`
+	Metrics   MetricsConfig   `json:"metrics"`
+	Watch     WatchConfig     `json:"watch"`
+	Hooks     HooksConfig     `json:"hooks"`
+}
+
+// CollectorConfig configures the 3Cat API client
+type CollectorConfig struct {
+	APIBaseURL    string   `json:"api_base_url"`
+	SiteURL       string   `json:"site_url"`
+	MediaBaseURL  string   `json:"media_base_url"`
+	HTTPTimeout   Duration `json:"http_timeout"`
+	RequestDelay  Duration `json:"request_delay"`
+	MaxFilename   int      `json:"max_filename"`
+	AudioFormats  []string `json:"audio_formats"`
+	AudioBitrate  int      `json:"audio_bitrate"`
+	AudioSmallest bool     `json:"audio_smallest"`
+}
+
+// StorageConfig configures media downloads
+type StorageConfig struct {
+	DownloadTimeout  Duration      `json:"download_timeout"`
+	MinAudioFileSize int64         `json:"min_audio_file_size"`
+	MinImageFileSize int64         `json:"min_image_file_size"`
+	MinDownloadSize  int64         `json:"min_download_size"`
+	Layout           string        `json:"layout"`  // flat or objects
+	Catalog          bool          `json:"catalog"` // Read the episodes through the SQLite catalogue of the data directory
+	Backend          BackendConfig `json:"backend"`
+}
+
+// BackendConfig selects where the media is stored. Remote backends keep each
+// programme under its slug inside the prefix; the metadata stays in the data
+// directory.
+type BackendConfig struct {
+	Type      string `json:"type"`     // filesystem, s3 or webdav
+	Endpoint  string `json:"endpoint"` // S3 endpoint or WebDAV collection URL
+	Bucket    string `json:"bucket"`
+	Region    string `json:"region"`
+	Prefix    string `json:"prefix"` // Path inside the bucket or collection
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	Username  string `json:"username"` // WebDAV credentials
+	Password  string `json:"password"`
+	PublicURL string `json:"public_url"` // URL of the prefix for the webapp (empty = endpoint)
+}
+
+// GeneratorConfig configures the webapp data generation
+type GeneratorConfig struct {
+	TagsFile         string      `json:"tags_file"` // Empty = programme tags file
+	ThumbnailWidth   int         `json:"thumbnail_width"`
+	ThumbnailQuality int         `json:"thumbnail_quality"`
+	RemoteThumbnails bool        `json:"remote_thumbnails"` // Build the thumbnails of images not stored locally from 3Cat
+	ProbeAudio       bool        `json:"probe_audio"`       // Check the remote audio of the episodes streamed from 3Cat
+	ProbeConcurrency int         `json:"probe_concurrency"`
+	ProbeInterval    Duration    `json:"probe_interval"`   // Minimum pause between probe requests
+	ProbeTTL         Duration    `json:"probe_ttl"`        // Age after which a cached probe result is checked again
+	SiteDir          string      `json:"site_dir"`         // Webapp directory receiving the episode pages and sitemap (empty = none)
+	SiteURL          string      `json:"site_url"`         // Public URL of the webapp
+	SiteTitle        string      `json:"site_title"`       // Webapp title (empty = programme title)
+	SiteDescription  string      `json:"site_description"` // Webapp description (empty = programme description)
+	SiteLanguage     string      `json:"site_language"`    // Webapp language (empty = programme language)
+	AudioBaseURL     string      `json:"audio_base_url"`   // URL of the local audio (empty = backend public URL or /audio)
+	Theme            ThemeConfig `json:"theme"`
+}
+
+// LogConfig configures logging and run reports
+type LogConfig struct {
+	Level     string `json:"level"`      // debug, info, warn or error
+	Format    string `json:"format"`     // text or json
+	ReportDir string `json:"report_dir"` // Directory of the JSON run reports (empty = no reports)
+}
+
+// MetricsConfig configures the metrics endpoint
+type MetricsConfig struct {
+	Addr string `json:"addr"` // Listen address of /metrics for scrape, download, repair and watch (empty = disabled)
+}
+
+// WatchConfig configures the watch command
+type WatchConfig struct {
+	Interval Duration `json:"interval"` // Pause between scrape cycles
+	Jitter   Duration `json:"jitter"`   // Maximum random delay added to the interval
+}
+
+// HooksConfig configures the notifications sent when new episodes are found
+type HooksConfig struct {
+	Webhooks   []string `json:"webhooks"`    // URLs receiving a POST with the episode JSON
+	Commands   []string `json:"commands"`    // Shell commands receiving the episode JSON on stdin
+	Retries    int      `json:"retries"`     // Attempts after the first failure
+	RetryDelay Duration `json:"retry_delay"` // Delay before the first retry, doubled on each retry
+	Timeout    Duration `json:"timeout"`     // Timeout of each attempt
+}
+
+// ThemeConfig holds the webapp colours
+type ThemeConfig struct {
+	PrimaryColor   string `json:"primary_color"`
+	SecondaryColor string `json:"secondary_color"`
+	AccentColor    string `json:"accent_color"`
+	BackgroundURL  string `json:"background_url"`
+}
+
+// Duration is a time.Duration written as a string such as "30s" in JSON
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Default returns the built-in configuration
+func Default() *Config {
+	return &Config{
+		OutputDir:    "data",
+		ProgramsFile: constants.DefaultProgramsFile,
+		Collector: CollectorConfig{
+			APIBaseURL:   constants.CCMAAPIBaseURL,
+			SiteURL:      constants.BaseURL,
+			MediaBaseURL: constants.CCMAMediaBaseURL,
+			HTTPTimeout:  Duration(constants.HTTPTimeout),
+			RequestDelay: Duration(constants.APIRequestDelay),
+			MaxFilename:  constants.MaxFilenameLen,
+			AudioFormats: append([]string(nil), constants.AudioFormatPreference...),
+		},
+		Storage: StorageConfig{
+			DownloadTimeout:  Duration(constants.DownloadTimeout),
+			MinAudioFileSize: constants.MinAudioFileSize,
+			MinImageFileSize: constants.MinImageFileSize,
+			MinDownloadSize:  constants.MinDownloadSize,
+			Layout:           constants.DefaultLayout,
+			Backend:          BackendConfig{Type: backend.TypeFilesystem},
+		},
+		Generator: GeneratorConfig{
+			ThumbnailWidth:   constants.ThumbnailWidth,
+			ThumbnailQuality: constants.ThumbnailQuality,
+			ProbeConcurrency: constants.ProbeConcurrency,
+			ProbeInterval:    Duration(constants.ProbeInterval),
+			ProbeTTL:         Duration(constants.ProbeTTL),
+			SiteURL:          constants.DefaultSiteURL,
+			Theme: ThemeConfig{
+				PrimaryColor:   constants.DefaultPrimaryColor,
+				SecondaryColor: constants.DefaultSecondaryColor,
+				AccentColor:    constants.DefaultAccentColor,
+			},
+		},
+		Watch: WatchConfig{
+			Interval: Duration(constants.WatchInterval),
+			Jitter:   Duration(constants.WatchJitter),
+		},
+		Hooks: HooksConfig{
+			Retries:    constants.HookRetries,
+			RetryDelay: Duration(constants.HookRetryDelay),
+			Timeout:    Duration(constants.HookTimeout),
+		},
+		Log: LogConfig{
+			Level:     "info",
+			Format:    logging.FormatText,
+			ReportDir: constants.DefaultReportDir,
+		},
+	}
+}
+
+// Load reads the configuration file on top of the defaults and applies the
+// environment overrides. A missing file is only an error when required.
+func Load(path string, required bool) (*Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	case os.IsNotExist(err) && !required:
+		// Defaults and environment only
+	default:
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := cfg.ApplyEnv(os.Environ()); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// ApplyEnv overrides configuration values from ENGUARDIA_* variables
+func (c *Config) ApplyEnv(environ []string) error {
+	env := make(map[string]string)
+	for _, entry := range environ {
+		if key, value, ok := strings.Cut(entry, "="); ok && strings.HasPrefix(key, EnvPrefix+"_") {
+			env[key] = value
+		}
+	}
+	if len(env) == 0 {
+		return nil
+	}
+
+	return applyEnv(reflect.ValueOf(c).Elem(), EnvPrefix, env)
+}
+
+func applyEnv(v reflect.Value, prefix string, env map[string]string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + "_" + strings.ToUpper(name)
+		fv := v.Field(i)
+
+		if fv.Kind() == reflect.Struct {
+			if err := applyEnv(fv, key, env); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := env[key]
+		if !ok {
+			continue
+		}
+		if err := setValue(fv, value); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func setValue(fv reflect.Value, value string) error {
+	if fv.Type() == reflect.TypeOf(Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		fv.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+	return nil
+}
+
+// Print writes the configuration as indented JSON, hiding the backend secrets
+func (c *Config) Print(w io.Writer) error {
+	printed := *c
+	if printed.Storage.Backend.SecretKey != "" {
+		printed.Storage.Backend.SecretKey = hiddenSecret
+	}
+	if printed.Storage.Backend.Password != "" {
+		printed.Storage.Backend.Password = hiddenSecret
+	}
+	data, err := json.MarshalIndent(&printed, "", constants.JSONIndent)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// BasePath returns the path of the public webapp URL, the base the webapp is
+// built for, e.g. /enguardia-arxiu/
+func (c *Config) BasePath() (string, error) {
+	u, err := url.Parse(c.Generator.SiteURL)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return "", fmt.Errorf("generator.site_url must be an absolute URL, got %q", c.Generator.SiteURL)
+	}
+	return strings.TrimSuffix(u.Path, "/") + "/", nil
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadMergesFileOverDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"collector": {"request_delay": "2s", "audio_bitrate": 64}, "generator": {"theme": {"primary_color": "#000000"}}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path, true)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if got := time.Duration(cfg.Collector.RequestDelay); got != 2*time.Second {
+		t.Errorf("RequestDelay = %v, want 2s", got)
+	}
+	if cfg.Collector.AudioBitrate != 64 {
+		t.Errorf("AudioBitrate = %d, want 64", cfg.Collector.AudioBitrate)
+	}
+	if cfg.Generator.Theme.PrimaryColor != "#000000" {
+		t.Errorf("PrimaryColor = %q, want #000000", cfg.Generator.Theme.PrimaryColor)
+	}
+
+	// Values absent from the file keep their defaults
+	defaults := Default()
+	if cfg.Collector.HTTPTimeout != defaults.Collector.HTTPTimeout {
+		t.Errorf("HTTPTimeout = %v, want default %v", cfg.Collector.HTTPTimeout, defaults.Collector.HTTPTimeout)
+	}
+	if cfg.Generator.Theme.SecondaryColor != defaults.Generator.Theme.SecondaryColor {
+		t.Errorf("SecondaryColor = %q, want default", cfg.Generator.Theme.SecondaryColor)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.json")
+
+	if _, err := Load(path, false); err != nil {
+		t.Errorf("optional missing file: %v", err)
+	}
+	if _, err := Load(path, true); err == nil {
+		t.Error("required missing file should fail")
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	cfg := Default()
+	err := cfg.ApplyEnv([]string{
+		"ENGUARDIA_DATA_DIR=/tmp/episodes",
+		"ENGUARDIA_COLLECTOR_REQUEST_DELAY=250ms",
+		"ENGUARDIA_COLLECTOR_AUDIO_FORMATS=aac, mp3",
+		"ENGUARDIA_COLLECTOR_AUDIO_SMALLEST=true",
+		"ENGUARDIA_STORAGE_MIN_AUDIO_FILE_SIZE=2048",
+		"ENGUARDIA_GENERATOR_THEME_ACCENT_COLOR=#ff0000",
+		"HOME=/root",
+	})
+	if err != nil {
+		t.Fatalf("ApplyEnv: %v", err)
+	}
+
+	if cfg.DataDir != "/tmp/episodes" {
+		t.Errorf("DataDir = %q", cfg.DataDir)
+	}
+	if got := time.Duration(cfg.Collector.RequestDelay); got != 250*time.Millisecond {
+		t.Errorf("RequestDelay = %v", got)
+	}
+	if len(cfg.Collector.AudioFormats) != 2 || cfg.Collector.AudioFormats[0] != "aac" || cfg.Collector.AudioFormats[1] != "mp3" {
+		t.Errorf("AudioFormats = %v", cfg.Collector.AudioFormats)
+	}
+	if !cfg.Collector.AudioSmallest {
+		t.Error("AudioSmallest not set")
+	}
+	if cfg.Storage.MinAudioFileSize != 2048 {
+		t.Errorf("MinAudioFileSize = %d", cfg.Storage.MinAudioFileSize)
+	}
+	if cfg.Generator.Theme.AccentColor != "#ff0000" {
+		t.Errorf("AccentColor = %q", cfg.Generator.Theme.AccentColor)
+	}
+
+	if err := cfg.ApplyEnv([]string{"ENGUARDIA_COLLECTOR_HTTP_TIMEOUT=soon"}); err == nil {
+		t.Error("invalid duration should fail")
+	}
+}
+
+func TestPrintHidesSecrets(t *testing.T) {
+	cfg := Default()
+	if err := cfg.ApplyEnv([]string{"ENGUARDIA_STORAGE_BACKEND_SECRET_KEY=molt-secret"}); err != nil {
+		t.Fatalf("ApplyEnv: %v", err)
+	}
+
+	var printed strings.Builder
+	if err := cfg.Print(&printed); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(printed.String(), "molt-secret") || cfg.Storage.Backend.SecretKey != "molt-secret" {
+		t.Errorf("Expected only the printed secret key to be hidden:\n%s", printed.String())
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	cfg := Default()
+	for siteURL, want := range map[string]string{
+		"https://www.dabax.net/enguardia-arxiu/":        "/enguardia-arxiu/",
+		"https://arxiu.example.cat/podcasts/en-guardia": "/podcasts/en-guardia/",
+		"https://enguardia.example.cat":                 "/",
+	} {
+		cfg.Generator.SiteURL = siteURL
+		if got, err := cfg.BasePath(); err != nil || got != want {
+			t.Errorf("BasePath of %s = %q, %v, want %q", siteURL, got, err, want)
+		}
+	}
+	cfg.Generator.SiteURL = "/enguardia-arxiu/"
+	if _, err := cfg.BasePath(); err == nil {
+		t.Error("Expected a relative site URL to be rejected")
+	}
+}
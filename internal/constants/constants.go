@@ -21,15 +21,68 @@ const (
 	EpisodeURLPattern = "/3cat/en-guardia/audio"
 )
 
+// Default audio format preference, most wanted first
+var AudioFormatPreference = []string{"mp3", "aac", "m4a", "mp4"}
+
+// Audio repair limits for episodes stuck on the fallback URL
+const (
+	MaxAudioRepairAttempts = 5              // Give up after this many failed resolutions
+	AudioRepairBackoff     = 24 * time.Hour // Wait after the first failure, doubled on each retry
+)
+
 // File extensions and formats
 const (
 	MP3Extension  = ".mp3"
+	AACExtension  = ".aac"
+	M4AExtension  = ".m4a"
+	MP4Extension  = ".mp4"
 	JSONExtension = ".json"
 	JPGExtension  = ".jpg"
 	PNGExtension  = ".png"
+	WebPExtension = ".webp"
 	TempSuffix    = ".tmp"
 )
 
+// DownloadQueueFile holds the pending downloads of an interrupted run in the data directory.
+// It has no .json extension so it is never loaded as an episode.
+const DownloadQueueFile = ".download-queue"
+
+// ScrapeQueueFile holds the pending downloads of the scrape phase, apart from
+// the download queue so that a scrape never replaces an interrupted download run
+const ScrapeQueueFile = ".download-queue-scrape"
+
+// Content-addressed media layout, inside the data directory
+const (
+	ObjectsDir   = "objects"   // Media stored once under its SHA-256
+	ManifestFile = ".manifest" // Titled file names and media URLs of each object
+)
+
+// CatalogFile is the SQLite catalogue of the episodes, inside the data directory
+const CatalogFile = ".catalog.db"
+
+// QuarantineDir receives the orphaned files moved aside by gc, inside the data directory
+const QuarantineDir = ".quarantine"
+
+// Data directory lock held while a command writes to it
+const (
+	LockFile     = ".lock"
+	StaleLockAge = time.Minute // Age after which an unreadable lock file is considered stale
+)
+
+// New episode hooks
+const (
+	HookRetries        = 3                    // Attempts after the first failure
+	HookRetryDelay     = 5 * time.Second      // Delay before the first retry, doubled on each retry
+	HookTimeout        = 30 * time.Second     // Timeout of each delivery attempt
+	HookDeadLetterFile = ".hooks-dead-letter" // Failed deliveries, one JSON line each, in the data directory
+)
+
+// Watch mode defaults
+const (
+	WatchInterval = time.Hour       // Pause between scrape cycles
+	WatchJitter   = 5 * time.Minute // Maximum random delay added to the interval
+)
+
 // File size limits and thresholds
 const (
 	MinAudioFileSize = 1024 * 1024 // 1MB minimum for valid audio files
@@ -43,6 +96,37 @@ const (
 	HTTPTimeout     = 30 * time.Second  // Standard HTTP timeout
 	DownloadTimeout = 300 * time.Second // 5 minutes for large audio files
 	APIRequestDelay = 1 * time.Second   // Delay between API requests
+	ShutdownTimeout = 10 * time.Second  // Time given to open connections when serve stops
+)
+
+// Thumbnail generation for the webapp cards
+const (
+	ThumbnailsDir    = "thumbnails" // Subdirectory of the webapp data directory
+	ThumbnailWidth   = 400          // Thumbnail width in pixels
+	ThumbnailQuality = 80           // JPEG quality for thumbnails
+)
+
+// Remote audio probing of the generator
+const (
+	ProbeCacheFile   = ".probe-cache"         // Cached probe results, in the data directory
+	ProbeConcurrency = 4                      // Probes in flight at once
+	ProbeInterval    = 100 * time.Millisecond // Minimum pause between probe requests
+	ProbeTTL         = 7 * 24 * time.Hour     // Age after which a probe result is checked again
+)
+
+// Static site files written next to the webapp
+const (
+	DefaultSiteURL  = "https://www.dabax.net/enguardia-arxiu/" // Public URL of the webapp
+	EpisodePagesDir = "episodes"                               // One index.html per episode inside
+	SitemapFile     = "sitemap.xml"
+	RobotsFile      = "robots.txt"
+)
+
+// Default webapp theme colours
+const (
+	DefaultPrimaryColor   = "#d32f2f"
+	DefaultSecondaryColor = "#1976d2"
+	DefaultAccentColor    = "#ff9800"
 )
 
 // File permissions
@@ -53,8 +137,16 @@ const (
 
 // Default configuration values
 const (
-	DefaultDataDir = "capitols"
-	DefaultPort    = "8080"
+	DefaultDataDir      = "capitols"
+	DefaultPort         = "8080"
+	DefaultProgramSlug  = "en-guardia"
+	DefaultProgramsFile = "programs.json"
+	DefaultConfigFile   = "enguardia.json"
+	DefaultReportDir    = "reports"
+	DefaultLayout       = "flat"     // Media layout of the data directory, see storage.LayoutFlat
+	MetricsPath         = "/metrics" // Path of the metrics endpoint
+	DefaultTagsFile     = "tags.json"
+	ProgramsDataDir     = "programes" // Parent directory for programmes without an explicit data_dir
 )
 
 // HTML entities for cleaning
@@ -75,8 +167,18 @@ const (
 	DurationPattern   = `\s*Durada:\s*\d+\s*min.*$`
 	EpisodeNumPattern = `(\d+)`
 	ChapterPattern    = `Capítol (\d+)`
+	ItemIDPattern     = `/(\d+)/?$`
+	TitleNumPattern   = `^(\d+)\s*-`
 )
 
+// Episode date layouts, the first one is used by the 3Cat API
+var DateLayouts = []string{
+	"02/01/2006 15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"02/01/2006",
+}
+
 // Text suffixes to remove
 var TextSuffixes = []string{
 	"… Més",
@@ -0,0 +1,307 @@
+// Package fake3cat provides an in-process fake of the 3Cat API and media server,
+// serving recorded fixtures so the scraper can be exercised offline.
+package fake3cat
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+)
+
+//go:embed fixtures/*
+var fixtures embed.FS
+
+// Media sizes served for audio and image files, large enough to pass the
+// storage size checks
+const (
+	AudioSize = constants.MinAudioFileSize + 512*1024
+	ImageSize = constants.MinImageFileSize * 2
+)
+
+// Server is a fake 3Cat server backed by the recorded fixtures
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	pageErrors map[int]int       // page number -> HTTP status (0 = HTML error page with 200)
+	mediaCodes map[string]int    // media path -> HTTP status
+	extraItems map[string][]byte // item ID -> single item response
+	removed    map[int]bool      // item IDs left out of the listing
+	stalls     map[string]chan struct{}
+	requests   []string
+}
+
+// NewServer starts a fake server, callers must Close it
+func NewServer() *Server {
+	s := &Server{
+		pageErrors: make(map[int]int),
+		mediaCodes: make(map[string]int),
+		extraItems: make(map[string][]byte),
+		removed:    make(map[int]bool),
+		stalls:     make(map[string]chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(constants.AudiosAPIEndpoint, s.handleAudios)
+	mux.HandleFunc("/multimedia/", s.handleMedia)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// APIBaseURL returns the base URL to use instead of constants.CCMAAPIBaseURL
+func (s *Server) APIBaseURL() string {
+	return s.URL
+}
+
+// SiteURL returns the base URL to use instead of constants.BaseURL
+func (s *Server) SiteURL() string {
+	return s.URL
+}
+
+// MediaBaseURL returns the base URL to use instead of constants.CCMAMediaBaseURL
+func (s *Server) MediaBaseURL() string {
+	return s.URL + "/multimedia"
+}
+
+// FailPage makes the listing page respond with the given HTTP status.
+// A status of 0 serves an HTML error page with a 200 status, as 3Cat does
+// when its backend is down.
+func (s *Server) FailPage(page, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pageErrors[page] = status
+}
+
+// FailMedia makes a media path (relative to the media base URL) respond with the given status
+func (s *Server) FailMedia(mediaPath string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mediaCodes[strings.TrimPrefix(mediaPath, "/")] = status
+}
+
+// StallMedia makes the next request for a media path send half of the file
+// and then hang until the client goes away, as a transfer interrupted midway.
+// The returned channel is closed once the first half has been sent.
+func (s *Server) StallMedia(mediaPath string) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stalled := make(chan struct{})
+	s.stalls[strings.TrimPrefix(mediaPath, "/")] = stalled
+	return stalled
+}
+
+// SetItem overrides the single item response for an episode ID
+func (s *Server) SetItem(id string, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.extraItems[id] = body
+}
+
+// RemoveItem leaves an item out of the listing pages, as when 3Cat drops an
+// episode. Its media is still served unless FailMedia is used as well.
+func (s *Server) RemoveItem(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removed[id] = true
+}
+
+// Requests returns the request URIs received so far
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) record(r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.URL.RequestURI())
+}
+
+func (s *Server) handleAudios(w http.ResponseWriter, r *http.Request) {
+	s.record(r)
+	query := r.URL.Query()
+
+	switch query.Get("origen") {
+	case "llistat":
+		page, err := strconv.Atoi(query.Get("pagina"))
+		if err != nil || page < 1 {
+			http.Error(w, "invalid page", http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		status, failed := s.pageErrors[page]
+		s.mu.Unlock()
+		if failed {
+			s.serveError(w, status)
+			return
+		}
+
+		s.serveListPage(w, fmt.Sprintf("list-page-%d.json", page))
+
+	case "item":
+		id := query.Get("id")
+
+		s.mu.Lock()
+		body, ok := s.extraItems[id]
+		s.mu.Unlock()
+		if ok {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(body)
+			return
+		}
+
+		s.serveFixture(w, fmt.Sprintf("item-%s.json", id))
+
+	default:
+		http.Error(w, "unknown origen", http.StatusBadRequest)
+	}
+}
+
+func (s *Server) handleMedia(w http.ResponseWriter, r *http.Request) {
+	s.record(r)
+	mediaPath := strings.TrimPrefix(r.URL.Path, "/multimedia/")
+
+	s.mu.Lock()
+	status, failed := s.mediaCodes[mediaPath]
+	stalled, stall := s.stalls[mediaPath]
+	delete(s.stalls, mediaPath)
+	s.mu.Unlock()
+	if failed {
+		s.serveError(w, status)
+		return
+	}
+
+	size := AudioSize
+	switch strings.ToLower(path.Ext(mediaPath)) {
+	case constants.MP3Extension, constants.M4AExtension, constants.AACExtension, constants.MP4Extension:
+		w.Header().Set("Content-Type", "audio/mpeg")
+	case constants.JPGExtension, constants.PNGExtension, constants.WebPExtension:
+		size = ImageSize
+		w.Header().Set("Content-Type", "image/"+strings.TrimPrefix(path.Ext(mediaPath), "."))
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(size))
+	if r.Method == http.MethodHead {
+		return
+	}
+	body := mediaBody(mediaPath, size)
+	if stall {
+		_, _ = w.Write(body[:size/2])
+		w.(http.Flusher).Flush()
+		close(stalled)
+		<-r.Context().Done()
+		return
+	}
+	_, _ = w.Write(body)
+}
+
+func (s *Server) serveFixture(w http.ResponseWriter, name string) {
+	data, err := fixtures.ReadFile("fixtures/" + name)
+	if err != nil {
+		http.Error(w, "fixture not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// serveListPage serves a listing fixture without the removed items
+func (s *Server) serveListPage(w http.ResponseWriter, name string) {
+	s.mu.Lock()
+	removed := len(s.removed) > 0
+	s.mu.Unlock()
+	if !removed {
+		s.serveFixture(w, name)
+		return
+	}
+
+	data, err := fixtures.ReadFile("fixtures/" + name)
+	if err != nil {
+		http.Error(w, "fixture not found", http.StatusNotFound)
+		return
+	}
+	var page map[string]any
+	if err := json.Unmarshal(data, &page); err != nil {
+		http.Error(w, "invalid fixture", http.StatusInternalServerError)
+		return
+	}
+	if items, ok := page["resposta"].(map[string]any)["items"].(map[string]any); ok {
+		var kept []any
+		s.mu.Lock()
+		for _, item := range items["item"].([]any) {
+			if id, _ := item.(map[string]any)["id"].(float64); !s.removed[int(id)] {
+				kept = append(kept, item)
+			}
+		}
+		s.mu.Unlock()
+		items["item"] = kept
+		items["num"] = len(kept)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(page)
+}
+
+func (s *Server) serveError(w http.ResponseWriter, status int) {
+	if status == 0 {
+		data, _ := fixtures.ReadFile("fixtures/error.html")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(data)
+		return
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+// mediaBody returns deterministic content for a media path. JPEG and PNG
+// images are real pictures, padded to the size, so they can be decoded.
+func mediaBody(mediaPath string, size int) []byte {
+	body := make([]byte, size)
+	seed := []byte(mediaPath)
+	for i := range body {
+		body[i] = seed[i%len(seed)] ^ byte(i)
+	}
+
+	var encoded bytes.Buffer
+	switch strings.ToLower(path.Ext(mediaPath)) {
+	case constants.JPGExtension:
+		_ = jpeg.Encode(&encoded, picture(seed), nil)
+	case constants.PNGExtension:
+		_ = png.Encode(&encoded, picture(seed))
+	}
+	if encoded.Len() > 0 && encoded.Len() <= size {
+		clear(body)
+		copy(body, encoded.Bytes())
+	}
+	return body
+}
+
+// picture draws horizontal bands coloured after the seed
+func picture(seed []byte) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 640, 360))
+	for y := 0; y < 360; y++ {
+		band := seed[(y/45)%len(seed)]
+		c := color.RGBA{R: band, G: band * 3, B: 255 - band, A: 255}
+		for x := 0; x < 640; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
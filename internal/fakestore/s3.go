@@ -0,0 +1,156 @@
+// Package fakestore provides in-process fakes of an S3-compatible bucket and a
+// WebDAV server, keeping the files in memory so the remote storage backends can
+// be exercised offline.
+package fakestore
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// File is a stored file
+type File struct {
+	Data    []byte
+	ModTime time.Time
+}
+
+// S3 is a fake S3-compatible server holding a single bucket. It checks that
+// requests are signed with the expected access key but not the signature.
+type S3 struct {
+	*httptest.Server
+	Bucket    string
+	AccessKey string
+	PageSize  int // Keys per listing page
+
+	mu      sync.Mutex
+	objects map[string]File
+}
+
+// NewS3 starts a fake S3 server, callers must Close it
+func NewS3(bucket, accessKey string) *S3 {
+	s := &S3{Bucket: bucket, AccessKey: accessKey, PageSize: 1000, objects: make(map[string]File)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Objects returns a copy of the stored objects by key
+func (s *S3) Objects() map[string]File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objects := make(map[string]File, len(s.objects))
+	for key, file := range s.objects {
+		objects[key] = file
+	}
+	return objects
+}
+
+func (s *S3) handle(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+s.AccessKey+"/") || r.Header.Get("X-Amz-Date") == "" {
+		s.error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.Bucket {
+		s.error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	if key == "" {
+		if r.Method != http.MethodGet || r.URL.Query().Get("list-type") != "2" {
+			s.error(w, http.StatusNotImplemented, "NotImplemented")
+			return
+		}
+		s.list(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		if r.ContentLength < 0 {
+			s.error(w, http.StatusLengthRequired, "MissingContentLength")
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil || int64(len(data)) != r.ContentLength {
+			s.error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		s.objects[key] = File{Data: data, ModTime: time.Now().UTC().Truncate(time.Second)}
+	case http.MethodGet, http.MethodHead:
+		file, ok := s.objects[key]
+		if !ok {
+			s.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(file.Data)))
+		w.Header().Set("Last-Modified", file.ModTime.Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(file.Data)
+		}
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+type listObject struct {
+	Key          string `xml:"Key"`
+	Size         int    `xml:"Size"`
+	LastModified string `xml:"LastModified"`
+}
+
+type listResult struct {
+	XMLName               xml.Name     `xml:"ListBucketResult"`
+	IsTruncated           bool         `xml:"IsTruncated"`
+	NextContinuationToken string       `xml:"NextContinuationToken,omitempty"`
+	Contents              []listObject `xml:"Contents"`
+}
+
+// list answers ListObjectsV2, using the last key of a page as continuation token
+func (s *S3) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	prefix, delimiter, token := query.Get("prefix"), query.Get("delimiter"), query.Get("continuation-token")
+
+	s.mu.Lock()
+	var keys []string
+	for key := range s.objects {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok || key <= token || (delimiter != "" && strings.Contains(rest, delimiter)) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var result listResult
+	for i, key := range keys {
+		if i == s.PageSize {
+			result.IsTruncated = true
+			result.NextContinuationToken = keys[i-1]
+			break
+		}
+		file := s.objects[key]
+		result.Contents = append(result.Contents, listObject{Key: key, Size: len(file.Data), LastModified: file.ModTime.Format(time.RFC3339)})
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+func (s *S3) error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, "<Error><Code>"+code+"</Code></Error>")
+}
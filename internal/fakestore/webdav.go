@@ -0,0 +1,175 @@
+package fakestore
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebDAV is a fake WebDAV server supporting the methods the backend uses.
+// Uploads need their parent collection to exist, as on real servers.
+type WebDAV struct {
+	*httptest.Server
+	Username string
+	Password string
+
+	mu          sync.Mutex
+	files       map[string]File // Path -> file
+	collections map[string]bool // Paths of the collections, without trailing slash
+}
+
+// NewWebDAV starts a fake WebDAV server requiring the given credentials,
+// callers must Close it
+func NewWebDAV(username, password string) *WebDAV {
+	d := &WebDAV{
+		Username:    username,
+		Password:    password,
+		files:       make(map[string]File),
+		collections: map[string]bool{"": true},
+	}
+	d.Server = httptest.NewServer(http.HandlerFunc(d.handle))
+	return d
+}
+
+// Files returns a copy of the stored files by path, without leading slash
+func (d *WebDAV) Files() map[string]File {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	files := make(map[string]File, len(d.files))
+	for p, file := range d.files {
+		files[p] = file
+	}
+	return files
+}
+
+func (d *WebDAV) handle(w http.ResponseWriter, r *http.Request) {
+	if user, password, ok := r.BasicAuth(); !ok || user != d.Username || password != d.Password {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	name := strings.Trim(r.URL.Path, "/")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch r.Method {
+	case "MKCOL":
+		if d.collections[name] || d.files[name].Data != nil {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !d.collections[parent(name)] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		d.collections[name] = true
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodPut:
+		if !d.collections[parent(name)] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		d.files[name] = File{Data: data, ModTime: time.Now().UTC().Truncate(time.Second)}
+		w.WriteHeader(http.StatusCreated)
+	case "MOVE":
+		destination, err := url.Parse(r.Header.Get("Destination"))
+		file, ok := d.files[name]
+		if err != nil || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		target := strings.Trim(destination.Path, "/")
+		status := http.StatusCreated
+		if _, exists := d.files[target]; exists {
+			if r.Header.Get("Overwrite") == "F" {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			status = http.StatusNoContent
+		}
+		d.files[target] = file
+		delete(d.files, name)
+		w.WriteHeader(status)
+	case http.MethodGet, http.MethodHead:
+		file, ok := d.files[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(file.Data)))
+		w.Header().Set("Last-Modified", file.ModTime.Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(file.Data)
+		}
+	case http.MethodDelete:
+		if _, ok := d.files[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(d.files, name)
+		w.WriteHeader(http.StatusNoContent)
+	case "PROPFIND":
+		d.propfind(w, name)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// propfind lists a collection and its direct members, as with Depth: 1
+func (d *WebDAV) propfind(w http.ResponseWriter, name string) {
+	if !d.collections[name] {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var members []string
+	for p := range d.files {
+		if parent(p) == name {
+			members = append(members, p)
+		}
+	}
+	sort.Strings(members)
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?><D:multistatus xmlns:D="DAV:">`)
+	fmt.Fprintf(&b, `<D:response><D:href>%s</D:href><D:propstat><D:prop><D:resourcetype><D:collection/></D:resourcetype></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>`,
+		escapeHref(name)+"/")
+	for _, p := range members {
+		file := d.files[p]
+		fmt.Fprintf(&b, `<D:response><D:href>%s</D:href><D:propstat><D:prop><D:resourcetype/><D:getcontentlength>%d</D:getcontentlength><D:getlastmodified>%s</D:getlastmodified></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>`,
+			escapeHref(p), len(file.Data), file.ModTime.Format(http.TimeFormat))
+	}
+	b.WriteString(`</D:multistatus>`)
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	_, _ = io.WriteString(w, b.String())
+}
+
+func parent(p string) string {
+	dir := path.Dir(p)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+func escapeHref(p string) string {
+	var buf strings.Builder
+	_ = xml.EscapeText(&buf, []byte((&url.URL{Path: "/" + p}).EscapedPath()))
+	return buf.String()
+}
@@ -0,0 +1,49 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/p4u/enguardia-arxiu/internal/backend"
+	"github.com/p4u/enguardia-arxiu/internal/catalog"
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+)
+
+// syncCatalog brings the catalogue of a data directory up to date and returns
+// its episodes. media is the media listing, nil keeps the stored media state.
+func syncCatalog(dataDir string, media []backend.Info, opts Options) ([]collector.Episode, error) {
+	ctx := context.Background()
+	c, err := catalog.Open(catalog.Path(dataDir))
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	ts := NewTagSystemWithOptions(dataDir, opts)
+	stats, err := c.Sync(ctx, dataDir, catalog.SyncOptions{
+		Media:            media,
+		MinAudioFileSize: opts.MinAudioFileSize,
+		Tagger:           ts.Evidence,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sync catalog: %w", err)
+	}
+	slog.Info("Synced catalog", "dir", dataDir, "episodes", stats.Episodes, "added", stats.Added,
+		"changed", stats.Changed, "removed", stats.Removed)
+
+	return c.Episodes(ctx)
+}
+
+// loadEpisodesFromCatalog reads the episodes through the catalogue, dry runs
+// read the JSON files as the catalogue can't be updated
+func (g *Generator) loadEpisodesFromCatalog() ([]collector.Episode, error) {
+	if g.opts.DryRun {
+		return g.loadEpisodesFromJSON()
+	}
+	media := make([]backend.Info, 0, len(g.mediaFiles))
+	for _, info := range g.mediaFiles {
+		media = append(media, info)
+	}
+	return syncCatalog(g.dataDir, media, g.opts)
+}
@@ -1,10 +1,16 @@
 package generator
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
@@ -12,13 +18,62 @@ import (
 	"strings"
 	"time"
 
+	"github.com/p4u/enguardia-arxiu/internal/atomicfile"
+	"github.com/p4u/enguardia-arxiu/internal/backend"
 	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+	"github.com/p4u/enguardia-arxiu/internal/program"
 )
 
 // Generator handles the generation of webapp data files
 type Generator struct {
 	dataDir string
 	tags    *TagDatabase
+	program program.Program
+	opts    Options
+	dataURL string // URL of the output directory as seen by the webapp
+	siteDir string // Where the site files are written, the staging copy of Options.SiteDir
+
+	media      backend.Backend
+	mediaFiles map[string]backend.Info // Listed at the start of each generation
+	probes     map[string]probeResult  // Remote audio probe results by URL, nil when not probed
+}
+
+// Options configures the generator and tag system for a programme
+type Options struct {
+	Program          program.Program
+	TagsFile         string    // Overrides the programme tags file
+	Title            string    // Overrides the programme title in the webapp
+	Description      string    // Overrides the programme description in the webapp
+	Language         string    // Overrides the programme language in the webapp
+	Theme            Theme     // Webapp colours (empty fields = built-in theme)
+	AudioBaseURL     string    // URL of the local audio (empty = the media backend URL or /audio)
+	Version          string    // Version shown by the webapp (empty = the program version)
+	BuildTime        time.Time // Build time of the data (zero = SOURCE_DATE_EPOCH or the last change of the data)
+	ThumbnailWidth   int
+	ThumbnailQuality int
+	RemoteThumbnails bool  // Build the thumbnails of the images not stored locally from their 3Cat URL
+	MinAudioFileSize int64 // Local audio files must exceed this size to count as available
+	DryRun           bool  // Log the files that would be written instead of writing them
+	Catalog          bool  // Read the episodes through the SQLite catalogue of the data directory
+	ProbeAudio       bool  // Check the remote audio of the episodes streamed from 3Cat
+	ProbeConcurrency int
+	ProbeInterval    time.Duration // Minimum pause between probe requests
+	ProbeTTL         time.Duration // Age after which a cached probe result is checked again
+	HTTPClient       *http.Client  // Client of the probes and remote thumbnails
+	SiteDir          string        // Webapp directory receiving the episode pages and sitemap (empty = none)
+	SiteURL          string        // Public URL of the webapp
+	// Backend returns the media backend of a programme data directory (nil = the directory itself)
+	Backend func(dataDir string, p program.Program) backend.Backend
+}
+
+// DefaultTheme returns the built-in webapp colours
+func DefaultTheme() Theme {
+	return Theme{
+		PrimaryColor:   constants.DefaultPrimaryColor,
+		SecondaryColor: constants.DefaultSecondaryColor,
+		AccentColor:    constants.DefaultAccentColor,
+	}
 }
 
 // TagDatabase represents the loaded tags data
@@ -47,35 +102,162 @@ type EpisodeTagsStruct struct {
 
 // NewGenerator creates a new data generator
 func NewGenerator(dataDir string) *Generator {
-	return &Generator{
+	return NewGeneratorWithOptions(dataDir, Options{})
+}
+
+// NewGeneratorWithOptions creates a data generator for the configured programme
+func NewGeneratorWithOptions(dataDir string, opts Options) *Generator {
+	if opts.Program.Slug == "" {
+		opts.Program = program.EnGuardia()
+	}
+	if opts.TagsFile != "" {
+		opts.Program.TagsFile = opts.TagsFile
+	}
+	if opts.Title != "" {
+		opts.Program.Title = opts.Title
+	}
+	if opts.Description != "" {
+		opts.Program.Description = opts.Description
+	}
+	if opts.Language != "" {
+		opts.Program.Language = opts.Language
+	}
+	defaults := DefaultTheme()
+	if opts.Theme.PrimaryColor == "" {
+		opts.Theme.PrimaryColor = defaults.PrimaryColor
+	}
+	if opts.Theme.SecondaryColor == "" {
+		opts.Theme.SecondaryColor = defaults.SecondaryColor
+	}
+	if opts.Theme.AccentColor == "" {
+		opts.Theme.AccentColor = defaults.AccentColor
+	}
+	if opts.Version == "" {
+		opts.Version = buildVersion()
+	}
+
+	if opts.ThumbnailWidth <= 0 {
+		opts.ThumbnailWidth = constants.ThumbnailWidth
+	}
+	if opts.ThumbnailQuality <= 0 {
+		opts.ThumbnailQuality = constants.ThumbnailQuality
+	}
+	if opts.MinAudioFileSize <= 0 {
+		opts.MinAudioFileSize = constants.MinAudioFileSize
+	}
+	if opts.ProbeConcurrency <= 0 {
+		opts.ProbeConcurrency = constants.ProbeConcurrency
+	}
+	if opts.ProbeInterval <= 0 {
+		opts.ProbeInterval = constants.ProbeInterval
+	}
+	if opts.ProbeTTL <= 0 {
+		opts.ProbeTTL = constants.ProbeTTL
+	}
+	if opts.SiteURL == "" {
+		opts.SiteURL = constants.DefaultSiteURL
+	}
+	if !strings.HasSuffix(opts.SiteURL, "/") {
+		opts.SiteURL += "/"
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: constants.HTTPTimeout}
+	}
+	g := &Generator{
 		dataDir: dataDir,
+		program: opts.Program,
+		opts:    opts,
+		dataURL: "./data",
+		media:   backend.NewFilesystem(dataDir),
+	}
+	if opts.Backend != nil {
+		g.media = opts.Backend(dataDir, opts.Program)
+	}
+	return g
+}
+
+// GenerateWebappData creates consolidated data for the webapp. The files are
+// written to a staging directory that replaces outputDir once complete, so the
+// webapp never serves a mix of old and new files; the episode pages, sitemap
+// and robots.txt of the site directory are published in the same swap. A
+// cancelled context stops the remote requests and leaves outputDir untouched.
+func (g *Generator) GenerateWebappData(ctx context.Context, outputDir string, lazy bool) error {
+	return g.publish(outputDir, func(dir, siteDir string) error {
+		g.siteDir = siteDir
+		if _, err := g.generate(ctx, dir, lazy); err != nil {
+			return err
+		}
+		if g.opts.SiteDir == "" {
+			return nil
+		}
+		return g.writeRobots([]string{g.opts.SiteURL + constants.SitemapFile})
+	})
+}
+
+// publish runs build on staging copies of outputDir and the site directory
+// and swaps them in together. Dry runs build on the directories themselves as
+// nothing is written.
+func (g *Generator) publish(outputDir string, build func(dir, siteDir string) error) error {
+	switch {
+	case g.opts.DryRun:
+		return build(outputDir, g.opts.SiteDir)
+	case g.opts.SiteDir == "":
+		return atomicfile.ReplaceDir(outputDir, func(dir string) error {
+			return build(dir, "")
+		})
 	}
+	return atomicfile.ReplaceDirs([]string{outputDir, g.opts.SiteDir}, func(staging []string) error {
+		return build(staging[0], staging[1])
+	})
 }
 
-// GenerateWebappData creates consolidated data for the webapp
-func (g *Generator) GenerateWebappData(outputDir string, lazy bool) error {
-	log.Println("Generating webapp data files...")
+// generate writes the webapp data files and returns the collection statistics
+func (g *Generator) generate(ctx context.Context, outputDir string, lazy bool) (Stats, error) {
+	slog.Info("Generating webapp data files", "program", g.program.Name)
 
 	// Load tags database
 	if err := g.loadTagsDatabase(); err != nil {
-		log.Printf("Warning: failed to load tags database: %v", err)
+		slog.Warn("Failed to load tags database", "error", err)
 		// Continue without tags
 	}
 
-	// Load episodes from JSON files
-	episodes, err := g.loadEpisodesFromJSON()
+	if err := g.listMedia(ctx); err != nil {
+		return Stats{}, err
+	}
+
+	// Load episodes from the catalogue or the JSON files
+	var episodes []collector.Episode
+	var err error
+	if g.opts.Catalog {
+		episodes, err = g.loadEpisodesFromCatalog()
+	} else {
+		episodes, err = g.loadEpisodesFromJSON()
+	}
 	if err != nil {
-		return fmt.Errorf("failed to load episodes: %w", err)
+		return Stats{}, fmt.Errorf("failed to load episodes: %w", err)
+	}
+
+	g.probes = nil
+	if g.opts.ProbeAudio {
+		if err := g.probeRemoteAudio(ctx, episodes, lazy); err != nil {
+			return Stats{}, err
+		}
 	}
 
 	// Convert to webapp episodes
 	webappEpisodes := g.convertToWebappEpisodes(episodes, lazy)
 
+	// Create thumbnails for the episode cards
+	g.generateThumbnails(ctx, outputDir, episodes, webappEpisodes)
+	if err := ctx.Err(); err != nil {
+		return Stats{}, fmt.Errorf("generation interrupted: %w", err)
+	}
+
 	// Generate statistics
 	stats := g.generateStats(webappEpisodes)
 
 	// Create configuration
-	config := g.createConfig(lazy)
+	config := g.createConfig(lazy, stats.LastUpdated)
 
 	// Create webapp data structure
 	webappData := WebappData{
@@ -85,32 +267,39 @@ func (g *Generator) GenerateWebappData(outputDir string, lazy bool) error {
 	}
 
 	// Ensure output directory exists
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+	if !g.opts.DryRun {
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return Stats{}, fmt.Errorf("failed to create output directory: %w", err)
+		}
 	}
 
 	// Write main data file
 	if err := g.writeJSONFile(filepath.Join(outputDir, "episodes.json"), webappData); err != nil {
-		return fmt.Errorf("failed to write episodes.json: %w", err)
+		return Stats{}, fmt.Errorf("failed to write episodes.json: %w", err)
 	}
 
 	// Write separate files for different purposes
 	if err := g.writeJSONFile(filepath.Join(outputDir, "episodes-list.json"), webappEpisodes); err != nil {
-		return fmt.Errorf("failed to write episodes-list.json: %w", err)
+		return Stats{}, fmt.Errorf("failed to write episodes-list.json: %w", err)
 	}
 
 	if err := g.writeJSONFile(filepath.Join(outputDir, "stats.json"), stats); err != nil {
-		return fmt.Errorf("failed to write stats.json: %w", err)
+		return Stats{}, fmt.Errorf("failed to write stats.json: %w", err)
 	}
 
 	if err := g.writeJSONFile(filepath.Join(outputDir, "config.json"), config); err != nil {
-		return fmt.Errorf("failed to write config.json: %w", err)
+		return Stats{}, fmt.Errorf("failed to write config.json: %w", err)
+	}
+
+	if g.opts.SiteDir != "" {
+		if err := g.generateSite(webappEpisodes); err != nil {
+			return Stats{}, err
+		}
 	}
 
-	log.Printf("Successfully generated webapp data files in %s", outputDir)
-	log.Printf("Total episodes: %d, Available: %d", stats.TotalEpisodes, stats.AvailableCount)
+	slog.Info("Generated webapp data files", "dir", outputDir, "episodes", stats.TotalEpisodes, "available", stats.AvailableCount)
 
-	return nil
+	return stats, nil
 }
 
 // loadEpisodesFromJSON loads episodes from individual JSON files
@@ -126,13 +315,13 @@ func (g *Generator) loadEpisodesFromJSON() ([]collector.Episode, error) {
 	for _, file := range files {
 		data, err := os.ReadFile(file)
 		if err != nil {
-			log.Printf("Warning: failed to read file %s: %v", file, err)
+			slog.Warn("Failed to read episode file", "file", file, "error", err)
 			continue
 		}
 
 		var episode collector.Episode
 		if err := json.Unmarshal(data, &episode); err != nil {
-			log.Printf("Warning: failed to parse JSON file %s: %v", file, err)
+			slog.Warn("Failed to parse episode file", "file", file, "error", err)
 			continue
 		}
 
@@ -142,91 +331,154 @@ func (g *Generator) loadEpisodesFromJSON() ([]collector.Episode, error) {
 	}
 
 	// Sort episodes by title (which often contains episode numbers)
-	sort.Slice(episodes, func(i, j int) bool {
+	sort.SliceStable(episodes, func(i, j int) bool {
 		return g.extractEpisodeNumber(episodes[i].Title) < g.extractEpisodeNumber(episodes[j].Title)
 	})
 
 	return episodes, nil
 }
 
-// loadTagsDatabase loads the tags database from tags.json
+// loadTagsDatabase loads the tags database of the programme
 func (g *Generator) loadTagsDatabase() error {
-	tagsPath := "tags.json"
+	tagsPath := g.program.TagsFile
 
-	// Check if tags.json exists
+	// Check if the tags file exists
 	if _, err := os.Stat(tagsPath); os.IsNotExist(err) {
-		return fmt.Errorf("tags.json not found")
+		return fmt.Errorf("%s not found", tagsPath)
 	}
 
 	data, err := os.ReadFile(tagsPath)
 	if err != nil {
-		return fmt.Errorf("failed to read tags.json: %w", err)
+		return fmt.Errorf("failed to read %s: %w", tagsPath, err)
 	}
 
 	g.tags = &TagDatabase{}
 	if err := json.Unmarshal(data, g.tags); err != nil {
-		return fmt.Errorf("failed to parse tags.json: %w", err)
+		return fmt.Errorf("failed to parse %s: %w", tagsPath, err)
 	}
 
-	log.Printf("Loaded tags database with %d episodes", len(g.tags.Episodes))
+	slog.Info("Loaded tags database", "file", tagsPath, "episodes", len(g.tags.Episodes))
 	return nil
 }
 
+// EpisodeTags returns the webapp tags of each episode, keyed by its JSON file
+func (g *Generator) EpisodeTags(episodes []collector.Episode) map[string][]string {
+	if g.tags == nil {
+		if err := g.loadTagsDatabase(); err != nil {
+			slog.Warn("Failed to load tags database", "error", err)
+		}
+	}
+
+	tags := make(map[string][]string, len(episodes))
+	for _, ep := range episodes {
+		tags[ep.JSONFile] = g.extractTags(ep.Title, ep.Description)
+	}
+	return tags
+}
+
 // convertToWebappEpisodes converts collector episodes to webapp episodes
 func (g *Generator) convertToWebappEpisodes(episodes []collector.Episode, lazy bool) []Episode {
 	var webappEpisodes []Episode
 
 	for _, ep := range episodes {
 		webappEp := Episode{
-			ID:          g.generateEpisodeID(ep.Title),
-			Title:       ep.Title,
-			Description: ep.Description,
-			Duration:    ep.Duration,
-			Date:        ep.Date,
-			ParsedDate:  g.parseDate(ep.Date),
-			Link:        ep.Link,
-			AudioURL:    g.cleanupURL(ep.AudioURL),
-			Image:       g.getImageURL(ep, lazy),
-			Filename:    ep.Filename,
-			JSONFile:    ep.JSONFile,
-			Available:   g.checkEpisodeAvailability(ep, lazy),
-			Tags:        g.extractTags(ep.Title, ep.Description),
-			Category:    g.categorizeEpisode(ep.Title, ep.Description),
+			ID:           g.generateEpisodeID(ep.Title),
+			Title:        ep.Title,
+			Description:  ep.Description,
+			Duration:     ep.Duration,
+			Date:         ep.Date,
+			ParsedDate:   g.parseDate(ep.Date),
+			Link:         ep.Link,
+			AudioURL:     g.getAudioURL(ep, lazy),
+			AudioType:    g.audioType(ep),
+			Renditions:   ep.AudioRenditions,
+			Image:        g.getImageURL(ep, lazy),
+			ImageAlt:     ep.ImageAlt,
+			Filename:     ep.Filename,
+			JSONFile:     ep.JSONFile,
+			Available:    g.checkEpisodeAvailability(ep, lazy),
+			Tags:         g.extractTags(ep.Title, ep.Description),
+			Category:     g.categorizeEpisode(ep.Title, ep.Description),
+			FirstSeen:    ep.FirstSeen(),
+			LastModified: ep.LastModified(),
+			Status:       ep.Status,
 		}
 
 		// Get file size if available
-		if !lazy && ep.Filename != "" {
-			audioPath := filepath.Join(g.dataDir, ep.Filename)
-			if info, err := os.Stat(audioPath); err == nil {
-				webappEp.FileSize = info.Size()
+		if !lazy {
+			if info, ok := g.mediaFile(ep.Filename); ok {
+				webappEp.FileSize = info.Size
 			}
 		}
+		if result, ok := g.probes[ep.AudioURL]; ok && webappEp.FileSize == 0 && result.available() {
+			webappEp.FileSize = result.ContentLength
+		}
 
 		webappEpisodes = append(webappEpisodes, webappEp)
 	}
 
+	uniqueEpisodeIDs(webappEpisodes, episodes)
 	return webappEpisodes
 }
 
+// audioType returns the MIME type of the audio of an episode: the one 3Cat
+// served when probed, or else the one of its rendition format
+func (g *Generator) audioType(ep collector.Episode) string {
+	if result, ok := g.probes[ep.AudioURL]; ok && result.available() {
+		if mediaType, _, err := mime.ParseMediaType(result.ContentType); err == nil && strings.HasPrefix(mediaType, "audio/") {
+			return mediaType
+		}
+	}
+
+	format := ""
+	for _, rendition := range ep.AudioRenditions {
+		if rendition.URL == ep.AudioURL {
+			format = rendition.Format
+		}
+	}
+	if format == "" {
+		if u, err := url.Parse(ep.AudioURL); err == nil {
+			format = strings.TrimPrefix(strings.ToLower(path.Ext(u.Path)), ".")
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(format, "aac"):
+		return "audio/aac"
+	case strings.HasPrefix(format, "m4a"), strings.HasPrefix(format, "mp4"):
+		return "audio/mp4"
+	}
+	return "audio/mpeg"
+}
+
 // generateStats creates statistics from the episodes
 func (g *Generator) generateStats(episodes []Episode) Stats {
 	stats := Stats{
 		TotalEpisodes:  len(episodes),
 		AudioFormats:   []string{"mp3"},
 		Categories:     []string{},
-		LastUpdated:    time.Now(),
 		AvailableCount: 0,
 		TotalFileSize:  0,
 		TotalSeconds:   0,
 	}
 
 	var dates []time.Time
+	var latest time.Time
 	categoryMap := make(map[string]bool)
 
 	for _, ep := range episodes {
+		if t := changedAt(ep.LastModified, ep.ParsedDate); t.After(latest) {
+			latest = t
+		}
 		if ep.Available {
 			stats.AvailableCount++
 		}
+		switch ep.Status {
+		case collector.StatusLocalOnly:
+			stats.LocalOnlyCount++
+		case collector.StatusLost:
+			stats.LostCount++
+		}
 
 		stats.TotalFileSize += ep.FileSize
 
@@ -246,6 +498,8 @@ func (g *Generator) generateStats(episodes []Episode) Stats {
 		}
 	}
 
+	stats.LastUpdated = g.opts.timestamp(latest)
+
 	// Calculate total duration string
 	stats.TotalDuration = g.formatDuration(stats.TotalSeconds)
 
@@ -270,25 +524,37 @@ func (g *Generator) generateStats(episodes []Episode) Stats {
 }
 
 // createConfig creates the webapp configuration
-func (g *Generator) createConfig(lazy bool) Config {
+func (g *Generator) createConfig(lazy bool, buildTime time.Time) Config {
 	supportsModes := []string{"streaming"}
 	if !lazy {
 		supportsModes = append(supportsModes, "local")
 	}
 
+	audioBaseURL := strings.TrimSuffix(g.opts.AudioBaseURL, "/")
+	if audioBaseURL == "" {
+		audioBaseURL = "/audio"
+		if url := g.media.URL(""); url != "" {
+			audioBaseURL = strings.TrimSuffix(url, "/")
+		}
+	}
+
+	// Episodes are canonical on their static page when there is one
+	episodeURL := g.opts.SiteURL + "episode/{id}"
+	if g.opts.SiteDir != "" {
+		episodeURL = g.opts.SiteURL + constants.EpisodePagesDir + "/{id}/"
+	}
+
 	return Config{
-		Title:         "En Guàrdia - Història de Catalunya",
-		Description:   "Programa d'història de Catalunya Ràdio amb tots els episodis disponibles",
-		Language:      "ca",
-		AudioBaseURL:  "/audio",
+		Title:         g.program.Title,
+		Description:   g.program.Description,
+		Language:      g.program.Language,
+		AudioBaseURL:  audioBaseURL,
+		SiteURL:       g.opts.SiteURL,
+		EpisodeURL:    episodeURL,
 		SupportsModes: supportsModes,
-		Version:       "2.0.0",
-		BuildTime:     time.Now().Format(time.RFC3339),
-		Theme: Theme{
-			PrimaryColor:   "#d32f2f",
-			SecondaryColor: "#1976d2",
-			AccentColor:    "#ff9800",
-		},
+		Version:       g.opts.Version,
+		BuildTime:     buildTime.Format(time.RFC3339),
+		Theme:         g.opts.Theme,
 	}
 }
 
@@ -310,6 +576,52 @@ func (g *Generator) generateEpisodeID(title string) string {
 	return id
 }
 
+// uniqueEpisodeIDs gives the episodes that share an id (the same number, or
+// titles equal in their first 50 characters) an id of their own: the one with
+// the lowest 3Cat item ID, the first broadcast, keeps it whatever the order of
+// the files, and the others get their item ID appended. webappEpisodes are the
+// conversion of episodes, in the same order.
+func uniqueEpisodeIDs(webappEpisodes []Episode, episodes []collector.Episode) {
+	owner := make(map[string]int, len(webappEpisodes))
+	for i, ep := range webappEpisodes {
+		if j, ok := owner[ep.ID]; !ok || firstBroadcast(episodes[i].ItemID(), episodes[j].ItemID()) {
+			owner[ep.ID] = i
+		}
+	}
+
+	used := make(map[string]bool, len(webappEpisodes))
+	for id := range owner {
+		used[id] = true
+	}
+	for i := range webappEpisodes {
+		id := webappEpisodes[i].ID
+		if id == "" || owner[id] == i {
+			continue
+		}
+		unique := id
+		if itemID := episodes[i].ItemID(); itemID != "" {
+			unique = id + "-" + itemID
+		}
+		for n := 2; used[unique]; n++ {
+			unique = fmt.Sprintf("%s-%d", id, n)
+		}
+		used[unique] = true
+		webappEpisodes[i].ID = unique
+	}
+}
+
+// firstBroadcast reports whether item ID a is older than b; episodes without
+// one come last
+func firstBroadcast(a, b string) bool {
+	if a == "" || b == "" {
+		return b == "" && a != ""
+	}
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
 func (g *Generator) extractEpisodeNumber(title string) int {
 	// Try to extract episode number from title
 	re := regexp.MustCompile(`^(\d+)\s*-`)
@@ -341,19 +653,39 @@ func (g *Generator) parseDate(dateStr string) time.Time {
 }
 
 func (g *Generator) checkEpisodeAvailability(ep collector.Episode, lazy bool) bool {
-	if lazy {
-		return ep.AudioURL != ""
+	// Check if local file exists
+	if !lazy && g.hasAudio(ep) {
+		return true
 	}
 
-	// Check if local file exists
-	if ep.Filename != "" {
-		audioPath := filepath.Join(g.dataDir, ep.Filename)
-		if info, err := os.Stat(audioPath); err == nil && info.Size() > 1024*1024 { // At least 1MB
-			return true
-		}
+	if !ep.RemoteAudio() {
+		return false
+	}
+	// Probed audio is available when the CDN served it, the placeholder never is
+	if g.probes != nil && ep.HasFallbackAudio() {
+		return false
 	}
+	if result, ok := g.probes[ep.AudioURL]; ok {
+		return result.available()
+	}
+	return true
+}
 
-	return ep.AudioURL != ""
+// hasAudio reports whether the complete audio of an episode is stored
+func (g *Generator) hasAudio(ep collector.Episode) bool {
+	info, ok := g.mediaFile(ep.Filename)
+	return ok && info.Size > g.opts.MinAudioFileSize
+}
+
+// getAudioURL points downloaded audio to the media backend when it publishes
+// the files itself, otherwise to 3Cat
+func (g *Generator) getAudioURL(ep collector.Episode, lazy bool) string {
+	if !lazy && g.hasAudio(ep) {
+		if url := g.media.URL(ep.Filename); url != "" {
+			return url
+		}
+	}
+	return g.cleanupURL(ep.AudioURL)
 }
 
 func (g *Generator) extractTags(title, description string) []string {
@@ -376,7 +708,8 @@ func (g *Generator) extractTags(title, description string) []string {
 		}
 
 		// If exact match not found, try fuzzy matching by title similarity
-		for key, tagData := range g.tags.Episodes {
+		for _, key := range sortedTagKeys(g.tags.Episodes) {
+			tagData := g.tags.Episodes[key]
 			if g.titleSimilarity(title, tagData.Title) > 0.8 {
 				tags = append(tags, tagData.Tags.Topics...)
 				tags = append(tags, tagData.Tags.Locations...)
@@ -384,32 +717,32 @@ func (g *Generator) extractTags(title, description string) []string {
 				tags = append(tags, tagData.Tags.Events...)
 				tags = append(tags, tagData.Tags.Periods...)
 
-				log.Printf("Found fuzzy match for '%s' -> '%s' (key: %s)", title, tagData.Title, key)
+				slog.Debug("Found fuzzy tag match", "title", title, "match", tagData.Title, "key", key)
 				return g.removeDuplicateTags(tags)
 			}
 		}
 	}
 
 	// Fallback to basic keyword extraction if no tags database or no match found
-	keywords := map[string]string{
-		"guerra":    "guerra",
-		"batalla":   "batalla",
-		"setge":     "setge",
-		"rei":       "monarquia",
-		"comte":     "noblesa",
-		"catalunya": "catalunya",
-		"barcelona": "barcelona",
-		"medieval":  "edat-mitjana",
-		"romà":      "roma",
-		"musulmà":   "islam",
-		"cristià":   "cristianisme",
-		"templers":  "ordes-militars",
+	keywords := []struct{ keyword, tag string }{
+		{"guerra", "guerra"},
+		{"batalla", "batalla"},
+		{"setge", "setge"},
+		{"rei", "monarquia"},
+		{"comte", "noblesa"},
+		{"catalunya", "catalunya"},
+		{"barcelona", "barcelona"},
+		{"medieval", "edat-mitjana"},
+		{"romà", "roma"},
+		{"musulmà", "islam"},
+		{"cristià", "cristianisme"},
+		{"templers", "ordes-militars"},
 	}
 
 	text := strings.ToLower(title + " " + description)
-	for keyword, tag := range keywords {
-		if strings.Contains(text, keyword) {
-			tags = append(tags, tag)
+	for _, k := range keywords {
+		if strings.Contains(text, k.keyword) {
+			tags = append(tags, k.tag)
 		}
 	}
 
@@ -419,21 +752,25 @@ func (g *Generator) extractTags(title, description string) []string {
 func (g *Generator) categorizeEpisode(title, description string) string {
 	text := strings.ToLower(title + " " + description)
 
-	categories := map[string][]string{
-		"Guerres i Batalles": {"guerra", "batalla", "setge", "militar"},
-		"Edat Mitjana":       {"medieval", "feudal", "cavaller", "castell"},
-		"Època Romana":       {"romà", "roma", "imperi"},
-		"Monarquia":          {"rei", "reina", "príncep", "corona"},
-		"Catalunya Moderna":  {"segadors", "successió", "felip"},
-		"Segle XX":           {"república", "guerra civil", "franquisme"},
-		"Cultura i Societat": {"cuina", "medicina", "escola", "música"},
-		"Personatges":        {"biografia", "vida de"},
-	}
-
-	for category, keywords := range categories {
-		for _, keyword := range keywords {
+	// The first matching category wins
+	categories := []struct {
+		name     string
+		keywords []string
+	}{
+		{"Guerres i Batalles", []string{"guerra", "batalla", "setge", "militar"}},
+		{"Edat Mitjana", []string{"medieval", "feudal", "cavaller", "castell"}},
+		{"Època Romana", []string{"romà", "roma", "imperi"}},
+		{"Monarquia", []string{"rei", "reina", "príncep", "corona"}},
+		{"Catalunya Moderna", []string{"segadors", "successió", "felip"}},
+		{"Segle XX", []string{"república", "guerra civil", "franquisme"}},
+		{"Cultura i Societat", []string{"cuina", "medicina", "escola", "música"}},
+		{"Personatges", []string{"biografia", "vida de"}},
+	}
+
+	for _, category := range categories {
+		for _, keyword := range category.keywords {
 			if strings.Contains(text, keyword) {
-				return category
+				return category.name
 			}
 		}
 	}
@@ -497,12 +834,12 @@ func (g *Generator) getImageURL(ep collector.Episode, lazy bool) string {
 	}
 
 	// Check if local image file exists
-	if ep.ImageFilename != "" {
-		imagePath := filepath.Join(g.dataDir, ep.ImageFilename)
-		if info, err := os.Stat(imagePath); err == nil && info.Size() > 0 {
-			// For GitHub Pages, use relative path to images directory
-			return "./images/" + filepath.Base(ep.ImageFilename)
+	if info, ok := g.mediaFile(ep.ImageFilename); ok && info.Size > 0 {
+		if url := g.media.URL(ep.ImageFilename); url != "" {
+			return url
 		}
+		// For GitHub Pages, use relative path to images directory
+		return "./images/" + filepath.Base(ep.ImageFilename)
 	}
 
 	// Fallback to remote URL if local file doesn't exist
@@ -526,19 +863,16 @@ func (g *Generator) cleanupURL(url string) string {
 }
 
 func (g *Generator) writeJSONFile(filename string, data interface{}) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
+	if g.opts.DryRun {
+		slog.Info("Dry run: would write", "file", filename)
+		return nil
 	}
-	defer func() {
-		if closeErr := file.Close(); closeErr != nil {
-			log.Printf("Warning: failed to close file %s: %v", filename, closeErr)
-		}
-	}()
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	return encoder.Encode(data)
+	return atomicfile.Write(filename, constants.FilePermissions, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(data)
+	})
 }
 
 // generateTagKey creates a key for looking up episodes in the tags database
@@ -566,6 +900,16 @@ func (g *Generator) removeDuplicateTags(tags []string) []string {
 	return result
 }
 
+// sortedTagKeys returns the keys of the tags database in alphabetical order
+func sortedTagKeys(episodes map[string]EpisodeTagData) []string {
+	keys := make([]string, 0, len(episodes))
+	for key := range episodes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // titleSimilarity calculates similarity between two titles (simple implementation)
 func (g *Generator) titleSimilarity(title1, title2 string) float64 {
 	// Normalize titles
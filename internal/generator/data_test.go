@@ -0,0 +1,131 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/fake3cat"
+	"github.com/p4u/enguardia-arxiu/internal/storage"
+)
+
+// newFakeDataDir saves the metadata of the episodes of the fake 3Cat server
+// into a new data directory, picking the audio in the given formats
+func newFakeDataDir(t *testing.T, srv *fake3cat.Server, formats ...string) string {
+	t.Helper()
+
+	now := func() time.Time { return time.Date(2025, 9, 8, 10, 0, 0, 0, time.UTC) }
+	c := collector.NewCollectorWithOptions(collector.Options{
+		APIBaseURL:   srv.APIBaseURL(),
+		SiteURL:      srv.SiteURL(),
+		MediaBaseURL: srv.MediaBaseURL(),
+		Client:       srv.Client(),
+		Now:          now,
+	})
+	if len(formats) > 0 {
+		c.SetAudioPreference(collector.AudioPreference{Formats: formats})
+	}
+	episodes, err := c.ScrapeEpisodes(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to scrape episodes: %v", err)
+	}
+
+	dataDir := t.TempDir()
+	st := storage.NewStorageWithOptions(dataDir, storage.Options{Client: srv.Client(), Now: now})
+	for _, episode := range episodes {
+		if _, err := st.SaveEpisode(episode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dataDir
+}
+
+// fakeOptions returns the generator options for the fake 3Cat server, without
+// a tags file
+func fakeOptions(t *testing.T, srv *fake3cat.Server) Options {
+	return Options{
+		TagsFile:   filepath.Join(t.TempDir(), "tags.json"),
+		HTTPClient: srv.Client(),
+	}
+}
+
+// webappEpisode is the part of a generated episode checked by the tests
+type webappEpisode struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Available bool   `json:"available"`
+	FileSize  int64  `json:"fileSize"`
+	Thumbnail string `json:"thumbnail"`
+}
+
+// readEpisodes returns the episodes of the generated episodes.json by id
+func readEpisodes(t *testing.T, outputDir string) map[string]webappEpisode {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(outputDir, "episodes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var generated struct {
+		Episodes []webappEpisode `json:"episodes"`
+	}
+	if err := json.Unmarshal(data, &generated); err != nil {
+		t.Fatal(err)
+	}
+	episodes := make(map[string]webappEpisode, len(generated.Episodes))
+	for _, ep := range generated.Episodes {
+		episodes[ep.ID] = ep
+	}
+	return episodes
+}
+
+func TestUniqueEpisodeIDs(t *testing.T) {
+	episode := func(title, itemID string) collector.Episode {
+		ep := collector.Episode{Title: title}
+		if itemID != "" {
+			ep.Link = "https://www.3cat.cat/3cat/" + itemID + "/"
+		}
+		return ep
+	}
+	g := NewGenerator(t.TempDir())
+	for _, tc := range []struct {
+		name     string
+		episodes []collector.Episode
+		want     []string
+	}{
+		{
+			name:     "distinct",
+			episodes: []collector.Episode{episode("1245 - L'Ebre", "1001"), episode("1244 - Els almogàvers", "1002")},
+			want:     []string{"ep-1245", "ep-1244"},
+		},
+		{
+			name:     "rebroadcast listed first",
+			episodes: []collector.Episode{episode("1245 - L'Ebre (reemissió)", "1009"), episode("1245 - L'Ebre", "1001")},
+			want:     []string{"ep-1245-1009", "ep-1245"},
+		},
+		{
+			name:     "long titles",
+			episodes: []collector.Episode{episode(strings.Repeat("Abcde ", 9)+"I", "20"), episode(strings.Repeat("Abcde ", 9)+"II", "3")},
+			want:     []string{strings.Repeat("abcde-", 8) + "ab-20", strings.Repeat("abcde-", 8) + "ab"},
+		},
+		{
+			name:     "without item ID",
+			episodes: []collector.Episode{episode("7 - Primer", ""), episode("7 - Segon", ""), episode("7 - Tercer", "")},
+			want:     []string{"ep-7", "ep-7-2", "ep-7-3"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var ids []string
+			for _, ep := range g.convertToWebappEpisodes(tc.episodes, true) {
+				ids = append(ids, ep.ID)
+			}
+			if strings.Join(ids, " ") != strings.Join(tc.want, " ") {
+				t.Errorf("IDs = %v, want %v", ids, tc.want)
+			}
+		})
+	}
+}
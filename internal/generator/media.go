@@ -0,0 +1,31 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/p4u/enguardia-arxiu/internal/backend"
+)
+
+// listMedia indexes the files of the media backend once per generation, so
+// remote backends aren't queried for every episode
+func (g *Generator) listMedia(ctx context.Context) error {
+	files, err := g.media.List(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to list media: %w", err)
+	}
+	g.mediaFiles = make(map[string]backend.Info, len(files))
+	for _, file := range files {
+		g.mediaFiles[file.Name] = file
+	}
+	return nil
+}
+
+// mediaFile describes a stored media file
+func (g *Generator) mediaFile(name string) (backend.Info, bool) {
+	if name == "" {
+		return backend.Info{}, false
+	}
+	info, ok := g.mediaFiles[name]
+	return info, ok
+}
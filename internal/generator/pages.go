@@ -0,0 +1,338 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/atomicfile"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+)
+
+// pageTemplate is the static page of an episode: the metadata read by link
+// previews and search engines, and a readable version with a link to the
+// episode in the webapp
+var pageTemplate = template.Must(template.New("episode").Parse(`<!doctype html>
+<html lang="{{.Language}}">
+  <head>
+    <meta charset="UTF-8" />
+    <meta name="viewport" content="width=device-width, initial-scale=1.0" />
+    <title>{{.Title}} - {{.SiteName}}</title>
+    <meta name="description" content="{{.Description}}" />
+    <link rel="canonical" href="{{.URL}}" />
+
+    <meta property="og:type" content="article" />
+    <meta property="og:site_name" content="{{.SiteName}}" />
+    <meta property="og:title" content="{{.Title}}" />
+    <meta property="og:description" content="{{.Description}}" />
+    <meta property="og:url" content="{{.URL}}" />
+    <meta property="og:locale" content="{{.Locale}}" />
+{{- if .Image}}
+    <meta property="og:image" content="{{.Image}}" />
+{{- if .ImageAlt}}
+    <meta property="og:image:alt" content="{{.ImageAlt}}" />
+{{- end}}
+{{- end}}
+{{- if .Audio}}
+    <meta property="og:audio" content="{{.Audio}}" />
+    <meta property="og:audio:type" content="{{.AudioType}}" />
+{{- end}}
+{{- if .Published}}
+    <meta property="article:published_time" content="{{.Published}}" />
+{{- end}}
+
+    <meta name="twitter:card" content="{{if .Image}}summary_large_image{{else}}summary{{end}}" />
+    <meta name="twitter:title" content="{{.Title}}" />
+    <meta name="twitter:description" content="{{.Description}}" />
+{{- if .Image}}
+    <meta name="twitter:image" content="{{.Image}}" />
+{{- end}}
+
+    <script type="application/ld+json">{{.JSONLD}}</script>
+  </head>
+  <body>
+    <h1>{{.Title}}</h1>
+{{- if .Image}}
+    <img src="{{.Image}}" alt="{{.ImageAlt}}" width="400" />
+{{- end}}
+    <p>{{.Description}}</p>
+{{- if .Audio}}
+    <audio controls preload="none" src="{{.Audio}}"></audio>
+{{- end}}
+    <p><a href="{{.AppURL}}">{{.SiteName}}</a></p>
+  </body>
+</html>
+`))
+
+// episodePage holds the values of the page of an episode
+type episodePage struct {
+	ID          string
+	Language    string
+	Locale      string
+	SiteName    string
+	Title       string
+	Description string
+	URL         string // Canonical URL of the page
+	AppURL      string // Episode in the webapp
+	Image       string
+	ImageAlt    string
+	Audio       string
+	AudioType   string
+	Published   string
+	JSONLD      podcastEpisode
+}
+
+// podcastEpisode is the schema.org description of an episode
+type podcastEpisode struct {
+	Context         string        `json:"@context"`
+	Type            string        `json:"@type"`
+	URL             string        `json:"url"`
+	Name            string        `json:"name"`
+	Description     string        `json:"description,omitempty"`
+	EpisodeNumber   int           `json:"episodeNumber,omitempty"`
+	DatePublished   string        `json:"datePublished,omitempty"`
+	TimeRequired    string        `json:"timeRequired,omitempty"`
+	InLanguage      string        `json:"inLanguage,omitempty"`
+	Image           string        `json:"image,omitempty"`
+	Keywords        []string      `json:"keywords,omitempty"`
+	AssociatedMedia *mediaObject  `json:"associatedMedia,omitempty"`
+	PartOfSeries    podcastSeries `json:"partOfSeries"`
+}
+
+type mediaObject struct {
+	Type           string `json:"@type"`
+	ContentURL     string `json:"contentUrl"`
+	EncodingFormat string `json:"encodingFormat"`
+	ContentSize    int64  `json:"contentSize,omitempty"`
+}
+
+type podcastSeries struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// sitemap is a sitemaps.org URL set
+type sitemap struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// generateSite writes a static page per episode and the sitemap into the
+// site directory, dropping the pages of removed episodes
+func (g *Generator) generateSite(episodes []Episode) error {
+	pagesDir := filepath.Join(g.siteDir, constants.EpisodePagesDir)
+	sitemapPath := filepath.Join(g.siteDir, constants.SitemapFile)
+
+	var pages []episodePage
+	urls := []sitemapURL{{Loc: g.opts.SiteURL}}
+	for _, ep := range episodes {
+		if ep.ID == "" {
+			continue
+		}
+		page := g.episodePage(ep)
+		pages = append(pages, page)
+		urls = append(urls, sitemapURL{Loc: page.URL, LastMod: lastMod(ep)})
+		// The home page changes with its latest episode
+		if urls[len(urls)-1].LastMod > urls[0].LastMod {
+			urls[0].LastMod = urls[len(urls)-1].LastMod
+		}
+	}
+
+	if g.opts.DryRun {
+		slog.Info("Dry run: would write episode pages", "dir", pagesDir, "pages", len(pages))
+		slog.Info("Dry run: would write", "file", sitemapPath)
+		return nil
+	}
+
+	if err := g.writePages(pagesDir, pages); err != nil {
+		return fmt.Errorf("failed to write episode pages: %w", err)
+	}
+
+	err := atomicfile.Write(sitemapPath, constants.FilePermissions, func(w io.Writer) error {
+		if _, err := io.WriteString(w, xml.Header); err != nil {
+			return err
+		}
+		encoder := xml.NewEncoder(w)
+		encoder.Indent("", "  ")
+		if err := encoder.Encode(sitemap{Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9", URLs: urls}); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "\n")
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write sitemap: %w", err)
+	}
+
+	slog.Info("Generated episode pages", "dir", pagesDir, "pages", len(pages))
+	return nil
+}
+
+// writePages writes the episode pages into pagesDir, part of the staging copy
+// of the site directory that already holds the current pages
+func (g *Generator) writePages(pagesDir string, pages []episodePage) error {
+	if err := os.MkdirAll(pagesDir, constants.DirPermissions); err != nil {
+		return fmt.Errorf("failed to create pages directory: %w", err)
+	}
+
+	// Drop the pages of removed episodes
+	current := make(map[string]bool, len(pages))
+	for _, page := range pages {
+		current[page.ID] = true
+	}
+	entries, err := os.ReadDir(pagesDir)
+	if err != nil {
+		return fmt.Errorf("failed to list pages: %w", err)
+	}
+	for _, entry := range entries {
+		if !current[entry.Name()] {
+			if err := os.RemoveAll(filepath.Join(pagesDir, entry.Name())); err != nil {
+				return fmt.Errorf("failed to remove page: %w", err)
+			}
+		}
+	}
+
+	for _, page := range pages {
+		var buf bytes.Buffer
+		if err := pageTemplate.Execute(&buf, page); err != nil {
+			return fmt.Errorf("failed to render page of %s: %w", page.ID, err)
+		}
+		pageDir := filepath.Join(pagesDir, page.ID)
+		if err := os.MkdirAll(pageDir, constants.DirPermissions); err != nil {
+			return fmt.Errorf("failed to create page directory: %w", err)
+		}
+		if err := atomicfile.WriteFile(filepath.Join(pageDir, "index.html"), buf.Bytes(), constants.FilePermissions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRobots writes the robots.txt of the site directory, pointing crawlers
+// to the sitemaps
+func (g *Generator) writeRobots(sitemaps []string) error {
+	path := filepath.Join(g.siteDir, constants.RobotsFile)
+	if g.opts.DryRun {
+		slog.Info("Dry run: would write", "file", path)
+		return nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("User-agent: *\nAllow: /\n")
+	for _, sitemap := range sitemaps {
+		fmt.Fprintf(&buf, "Sitemap: %s\n", sitemap)
+	}
+	if err := os.MkdirAll(g.siteDir, constants.DirPermissions); err != nil {
+		return fmt.Errorf("failed to create site directory: %w", err)
+	}
+	if err := atomicfile.WriteFile(path, buf.Bytes(), constants.FilePermissions); err != nil {
+		return fmt.Errorf("failed to write robots.txt: %w", err)
+	}
+	return nil
+}
+
+// lastMod returns the sitemap date of an episode: when its metadata last
+// changed, or its broadcast date
+func lastMod(ep Episode) string {
+	if t, err := time.Parse(time.RFC3339, ep.LastModified); err == nil {
+		return t.UTC().Format("2006-01-02")
+	}
+	if !ep.ParsedDate.IsZero() {
+		return ep.ParsedDate.Format("2006-01-02")
+	}
+	return ""
+}
+
+// episodePage returns the page values of an episode, with absolute URLs
+func (g *Generator) episodePage(ep Episode) episodePage {
+	page := episodePage{
+		ID:          ep.ID,
+		Language:    g.program.Language,
+		Locale:      locale(g.program.Language),
+		SiteName:    g.program.Title,
+		Title:       ep.Title,
+		Description: ep.Description,
+		URL:         g.siteURL(constants.EpisodePagesDir + "/" + ep.ID + "/"),
+		AppURL:      g.siteURL("episode/" + ep.ID),
+		Image:       g.siteURL(ep.Image),
+		ImageAlt:    ep.ImageAlt,
+	}
+	// The placeholder audio is never shared
+	if ep.Available && !strings.Contains(ep.AudioURL, constants.FailedAudioKeyword) {
+		page.Audio = g.siteURL(ep.AudioURL)
+		page.AudioType = ep.AudioType
+	}
+	if !ep.ParsedDate.IsZero() {
+		page.Published = ep.ParsedDate.Format("2006-01-02")
+	}
+
+	page.JSONLD = podcastEpisode{
+		Context:       "https://schema.org",
+		Type:          "PodcastEpisode",
+		URL:           page.URL,
+		Name:          ep.Title,
+		Description:   ep.Description,
+		EpisodeNumber: g.extractEpisodeNumber(ep.Title),
+		DatePublished: page.Published,
+		InLanguage:    page.Language,
+		Image:         page.Image,
+		Keywords:      ep.Tags,
+		PartOfSeries:  podcastSeries{Type: "PodcastSeries", Name: g.program.Title, URL: g.opts.SiteURL},
+	}
+	if seconds := g.parseDurationToSeconds(ep.Duration); seconds > 0 {
+		page.JSONLD.TimeRequired = fmt.Sprintf("PT%dM%dS", seconds/60, seconds%60)
+	}
+	if page.Audio != "" {
+		page.JSONLD.AssociatedMedia = &mediaObject{
+			Type:           "MediaObject",
+			ContentURL:     page.Audio,
+			EncodingFormat: page.AudioType,
+			ContentSize:    ep.FileSize,
+		}
+	}
+	return page
+}
+
+// siteURL resolves a webapp reference against the site URL, empty stays empty
+func (g *Generator) siteURL(ref string) string {
+	if ref == "" {
+		return ""
+	}
+	base, err := url.Parse(g.opts.SiteURL)
+	if err != nil {
+		return ref
+	}
+	resolved, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return resolved.String()
+}
+
+// locale returns the Open Graph locale of a language code
+func locale(language string) string {
+	switch language {
+	case "", "ca":
+		return "ca_ES"
+	case "es":
+		return "es_ES"
+	case "en":
+		return "en_GB"
+	}
+	return language
+}
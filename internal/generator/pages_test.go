@@ -0,0 +1,153 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+	"github.com/p4u/enguardia-arxiu/internal/fake3cat"
+	"github.com/p4u/enguardia-arxiu/internal/storage"
+)
+
+func TestGeneratePages(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	dataDir := newFakeDataDir(t, srv, "m4a", "mp3")
+
+	// A rebroadcast with the same number gets its own page
+	st := storage.NewStorage(dataDir)
+	episodes, err := st.LoadEpisodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rebroadcast := range episodes {
+		if rebroadcast.Number() != 1245 {
+			continue
+		}
+		rebroadcast.Title += " (reemissió)"
+		rebroadcast.Link = strings.Replace(rebroadcast.Link, "/1001/", "/1009/", 1)
+		rebroadcast.JSONFile = "1245-la-batalla-de-l-ebre-reemissio.json"
+		rebroadcast.History = nil
+		if _, err := st.SaveEpisode(rebroadcast); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	siteDir := t.TempDir()
+	stale := filepath.Join(siteDir, constants.EpisodePagesDir, "ep-9999", "index.html")
+	if err := os.MkdirAll(filepath.Dir(stale), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stale, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	outputDir := filepath.Join(t.TempDir(), "data")
+	opts := fakeOptions(t, srv)
+	opts.SiteDir = siteDir
+	opts.SiteURL = "https://arxiu.example.cat/enguardia"
+	if err := NewGeneratorWithOptions(dataDir, opts).GenerateWebappData(context.Background(), outputDir, true); err != nil {
+		t.Fatal(err)
+	}
+
+	readPage := func(id string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(siteDir, constants.EpisodePagesDir, id, "index.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	page := readPage("ep-1245")
+	for _, want := range []string{
+		`<meta property="og:title" content="1245 - La batalla de l&#39;Ebre" />`,
+		`<meta property="og:url" content="https://arxiu.example.cat/enguardia/episodes/ep-1245/" />`,
+		`<meta property="og:audio" content="` + srv.MediaBaseURL(),
+		`<meta property="og:audio:type" content="audio/mpeg" />`,
+		`<a href="https://arxiu.example.cat/enguardia/episode/ep-1245">`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("Expected the page to contain %q, got:\n%s", want, page)
+		}
+	}
+	if strings.Contains(page, "location.replace") {
+		t.Errorf("Expected the page not to redirect, got:\n%s", page)
+	}
+	if page := readPage("ep-1245-1009"); !strings.Contains(page, "(reemissió)") {
+		t.Errorf("Expected the rebroadcast on its own page, got:\n%s", page)
+	}
+
+	start := strings.Index(page, `<script type="application/ld+json">`)
+	end := strings.Index(page[start:], "</script>")
+	if start < 0 || end < 0 {
+		t.Fatalf("No JSON-LD in the page:\n%s", page)
+	}
+	var ld struct {
+		Type            string `json:"@type"`
+		EpisodeNumber   int    `json:"episodeNumber"`
+		AssociatedMedia struct {
+			ContentURL     string `json:"contentUrl"`
+			EncodingFormat string `json:"encodingFormat"`
+		} `json:"associatedMedia"`
+	}
+	if err := json.Unmarshal([]byte(page[start+len(`<script type="application/ld+json">`):start+end]), &ld); err != nil {
+		t.Fatalf("Invalid JSON-LD: %v", err)
+	}
+	if ld.Type != "PodcastEpisode" || ld.EpisodeNumber != 1245 || ld.AssociatedMedia.ContentURL == "" || ld.AssociatedMedia.EncodingFormat != "audio/mpeg" {
+		t.Errorf("Unexpected JSON-LD %+v", ld)
+	}
+
+	// The audio type follows the rendition picked
+	if page := readPage("ep-1243"); !strings.Contains(page, `<meta property="og:audio:type" content="audio/mp4" />`) || !strings.Contains(page, `"encodingFormat":"audio/mp4"`) {
+		t.Errorf("Expected the M4A audio type, got:\n%s", page)
+	}
+
+	// The episode without audio has no og:audio
+	if strings.Contains(readPage("ep-1242"), "og:audio") {
+		t.Errorf("Expected no og:audio for the fallback episode")
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("Expected the page of the removed episode to be deleted, got %v", err)
+	}
+
+	sitemap, err := os.ReadFile(filepath.Join(siteDir, constants.SitemapFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(sitemap), "<loc>"); n != 7 {
+		t.Errorf("Expected the home page and 6 episodes in the sitemap, got %d:\n%s", n, sitemap)
+	}
+	if !strings.Contains(string(sitemap), "<loc>https://arxiu.example.cat/enguardia/episodes/ep-1241/</loc>") {
+		t.Errorf("Missing episode page in the sitemap:\n%s", sitemap)
+	}
+	if n := strings.Count(string(sitemap), "<lastmod>"); n != 7 {
+		t.Errorf("Expected a lastmod for every page, got %d:\n%s", n, sitemap)
+	}
+
+	robots, err := os.ReadFile(filepath.Join(siteDir, constants.RobotsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(robots), "Sitemap: https://arxiu.example.cat/enguardia/sitemap.xml\n") {
+		t.Errorf("Expected robots.txt to point to the sitemap, got:\n%s", robots)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg struct {
+		SiteURL    string `json:"siteUrl"`
+		EpisodeURL string `json:"episodeUrl"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SiteURL != "https://arxiu.example.cat/enguardia/" || cfg.EpisodeURL != "https://arxiu.example.cat/enguardia/episodes/{id}/" {
+		t.Errorf("Unexpected canonical URLs %+v", cfg)
+	}
+}
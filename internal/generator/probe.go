@@ -0,0 +1,223 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+)
+
+// probeResult is the answer of the CDN for a remote audio URL
+type probeResult struct {
+	CheckedAt     time.Time `json:"checked_at"`
+	Status        int       `json:"status"`
+	ContentLength int64     `json:"content_length,omitempty"`
+	ContentType   string    `json:"content_type,omitempty"`
+}
+
+// available reports whether the audio was served
+func (r probeResult) available() bool {
+	return r.Status == http.StatusOK || r.Status == http.StatusPartialContent
+}
+
+// probeCache holds the probe results of a data directory, keyed by audio URL
+type probeCache struct {
+	Results map[string]probeResult `json:"results"`
+}
+
+// probeRemoteAudio checks the remote audio of the episodes the webapp would
+// stream from 3Cat and keeps the results in g.probes. Results younger than the
+// TTL are reused from the cache file; failed probes keep the previous result,
+// or leave the episode unchecked. When the context is cancelled the results so
+// far are cached and the context error is returned.
+func (g *Generator) probeRemoteAudio(ctx context.Context, episodes []collector.Episode, lazy bool) error {
+	cachePath := filepath.Join(g.dataDir, constants.ProbeCacheFile)
+	cache, err := loadProbeCache(cachePath)
+	if err != nil {
+		slog.Warn("Ignoring unreadable probe cache", "file", cachePath, "error", err)
+		cache = probeCache{Results: make(map[string]probeResult)}
+	}
+
+	now := time.Now()
+	var pending []string
+	known := make(map[string]bool)
+	queued := make(map[string]bool)
+	for _, ep := range episodes {
+		known[ep.AudioURL] = true
+		if !ep.RemoteAudio() || ep.HasFallbackAudio() || (!lazy && g.hasAudio(ep)) || queued[ep.AudioURL] {
+			continue
+		}
+		queued[ep.AudioURL] = true
+		if result, ok := cache.Results[ep.AudioURL]; ok && now.Sub(result.CheckedAt) < g.opts.ProbeTTL {
+			continue
+		}
+		pending = append(pending, ep.AudioURL)
+	}
+
+	slog.Info("Probing remote audio", "episodes", len(queued), "cached", len(queued)-len(pending))
+	failed := 0
+	for url, result := range g.probeURLs(ctx, pending) {
+		if result.Status == 0 {
+			failed++
+			continue
+		}
+		cache.Results[url] = result
+	}
+	if failed > 0 {
+		slog.Warn("Some remote audio probes failed", "failed", failed)
+	}
+
+	// Forget the URLs of the episodes gone or moved
+	for url := range cache.Results {
+		if !known[url] {
+			delete(cache.Results, url)
+		}
+	}
+	g.probes = cache.Results
+
+	if err := g.writeJSONFile(cachePath, cache); err != nil {
+		return fmt.Errorf("failed to write probe cache: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("probing interrupted: %w", err)
+	}
+	return nil
+}
+
+// probeURLs probes the URLs with a bounded number of workers, starting at most
+// one request per probe interval. Failed probes have a zero status; once the
+// context is cancelled no more probes start and the cancelled ones are left out.
+func (g *Generator) probeURLs(ctx context.Context, urls []string) map[string]probeResult {
+	results := make(map[string]probeResult, len(urls))
+	if len(urls) == 0 {
+		return results
+	}
+
+	ticker := time.NewTicker(g.opts.ProbeInterval)
+	defer ticker.Stop()
+
+	jobs := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < g.opts.ProbeConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for url := range jobs {
+				result, err := g.probeURL(ctx, url)
+				if ctx.Err() != nil {
+					continue
+				}
+				if err != nil {
+					slog.Debug("Failed to probe remote audio", "url", url, "error", err)
+				}
+				mu.Lock()
+				results[url] = result
+				mu.Unlock()
+			}
+		}()
+	}
+send:
+	for i, url := range urls {
+		if i > 0 {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				break send
+			}
+		}
+		select {
+		case jobs <- url:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// probeURL sends a HEAD request or, for servers that refuse it, a one-byte
+// ranged GET. Only served (2xx) and missing (404, 410) audio is a result.
+func (g *Generator) probeURL(ctx context.Context, url string) (probeResult, error) {
+	resp, err := g.probeRequest(ctx, http.MethodHead, url)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp, err = g.probeRequest(ctx, http.MethodGet, url)
+	}
+	if err != nil {
+		return probeResult{}, err
+	}
+
+	result := probeResult{
+		CheckedAt:     time.Now().UTC(),
+		Status:        resp.StatusCode,
+		ContentLength: resp.ContentLength,
+		ContentType:   resp.Header.Get("Content-Type"),
+	}
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		// The length is the one byte asked for, the size follows the slash
+		result.ContentLength = 0
+		if _, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/"); ok {
+			result.ContentLength, _ = strconv.ParseInt(total, 10, 64)
+		}
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		result.ContentLength = 0
+	default:
+		return probeResult{}, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if result.ContentLength < 0 {
+		result.ContentLength = 0
+	}
+	return result, nil
+}
+
+func (g *Generator) probeRequest(ctx context.Context, method, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	if method == http.MethodGet {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+	resp, err := g.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if err := resp.Body.Close(); err != nil {
+		slog.Warn("Failed to close response body", "error", err)
+	}
+	return resp, nil
+}
+
+// loadProbeCache reads a probe cache file, a missing file is an empty cache
+func loadProbeCache(path string) (probeCache, error) {
+	cache := probeCache{Results: make(map[string]probeResult)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return cache, err
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return cache, err
+	}
+	if cache.Results == nil {
+		cache.Results = make(map[string]probeResult)
+	}
+	return cache, nil
+}
@@ -0,0 +1,129 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+	"github.com/p4u/enguardia-arxiu/internal/fake3cat"
+)
+
+// audioRequests counts the requests for audio the fake 3Cat server received
+func audioRequests(srv *fake3cat.Server) int {
+	n := 0
+	for _, uri := range srv.Requests() {
+		if strings.HasPrefix(uri, "/multimedia/mp3/") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestProbeRemoteAudio(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	dataDir := newFakeDataDir(t, srv)
+	srv.FailMedia("mp3/1/0/1001.mp3", http.StatusNotFound)
+
+	opts := fakeOptions(t, srv)
+	opts.ProbeAudio = true
+	opts.ProbeInterval = time.Millisecond
+	generate := func() map[string]webappEpisode {
+		t.Helper()
+		outputDir := filepath.Join(t.TempDir(), "data")
+		if err := NewGeneratorWithOptions(dataDir, opts).GenerateWebappData(context.Background(), outputDir, true); err != nil {
+			t.Fatal(err)
+		}
+		return readEpisodes(t, outputDir)
+	}
+
+	// The dead URL and the fallback audio are unavailable, the rest carry their size
+	episodes := generate()
+	for id, ep := range episodes {
+		wantAvailable := id != "ep-1245" && id != "ep-1242"
+		if ep.Available != wantAvailable {
+			t.Errorf("Episode %s available = %v, want %v", id, ep.Available, wantAvailable)
+		}
+		if wantAvailable && ep.FileSize != fake3cat.AudioSize {
+			t.Errorf("Episode %s file size = %d, want %d", id, ep.FileSize, fake3cat.AudioSize)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, constants.ProbeCacheFile)); err != nil {
+		t.Errorf("Expected the probe cache: %v", err)
+	}
+
+	// Fresh results are reused, expired ones are checked again
+	probed := audioRequests(srv)
+	if episodes := generate(); episodes["ep-1245"].Available || !episodes["ep-1243"].Available {
+		t.Errorf("Cached probes changed availability: %+v", episodes)
+	}
+	if n := audioRequests(srv); n != probed {
+		t.Errorf("Generate with a fresh cache sent %d probes", n-probed)
+	}
+	opts.ProbeTTL = time.Nanosecond
+	generate()
+	if n := audioRequests(srv); n != probed+4 {
+		t.Errorf("Generate with an expired cache sent %d probes, want 4", n-probed)
+	}
+}
+
+func TestProbeRemoteAudioCancelled(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	dataDir := newFakeDataDir(t, srv)
+
+	opts := fakeOptions(t, srv)
+	opts.ProbeAudio = true
+	opts.ProbeInterval = time.Hour
+	opts.ProbeConcurrency = 1
+
+	// Cancelled while waiting to send the second probe
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	outputDir := filepath.Join(t.TempDir(), "data")
+	done := make(chan error, 1)
+	go func() {
+		done <- NewGeneratorWithOptions(dataDir, opts).GenerateWebappData(ctx, outputDir, true)
+	}()
+	for start := time.Now(); audioRequests(srv) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("No probe was sent")
+		}
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected the generation to be cancelled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Generation did not stop when cancelled")
+	}
+	if _, err := os.Stat(outputDir); !os.IsNotExist(err) {
+		t.Errorf("Expected no output from a cancelled generation: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dataDir, constants.ProbeCacheFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cache probeCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.Results) > 1 {
+		t.Errorf("Expected at most the first probe to be cached, got %v", cache.Results)
+	}
+	for url, result := range cache.Results {
+		if result.Status == 0 {
+			t.Errorf("Cached a cancelled probe of %s", url)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+	"github.com/p4u/enguardia-arxiu/internal/program"
+)
+
+// ProgramSummary describes one programme of a multi-programme site
+type ProgramSummary struct {
+	Slug           string `json:"slug"`
+	Title          string `json:"title"`
+	Description    string `json:"description"`
+	Language       string `json:"language"`
+	DataPath       string `json:"dataPath"`
+	TotalEpisodes  int    `json:"totalEpisodes"`
+	AvailableCount int    `json:"availableCount"`
+}
+
+// GenerateMultiProgramData generates the webapp data of every programme into
+// its own subdirectory of outputDir, plus a programs.json index. Like
+// GenerateWebappData, outputDir and the site directory are replaced together
+// once complete.
+func GenerateMultiProgramData(ctx context.Context, outputDir string, lazy bool, programs []program.Program, opts Options) error {
+	g := &Generator{opts: opts}
+	return g.publish(outputDir, func(dir, siteDir string) error {
+		return generatePrograms(ctx, dir, siteDir, lazy, programs, opts)
+	})
+}
+
+func generatePrograms(ctx context.Context, outputDir, siteDir string, lazy bool, programs []program.Program, opts Options) error {
+	var summaries []ProgramSummary
+	var sitemaps []string
+
+	for _, p := range programs {
+		if _, err := os.Stat(p.DataDir); os.IsNotExist(err) {
+			slog.Warn("Skipping programme without data directory", "program", p.Name, "dir", p.DataDir)
+			continue
+		}
+
+		programOpts := opts
+		programOpts.Program = p
+		programOpts.TagsFile = ""
+		programOpts.Title, programOpts.Description, programOpts.Language = "", "", ""
+		if opts.SiteDir != "" {
+			programOpts.SiteDir = filepath.Join(opts.SiteDir, p.Slug)
+			programOpts.SiteURL = strings.TrimSuffix(opts.SiteURL, "/") + "/" + p.Slug + "/"
+		}
+		g := NewGeneratorWithOptions(p.DataDir, programOpts)
+		g.dataURL = "./data/" + p.Slug
+		if siteDir != "" {
+			g.siteDir = filepath.Join(siteDir, p.Slug)
+		}
+
+		stats, err := g.generate(ctx, filepath.Join(outputDir, p.Slug), lazy)
+		if err != nil {
+			return fmt.Errorf("failed to generate %s: %w", p.Slug, err)
+		}
+
+		if programOpts.SiteDir != "" {
+			sitemaps = append(sitemaps, programOpts.SiteURL+constants.SitemapFile)
+		}
+		summaries = append(summaries, ProgramSummary{
+			Slug:           p.Slug,
+			Title:          p.Title,
+			Description:    p.Description,
+			Language:       p.Language,
+			DataPath:       "data/" + p.Slug,
+			TotalEpisodes:  stats.TotalEpisodes,
+			AvailableCount: stats.AvailableCount,
+		})
+	}
+
+	if !opts.DryRun {
+		if err := os.MkdirAll(outputDir, constants.DirPermissions); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+
+	g := &Generator{opts: opts, siteDir: siteDir}
+	if err := g.writeJSONFile(filepath.Join(outputDir, constants.DefaultProgramsFile), summaries); err != nil {
+		return fmt.Errorf("failed to write programs index: %w", err)
+	}
+
+	if opts.SiteDir != "" {
+		if err := g.writeRobots(sitemaps); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Generated data for every programme", "programmes", len(summaries), "dir", outputDir)
+	return nil
+}
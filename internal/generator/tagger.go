@@ -3,19 +3,28 @@ package generator
 import (
 	"encoding/json"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/p4u/enguardia-arxiu/internal/atomicfile"
+	"github.com/p4u/enguardia-arxiu/internal/catalog"
 	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+	"github.com/p4u/enguardia-arxiu/internal/program"
 )
 
 // TagSystem handles episode tagging functionality
 type TagSystem struct {
 	dataDir string
+	rules   program.TagRules // Programme taxonomy, nil for the built-in history taxonomy
+	dryRun  bool
+	opts    Options
 }
 
 // EpisodeTags represents the tags for a single episode
@@ -50,26 +59,47 @@ func NewTagSystem(dataDir string) *TagSystem {
 	}
 }
 
+// NewTagSystemWithOptions creates a tag system using the taxonomy of the configured programme
+func NewTagSystemWithOptions(dataDir string, opts Options) *TagSystem {
+	ts := NewTagSystem(dataDir)
+	if len(opts.Program.Taxonomy) > 0 {
+		ts.rules = opts.Program.Taxonomy
+	}
+	ts.dryRun = opts.DryRun
+	ts.opts = opts
+	return ts
+}
+
 // GenerateTagsFile creates the initial tags.json file with discovered tags
 func (ts *TagSystem) GenerateTagsFile(outputPath string) error {
-	log.Println("Generating tags.json file with automatic tag discovery...")
+	slog.Info("Generating tags file with automatic tag discovery", "file", outputPath)
 
 	// Load episodes
-	episodes, err := ts.loadEpisodes()
+	var episodes []collector.Episode
+	var err error
+	if ts.opts.Catalog && !ts.dryRun {
+		episodes, err = syncCatalog(ts.dataDir, nil, ts.opts)
+	} else {
+		episodes, err = ts.loadEpisodes()
+	}
 	if err != nil {
 		return fmt.Errorf("failed to load episodes: %w", err)
 	}
 
 	// Initialize tag data structure
 	tagsData := TagsData{
-		Version:     "1.0.0",
-		LastUpdated: "2025-08-22T14:00:00Z",
-		Episodes:    make(map[string]EpisodeTags),
-		Taxonomy:    ts.createTaxonomy(),
+		Version:  "1.0.0",
+		Episodes: make(map[string]EpisodeTags),
+		Taxonomy: ts.createTaxonomy(),
 	}
 
 	// Process each episode
+	var latest time.Time
 	for _, episode := range episodes {
+		if t := changedAt(episode.LastModified(), episode.PublishedAt()); t.After(latest) {
+			latest = t
+		}
+
 		episodeKey := ts.generateEpisodeKey(episode.Title)
 		tags := ts.discoverTags(episode.Title, episode.Description)
 
@@ -81,12 +111,14 @@ func (ts *TagSystem) GenerateTagsFile(outputPath string) error {
 		}
 	}
 
+	tagsData.LastUpdated = ts.opts.timestamp(latest).Format(time.RFC3339)
+
 	// Write tags file
 	if err := ts.writeTagsFile(outputPath, tagsData); err != nil {
 		return fmt.Errorf("failed to write tags file: %w", err)
 	}
 
-	log.Printf("Successfully generated tags.json with %d episodes", len(tagsData.Episodes))
+	slog.Info("Generated tags file", "file", outputPath, "episodes", len(tagsData.Episodes))
 	ts.printTagStatistics(tagsData)
 
 	return nil
@@ -104,13 +136,13 @@ func (ts *TagSystem) loadEpisodes() ([]collector.Episode, error) {
 	for _, file := range files {
 		data, err := os.ReadFile(file)
 		if err != nil {
-			log.Printf("Warning: failed to read file %s: %v", file, err)
+			slog.Warn("Failed to read episode file", "file", file, "error", err)
 			continue
 		}
 
 		var episode collector.Episode
 		if err := json.Unmarshal(data, &episode); err != nil {
-			log.Printf("Warning: failed to parse JSON file %s: %v", file, err)
+			slog.Warn("Failed to parse episode file", "file", file, "error", err)
 			continue
 		}
 
@@ -146,36 +178,47 @@ func (ts *TagSystem) discoverTags(title, description string) map[string][]string
 	text := strings.ToLower(title + " " + description)
 	tags := make(map[string][]string)
 
-	// Discover period tags
-	tags["periods"] = ts.discoverPeriods(text)
-
-	// Discover topic tags
-	tags["topics"] = ts.discoverTopics(text)
-
-	// Discover location tags
-	tags["locations"] = ts.discoverLocations(text)
-
-	// Discover civilization tags
-	tags["civilizations"] = ts.discoverCivilizations(text)
-
-	// Discover event tags
-	tags["events"] = ts.discoverEvents(text)
-
-	// Remove empty categories
-	for category, tagList := range tags {
-		if len(tagList) == 0 {
-			delete(tags, category)
+	for category, patterns := range ts.taxonomy() {
+		if found := ts.discoverWithPatterns(text, patterns); len(found) > 0 {
+			tags[category] = found
 		}
 	}
 
 	return tags
 }
 
-// discoverPeriods identifies historical periods from text
-func (ts *TagSystem) discoverPeriods(text string) []string {
-	var periods []string
+// Evidence returns the discovered tags of an episode with the keyword that
+// triggered each of them
+func (ts *TagSystem) Evidence(title, description string) []catalog.Evidence {
+	text := strings.ToLower(title + " " + description)
+	rules := ts.taxonomy()
+
+	var evidence []catalog.Evidence
+	for _, category := range sortedCategories(rules) {
+		patterns := rules[category]
+		for _, tag := range sortedKeys(patterns) {
+			for _, keyword := range patterns[tag] {
+				if strings.Contains(text, strings.ToLower(keyword)) {
+					evidence = append(evidence, catalog.Evidence{Category: category, Tag: tag, Keyword: keyword})
+					break
+				}
+			}
+		}
+	}
+	return evidence
+}
 
-	periodPatterns := map[string][]string{
+// taxonomy returns the tagging rules of the programme, or the built-in ones
+func (ts *TagSystem) taxonomy() program.TagRules {
+	if ts.rules != nil {
+		return ts.rules
+	}
+	return builtinTaxonomy
+}
+
+// builtinTaxonomy holds the keywords of the history tags used by default
+var builtinTaxonomy = program.TagRules{
+	"periods": {
 		"prehistoria":        {"prehistòria", "neolític", "paleolític", "bronze", "ferro", "dinosaures"},
 		"antiguitat":         {"romà", "roma", "grec", "grècia", "fenici", "ibers", "cartaginesos"},
 		"alta-edat-mitjana":  {"carlemany", "carolingi", "visigot", "musulmà", "reconquesta", "comtes"},
@@ -186,25 +229,8 @@ func (ts *TagSystem) discoverPeriods(text string) []string {
 		"segle-xix":          {"napoleó", "francès", "liberal", "carlista", "industrial", "ferrocarril"},
 		"segle-xx":           {"república", "guerra civil", "franquisme", "segona guerra mundial"},
 		"contemporani":       {"transició", "democràcia", "autonomia", "generalitat"},
-	}
-
-	for period, keywords := range periodPatterns {
-		for _, keyword := range keywords {
-			if strings.Contains(text, keyword) {
-				periods = append(periods, period)
-				break
-			}
-		}
-	}
-
-	return ts.removeDuplicates(periods)
-}
-
-// discoverTopics identifies main topics from text
-func (ts *TagSystem) discoverTopics(text string) []string {
-	var topics []string
-
-	topicPatterns := map[string][]string{
+	},
+	"topics": {
 		"guerra":       {"guerra", "batalla", "setge", "militar", "combat", "conflicte"},
 		"biografia":    {"vida de", "personatge", "figura", "biografia"},
 		"politica":     {"rei", "reina", "comte", "duc", "política", "govern", "corts"},
@@ -215,25 +241,8 @@ func (ts *TagSystem) discoverTopics(text string) []string {
 		"ciencia":      {"medicina", "tècnica", "invenció", "descobriment", "científic"},
 		"arquitectura": {"catedral", "castell", "palau", "construcció", "arquitectura"},
 		"esport":       {"futbol", "boxa", "olimpíada", "esport", "competició"},
-	}
-
-	for topic, keywords := range topicPatterns {
-		for _, keyword := range keywords {
-			if strings.Contains(text, keyword) {
-				topics = append(topics, topic)
-				break
-			}
-		}
-	}
-
-	return ts.removeDuplicates(topics)
-}
-
-// discoverLocations identifies geographic locations from text
-func (ts *TagSystem) discoverLocations(text string) []string {
-	var locations []string
-
-	locationPatterns := map[string][]string{
+	},
+	"locations": {
 		"catalunya":   {"catalunya", "català", "barcelon", "girona", "lleida", "tarragona"},
 		"espanya":     {"espanya", "espanyol", "castella", "madrid", "toledo"},
 		"europa":      {"frança", "itàlia", "alemanya", "anglaterra", "europa"},
@@ -241,25 +250,8 @@ func (ts *TagSystem) discoverLocations(text string) []string {
 		"america":     {"amèrica", "cuba", "filipines", "colònies", "nou món"},
 		"africa":      {"àfrica", "marroc", "tunísia", "alger"},
 		"asia":        {"àsia", "orient", "xina", "índia"},
-	}
-
-	for location, keywords := range locationPatterns {
-		for _, keyword := range keywords {
-			if strings.Contains(text, keyword) {
-				locations = append(locations, location)
-				break
-			}
-		}
-	}
-
-	return ts.removeDuplicates(locations)
-}
-
-// discoverCivilizations identifies civilizations and peoples from text
-func (ts *TagSystem) discoverCivilizations(text string) []string {
-	var civilizations []string
-
-	civilizationPatterns := map[string][]string{
+	},
+	"civilizations": {
 		"romans":    {"romà", "roma", "imperi romà", "llatí"},
 		"grecs":     {"grec", "grècia", "hel·lènic", "atenes", "esparta"},
 		"musulmans": {"musulmà", "islam", "àrab", "moro", "andalusí"},
@@ -270,25 +262,8 @@ func (ts *TagSystem) discoverCivilizations(text string) []string {
 		"jueus":     {"jueu", "hebreu", "sinagoga", "rabí"},
 		"fenicis":   {"fenici", "cartaginès", "cartago", "púnic"},
 		"ibers":     {"iber", "ibèric", "indíget", "laietà"},
-	}
-
-	for civilization, keywords := range civilizationPatterns {
-		for _, keyword := range keywords {
-			if strings.Contains(text, keyword) {
-				civilizations = append(civilizations, civilization)
-				break
-			}
-		}
-	}
-
-	return ts.removeDuplicates(civilizations)
-}
-
-// discoverEvents identifies specific historical events from text
-func (ts *TagSystem) discoverEvents(text string) []string {
-	var events []string
-
-	eventPatterns := map[string][]string{
+	},
+	"events": {
 		"guerra-successio":  {"successió", "almenar", "almansa", "felip v"},
 		"guerra-segadors":   {"segadors", "pau claris", "revolució 1640"},
 		"guerra-frances":    {"francès", "napoleó", "independència"},
@@ -299,22 +274,37 @@ func (ts *TagSystem) discoverEvents(text string) []string {
 		"inquisicio":        {"inquisició", "tribunal", "heretge"},
 		"expulsio-jueus":    {"expulsió", "jueus", "1492"},
 		"expulsio-moriscos": {"expulsió", "moriscos", "felip iii"},
-	}
+	},
+}
+
+// discoverWithPatterns returns the tags whose keywords appear in the text
+func (ts *TagSystem) discoverWithPatterns(text string, patterns map[string][]string) []string {
+	var found []string
 
-	for event, keywords := range eventPatterns {
-		for _, keyword := range keywords {
-			if strings.Contains(text, keyword) {
-				events = append(events, event)
+	for _, tag := range sortedKeys(patterns) {
+		for _, keyword := range patterns[tag] {
+			if strings.Contains(text, strings.ToLower(keyword)) {
+				found = append(found, tag)
 				break
 			}
 		}
 	}
 
-	return ts.removeDuplicates(events)
+	return found
 }
 
 // createTaxonomy creates the complete taxonomy of available tags
 func (ts *TagSystem) createTaxonomy() TagTaxonomy {
+	if ts.rules != nil {
+		return TagTaxonomy{
+			Periods:       sortedKeys(ts.rules["periods"]),
+			Topics:        sortedKeys(ts.rules["topics"]),
+			Locations:     sortedKeys(ts.rules["locations"]),
+			Civilizations: sortedKeys(ts.rules["civilizations"]),
+			Events:        sortedKeys(ts.rules["events"]),
+		}
+	}
+
 	return TagTaxonomy{
 		Periods: []string{
 			"prehistoria", "antiguitat", "alta-edat-mitjana", "baixa-edat-mitjana",
@@ -357,36 +347,38 @@ func (ts *TagSystem) calculateConfidence(tags map[string][]string) float64 {
 	}
 }
 
-// removeDuplicates removes duplicate strings from a slice
-func (ts *TagSystem) removeDuplicates(slice []string) []string {
-	keys := make(map[string]bool)
-	var result []string
-
-	for _, item := range slice {
-		if !keys[item] {
-			keys[item] = true
-			result = append(result, item)
-		}
+// sortedCategories returns the categories of a taxonomy in alphabetical order
+func sortedCategories(rules program.TagRules) []string {
+	categories := make([]string, 0, len(rules))
+	for category := range rules {
+		categories = append(categories, category)
 	}
+	sort.Strings(categories)
+	return categories
+}
 
-	return result
+// sortedKeys returns the keys of a tag pattern map in alphabetical order
+func sortedKeys(patterns map[string][]string) []string {
+	keys := make([]string, 0, len(patterns))
+	for key := range patterns {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // writeTagsFile writes the tags data to a JSON file
 func (ts *TagSystem) writeTagsFile(outputPath string, data TagsData) error {
-	file, err := os.Create(outputPath)
-	if err != nil {
-		return err
+	if ts.dryRun {
+		slog.Info("Dry run: would write", "file", outputPath)
+		return nil
 	}
-	defer func() {
-		if closeErr := file.Close(); closeErr != nil {
-			log.Printf("Warning: failed to close file %s: %v", outputPath, closeErr)
-		}
-	}()
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	return encoder.Encode(data)
+	return atomicfile.Write(outputPath, constants.FilePermissions, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(data)
+	})
 }
 
 // printTagStatistics prints statistics about the generated tags
@@ -422,15 +414,18 @@ func (ts *TagSystem) printTagStatistics(data TagsData) {
 		}
 	}
 
-	// Print statistics
-	log.Println("\n=== TAG STATISTICS ===")
-	for category, counts := range tagCounts {
+	// Log statistics
+	categories := make([]string, 0, len(tagCounts))
+	for category := range tagCounts {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		counts := tagCounts[category]
 		if len(counts) == 0 {
 			continue
 		}
 
-		log.Printf("\n%s:", strings.ToUpper(category))
-
 		// Sort by count
 		type tagCount struct {
 			tag   string
@@ -441,15 +436,18 @@ func (ts *TagSystem) printTagStatistics(data TagsData) {
 			sorted = append(sorted, tagCount{tag, count})
 		}
 		sort.Slice(sorted, func(i, j int) bool {
-			return sorted[i].count > sorted[j].count
+			if sorted[i].count != sorted[j].count {
+				return sorted[i].count > sorted[j].count
+			}
+			return sorted[i].tag < sorted[j].tag
 		})
 
-		// Print top tags
+		// Log top tags
 		for i, tc := range sorted {
 			if i >= 10 { // Limit to top 10
 				break
 			}
-			log.Printf("  %s: %d episodes", tc.tag, tc.count)
+			slog.Info("Tag statistics", "category", category, "tag", tc.tag, "episodes", tc.count)
 		}
 	}
 }
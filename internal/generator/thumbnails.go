@@ -0,0 +1,181 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png" // register PNG decoder for source images
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/atomicfile"
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+)
+
+// generateThumbnails creates resized JPEG thumbnails for every episode with a local
+// image, or with a remote one when RemoteThumbnails is set, and sets the
+// Thumbnail field of the matching webapp episode
+func (g *Generator) generateThumbnails(ctx context.Context, outputDir string, episodes []collector.Episode, webappEpisodes []Episode) {
+	thumbDir := filepath.Join(outputDir, constants.ThumbnailsDir)
+	if g.opts.DryRun {
+		slog.Info("Dry run: would create thumbnails", "dir", thumbDir)
+		return
+	}
+	if err := os.MkdirAll(thumbDir, constants.DirPermissions); err != nil {
+		slog.Warn("Failed to create thumbnails directory", "dir", thumbDir, "error", err)
+		return
+	}
+
+	created, webp := 0, 0
+	for i, ep := range episodes {
+		if ctx.Err() != nil {
+			return
+		}
+		if ep.ImageFilename == "" {
+			continue
+		}
+		// The standard library has no WebP decoder, those episodes keep the full image
+		if strings.EqualFold(filepath.Ext(ep.ImageFilename), constants.WebPExtension) {
+			webp++
+			continue
+		}
+
+		var open func() (io.ReadCloser, error)
+		var srcTime time.Time
+		if srcInfo, ok := g.mediaFile(ep.ImageFilename); ok && srcInfo.Size > 0 {
+			open = func() (io.ReadCloser, error) { return g.media.Get(ctx, ep.ImageFilename) }
+			srcTime = srcInfo.ModTime
+		} else if g.opts.RemoteThumbnails && ep.Image != "" {
+			open = func() (io.ReadCloser, error) { return g.fetchImage(ctx, ep.Image) }
+			// The remote image only changes with the episode metadata
+			srcTime = changedAt(ep.LastModified(), time.Time{})
+		} else {
+			continue
+		}
+
+		thumbName := strings.TrimSuffix(filepath.Base(ep.ImageFilename), filepath.Ext(ep.ImageFilename)) + constants.JPGExtension
+		thumbPath := filepath.Join(thumbDir, thumbName)
+
+		// Reuse thumbnails that are newer than their source image
+		if thumbInfo, err := os.Stat(thumbPath); err != nil || thumbInfo.ModTime().Before(srcTime) {
+			if err := g.createThumbnail(open, thumbPath, g.opts.ThumbnailWidth, g.opts.ThumbnailQuality); err != nil {
+				slog.Warn("Failed to create thumbnail", "image", ep.ImageFilename, "error", err)
+				continue
+			}
+			created++
+		}
+
+		webappEpisodes[i].Thumbnail = g.dataURL + "/" + constants.ThumbnailsDir + "/" + thumbName
+	}
+
+	slog.Info("Thumbnails ready", "dir", thumbDir, "created", created, "skipped_webp", webp)
+}
+
+// createThumbnail decodes a JPEG or PNG image and writes a JPEG scaled down
+// to the given width
+func (g *Generator) createThumbnail(open func() (io.ReadCloser, error), dstPath string, width, quality int) error {
+	src, err := open()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := src.Close(); closeErr != nil {
+			slog.Warn("Failed to close image", "error", closeErr)
+		}
+	}()
+
+	img, _, err := image.Decode(src)
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	thumb := resizeImage(img, width)
+
+	return atomicfile.Write(dstPath, constants.FilePermissions, func(w io.Writer) error {
+		if err := jpeg.Encode(w, thumb, &jpeg.Options{Quality: quality}); err != nil {
+			return fmt.Errorf("failed to encode thumbnail: %w", err)
+		}
+		return nil
+	})
+}
+
+// fetchImage requests a remote image, callers must close the body
+func (g *Generator) fetchImage(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	resp, err := g.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch image: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch image: status %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// resizeImage scales an image down to the given width keeping its aspect ratio.
+// Each destination pixel averages the box of source pixels it covers.
+// Images already narrower than width are only converted.
+func resizeImage(img image.Image, width int) *image.RGBA {
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	srcW, srcH := src.Bounds().Dx(), src.Bounds().Dy()
+	if srcW <= width || srcW == 0 {
+		return src
+	}
+
+	height := srcH * width / srcW
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := y * srcH / height
+		y1 := (y + 1) * srcH / height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := x * srcW / width
+			x1 := (x + 1) * srcW / width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, gr, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += int(p[0])
+					gr += int(p[1])
+					b += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+
+			d := dst.Pix[y*dst.Stride+x*4 : y*dst.Stride+x*4+4]
+			d[0] = uint8(r / n)
+			d[1] = uint8(gr / n)
+			d[2] = uint8(b / n)
+			d[3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
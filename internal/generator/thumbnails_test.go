@@ -0,0 +1,72 @@
+package generator
+
+import (
+	"context"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+	"github.com/p4u/enguardia-arxiu/internal/fake3cat"
+)
+
+func TestRemoteThumbnails(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	dataDir := newFakeDataDir(t, srv)
+
+	outputDir := filepath.Join(t.TempDir(), "data")
+	opts := fakeOptions(t, srv)
+	opts.RemoteThumbnails = true
+	imageRequests := func() int {
+		n := 0
+		for _, uri := range srv.Requests() {
+			if strings.HasSuffix(uri, ".jpg") || strings.HasSuffix(uri, ".png") {
+				n++
+			}
+		}
+		return n
+	}
+	generate := func() []string {
+		t.Helper()
+		if err := NewGeneratorWithOptions(dataDir, opts).GenerateWebappData(context.Background(), outputDir, true); err != nil {
+			t.Fatal(err)
+		}
+		var thumbnails []string
+		for _, ep := range readEpisodes(t, outputDir) {
+			if ep.Thumbnail != "" {
+				thumbnails = append(thumbnails, ep.Thumbnail)
+			}
+		}
+		return thumbnails
+	}
+
+	// Every episode with an image gets a thumbnail without downloading the images
+	if thumbnails := generate(); len(thumbnails) != 4 {
+		t.Fatalf("Expected 4 thumbnails, got %v", thumbnails)
+	}
+	if n := imageRequests(); n != 4 {
+		t.Errorf("Expected each image to be fetched once, got %d requests", n)
+	}
+	f, err := os.Open(filepath.Join(outputDir, constants.ThumbnailsDir, "1244-els-almogàvers.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if cfg, err := jpeg.DecodeConfig(f); err != nil || cfg.Width != constants.ThumbnailWidth {
+		t.Errorf("Expected a %d pixel wide JPEG thumbnail, got %+v (%v)", constants.ThumbnailWidth, cfg, err)
+	}
+
+	// The thumbnails are reused until the episode changes
+	if thumbnails := generate(); len(thumbnails) != 4 || imageRequests() != 4 {
+		t.Errorf("Expected the thumbnails to be reused, got %v after %d requests", thumbnails, imageRequests())
+	}
+
+	// Without remote thumbnails the images not stored locally get none
+	opts.RemoteThumbnails = false
+	if thumbnails := generate(); len(thumbnails) != 0 {
+		t.Errorf("Expected no thumbnails without local images, got %v", thumbnails)
+	}
+}
@@ -1,6 +1,10 @@
 package generator
 
-import "time"
+import (
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+)
 
 // WebappData represents the consolidated data structure for the webapp
 type WebappData struct {
@@ -11,21 +15,28 @@ type WebappData struct {
 
 // Episode represents an episode with webapp-specific fields
 type Episode struct {
-	ID          string    `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Duration    string    `json:"duration"`
-	Date        string    `json:"date"`
-	ParsedDate  time.Time `json:"parsedDate"`
-	Link        string    `json:"link"`
-	AudioURL    string    `json:"audioUrl"`
-	Image       string    `json:"image"`
-	Filename    string    `json:"filename"`
-	JSONFile    string    `json:"jsonFile"`
-	FileSize    int64     `json:"fileSize,omitempty"`
-	Available   bool      `json:"available"`
-	Tags        []string  `json:"tags,omitempty"`
-	Category    string    `json:"category,omitempty"`
+	ID           string                     `json:"id"`
+	Title        string                     `json:"title"`
+	Description  string                     `json:"description"`
+	Duration     string                     `json:"duration"`
+	Date         string                     `json:"date"`
+	ParsedDate   time.Time                  `json:"parsedDate"`
+	Link         string                     `json:"link"`
+	AudioURL     string                     `json:"audioUrl"`
+	AudioType    string                     `json:"audioType,omitempty"` // MIME type of the audio
+	Renditions   []collector.AudioRendition `json:"audioRenditions,omitempty"`
+	Image        string                     `json:"image"`
+	ImageAlt     string                     `json:"imageAlt,omitempty"`
+	Thumbnail    string                     `json:"thumbnail,omitempty"`
+	Filename     string                     `json:"filename"`
+	JSONFile     string                     `json:"jsonFile"`
+	FileSize     int64                      `json:"fileSize,omitempty"`
+	Available    bool                       `json:"available"`
+	Tags         []string                   `json:"tags,omitempty"`
+	Category     string                     `json:"category,omitempty"`
+	FirstSeen    string                     `json:"firstSeen,omitempty"`    // When the archive first stored the episode
+	LastModified string                     `json:"lastModified,omitempty"` // When its metadata last changed
+	Status       string                     `json:"status,omitempty"`       // upstream, local-only or lost
 }
 
 // Stats represents statistics about the episode collection
@@ -38,6 +49,8 @@ type Stats struct {
 	AudioFormats   []string  `json:"audioFormats"`
 	TotalFileSize  int64     `json:"totalFileSize"`
 	AvailableCount int       `json:"availableCount"`
+	LocalOnlyCount int       `json:"localOnlyCount"` // Removed from 3Cat, audio archived
+	LostCount      int       `json:"lostCount"`      // Removed from 3Cat, audio never downloaded
 	LastUpdated    time.Time `json:"lastUpdated"`
 }
 
@@ -53,6 +66,8 @@ type Config struct {
 	Description   string   `json:"description"`
 	Language      string   `json:"language"`
 	AudioBaseURL  string   `json:"audioBaseUrl"`
+	SiteURL       string   `json:"siteUrl"`    // Canonical URL of the webapp
+	EpisodeURL    string   `json:"episodeUrl"` // Canonical URL of an episode, {id} replaced by its ID
 	SupportsModes []string `json:"supportsModes"`
 	Version       string   `json:"version"`
 	BuildTime     string   `json:"buildTime"`
@@ -0,0 +1,98 @@
+package generator
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SourceDateEpochEnv fixes the build time of the generated files, in seconds
+// since the Unix epoch (https://reproducible-builds.org/specs/source-date-epoch/)
+const SourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+// Version returns the version of the running program: the module version of a
+// released build, the VCS revision stamped by go build, or git describe of the
+// working directory for go run; "dev" when none is known
+func Version() string {
+	info, ok := debug.ReadBuildInfo()
+	if ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+
+	if ok {
+		var revision string
+		modified := false
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				revision = setting.Value
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+		if revision != "" {
+			if len(revision) > 12 {
+				revision = revision[:12]
+			}
+			if modified {
+				revision += "-dirty"
+			}
+			return revision
+		}
+	}
+
+	if out, err := exec.Command("git", "describe", "--tags", "--always", "--dirty").Output(); err == nil {
+		if version := strings.TrimSpace(string(out)); version != "" {
+			return version
+		}
+	}
+	return "dev"
+}
+
+// SourceDateEpoch returns the time of SOURCE_DATE_EPOCH, false when unset
+func SourceDateEpoch() (time.Time, bool, error) {
+	value := os.Getenv(SourceDateEpochEnv)
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid %s %q: %w", SourceDateEpochEnv, value, err)
+	}
+	return time.Unix(seconds, 0).UTC(), true, nil
+}
+
+// buildVersion is Version, looked up once
+var buildVersion = sync.OnceValue(Version)
+
+// timestamp returns the time stamped on the generated files: the configured
+// build time, SOURCE_DATE_EPOCH, or else latest, the last change of the data,
+// so that generating the same data twice gives the same files
+func (opts Options) timestamp(latest time.Time) time.Time {
+	if !opts.BuildTime.IsZero() {
+		return opts.BuildTime.UTC()
+	}
+	t, ok, err := SourceDateEpoch()
+	if err != nil {
+		slog.Warn("Ignoring the source date epoch", "error", err)
+	}
+	if ok {
+		return t
+	}
+	return latest.UTC()
+}
+
+// changedAt returns the later of the last metadata change of an episode, an
+// RFC 3339 time, and its broadcast date
+func changedAt(lastModified string, date time.Time) time.Time {
+	if t, err := time.Parse(time.RFC3339, lastModified); err == nil && t.After(date) {
+		return t
+	}
+	return date
+}
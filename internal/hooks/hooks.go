@@ -0,0 +1,253 @@
+// Package hooks notifies webhooks and local commands about new episodes.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+	"github.com/p4u/enguardia-arxiu/internal/metrics"
+	"github.com/p4u/enguardia-arxiu/internal/report"
+)
+
+// EventNewEpisode is the event sent when an episode is found for the first time
+const EventNewEpisode = "new_episode"
+
+// Event is the JSON payload POSTed to webhooks and written to the stdin of commands
+type Event struct {
+	Event      string            `json:"event"`
+	Program    string            `json:"program"`
+	DetectedAt string            `json:"detected_at"`
+	Episode    collector.Episode `json:"episode"`
+}
+
+// DeadLetter is a delivery that failed after every retry, appended as a JSON
+// line to the dead-letter file
+type DeadLetter struct {
+	FailedAt string `json:"failed_at"`
+	Target   string `json:"target"` // Webhook URL or command
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error"`
+	Event    Event  `json:"event"`
+}
+
+// Options configures the hook targets and delivery
+type Options struct {
+	Webhooks       []string         // URLs receiving a POST with the event
+	Commands       []string         // Shell commands receiving the event on stdin
+	Retries        int              // Attempts after the first failure
+	RetryDelay     time.Duration    // Delay before the first retry, doubled on each retry
+	Timeout        time.Duration    // Timeout of each attempt
+	DeadLetterFile string           // Failed deliveries are appended here (empty = not kept)
+	Program        string           // Programme slug sent in the events
+	Client         *http.Client     // HTTP client for webhooks (nil = default client)
+	Now            func() time.Time // Clock used for event timestamps
+	DryRun         bool             // Log the deliveries instead of sending them
+	Report         *report.Report   // Run report receiving failed deliveries (nil = none)
+	Metrics        *metrics.Metrics // Metrics receiving retries and failures (nil = none)
+}
+
+// Dispatcher delivers events to the configured targets
+type Dispatcher struct {
+	opts Options
+}
+
+// target is a webhook or command
+type target struct {
+	name    string
+	deliver func(ctx context.Context, payload []byte) error
+}
+
+// NewDispatcher creates a dispatcher, empty options fall back to the defaults
+func NewDispatcher(opts Options) *Dispatcher {
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = constants.HookRetryDelay
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = constants.HookTimeout
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: opts.Timeout}
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Dispatcher{opts: opts}
+}
+
+// Enabled reports whether any target is configured
+func (d *Dispatcher) Enabled() bool {
+	return d != nil && len(d.opts.Webhooks)+len(d.opts.Commands) > 0
+}
+
+// NewEpisodes notifies every target about each episode, returning the number
+// of deliveries that failed after all retries
+func (d *Dispatcher) NewEpisodes(ctx context.Context, episodes []collector.Episode) int {
+	if !d.Enabled() || len(episodes) == 0 {
+		return 0
+	}
+
+	failed := 0
+	for _, episode := range episodes {
+		event := Event{
+			Event:      EventNewEpisode,
+			Program:    d.opts.Program,
+			DetectedAt: d.opts.Now().UTC().Format(time.RFC3339),
+			Episode:    episode,
+		}
+		for _, t := range d.targets() {
+			if err := d.send(ctx, t, event); err != nil {
+				failed++
+			}
+		}
+	}
+	return failed
+}
+
+func (d *Dispatcher) targets() []target {
+	var targets []target
+	for _, url := range d.opts.Webhooks {
+		targets = append(targets, target{name: url, deliver: d.webhook(url)})
+	}
+	for _, command := range d.opts.Commands {
+		targets = append(targets, target{name: command, deliver: d.command(command)})
+	}
+	return targets
+}
+
+// send delivers an event to a target with retries, writing a dead letter
+// when every attempt fails
+func (d *Dispatcher) send(ctx context.Context, t target, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal hook event: %w", err)
+	}
+
+	if d.opts.DryRun {
+		slog.Info("Dry run: would notify", "target", t.name, "episode", event.Episode.Title)
+		return nil
+	}
+
+	delay := d.opts.RetryDelay
+	attempts := 0
+	for {
+		attempts++
+		attemptCtx, cancel := context.WithTimeout(ctx, d.opts.Timeout)
+		err = t.deliver(attemptCtx, payload)
+		cancel()
+		if err == nil {
+			slog.Info("Hook notified", "target", t.name, "episode", event.Episode.Title, "attempts", attempts)
+			return nil
+		}
+		if attempts > d.opts.Retries || ctx.Err() != nil {
+			break
+		}
+
+		slog.Warn("Hook failed, retrying", "target", t.name, "episode", event.Episode.Title,
+			"attempt", attempts, "delay", delay.String(), "error", err)
+		d.opts.Metrics.Retry("hook")
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+
+	slog.Error("Hook failed", "target", t.name, "episode", event.Episode.Title, "attempts", attempts, "error", err)
+	d.opts.Report.Fail(event.Episode.Title, "hook", err)
+	d.opts.Metrics.Fail("hook", err)
+	d.deadLetter(DeadLetter{
+		FailedAt: d.opts.Now().UTC().Format(time.RFC3339),
+		Target:   t.name,
+		Attempts: attempts,
+		Error:    err.Error(),
+		Event:    event,
+	})
+	return err
+}
+
+// webhook POSTs the payload, any 2xx status is a success
+func (d *Dispatcher) webhook(url string) func(context.Context, []byte) error {
+	return func(ctx context.Context, payload []byte) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+		if err != nil {
+			return fmt.Errorf("invalid webhook request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := d.opts.Client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to call webhook: %w", err)
+		}
+		defer func() {
+			if err := resp.Body.Close(); err != nil {
+				slog.Warn("Failed to close response body", "error", err)
+			}
+		}()
+		_, _ = io.Copy(io.Discard, resp.Body)
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return metrics.WithClass(metrics.ClassHTTPStatus, fmt.Errorf("webhook returned status %s", resp.Status))
+		}
+		return nil
+	}
+}
+
+// command runs a shell command with the payload on stdin, exit status 0 is a success
+func (d *Dispatcher) command(command string) func(context.Context, []byte) error {
+	return func(ctx context.Context, payload []byte) error {
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Stdin = bytes.NewReader(payload)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			if out := strings.TrimSpace(string(output)); out != "" {
+				return fmt.Errorf("command failed: %w: %s", err, out)
+			}
+			return fmt.Errorf("command failed: %w", err)
+		}
+		return nil
+	}
+}
+
+// deadLetter appends a failed delivery to the dead-letter file
+func (d *Dispatcher) deadLetter(letter DeadLetter) {
+	if d.opts.DeadLetterFile == "" {
+		return
+	}
+
+	line, err := json.Marshal(letter)
+	if err != nil {
+		slog.Error("Failed to marshal dead letter", "error", err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(d.opts.DeadLetterFile), constants.DirPermissions); err != nil {
+		slog.Error("Failed to create dead-letter directory", "error", err)
+		return
+	}
+	file, err := os.OpenFile(d.opts.DeadLetterFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, constants.FilePermissions)
+	if err != nil {
+		slog.Error("Failed to open dead-letter file", "file", d.opts.DeadLetterFile, "error", err)
+		return
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		slog.Error("Failed to write dead letter", "file", d.opts.DeadLetterFile, "error", err)
+	}
+	if err := file.Close(); err != nil {
+		slog.Error("Failed to close dead-letter file", "file", d.opts.DeadLetterFile, "error", err)
+	}
+}
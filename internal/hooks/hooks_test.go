@@ -0,0 +1,127 @@
+package hooks
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+)
+
+var testEpisode = collector.Episode{Filename: "1245.mp3", Title: "1245 - La batalla de l'Ebre"}
+
+func fixedNow() time.Time { return time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC) }
+
+func TestWebhookRetries(t *testing.T) {
+	var calls atomic.Int32
+	var got Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("Invalid payload %s: %v", body, err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	d := NewDispatcher(Options{
+		Webhooks:   []string{srv.URL},
+		Retries:    2,
+		RetryDelay: time.Millisecond,
+		Program:    "en-guardia",
+		Now:        fixedNow,
+	})
+	if failed := d.NewEpisodes(context.Background(), []collector.Episode{testEpisode}); failed != 0 {
+		t.Fatalf("Expected the retry to succeed, %d failed", failed)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected 2 calls, got %d", calls.Load())
+	}
+	want := Event{Event: EventNewEpisode, Program: "en-guardia", DetectedAt: "2024-05-01T10:00:00Z", Episode: testEpisode}
+	if got.Event != want.Event || got.Program != want.Program || got.DetectedAt != want.DetectedAt || got.Episode.Filename != want.Episode.Filename {
+		t.Errorf("Event = %+v, want %+v", got, want)
+	}
+}
+
+func TestCommandAndDeadLetter(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "event.json")
+	deadLetters := filepath.Join(dir, "data", ".hooks-dead-letter")
+
+	d := NewDispatcher(Options{
+		Commands:       []string{"cat > " + out, "echo broken >&2; exit 3"},
+		Retries:        1,
+		RetryDelay:     time.Millisecond,
+		DeadLetterFile: deadLetters,
+		Now:            fixedNow,
+	})
+	if failed := d.NewEpisodes(context.Background(), []collector.Episode{testEpisode}); failed != 1 {
+		t.Fatalf("Expected 1 failed delivery, got %d", failed)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event Event
+	if err := json.Unmarshal(data, &event); err != nil || event.Episode.Title != testEpisode.Title {
+		t.Errorf("Command received %s (%v)", data, err)
+	}
+
+	file, err := os.Open(deadLetters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var letters []DeadLetter
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var letter DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			t.Fatalf("Invalid dead letter %s: %v", scanner.Text(), err)
+		}
+		letters = append(letters, letter)
+	}
+	if len(letters) != 1 {
+		t.Fatalf("Expected 1 dead letter, got %d", len(letters))
+	}
+	if l := letters[0]; l.Attempts != 2 || l.Target != "echo broken >&2; exit 3" || l.Event.Episode.Filename != "1245.mp3" {
+		t.Errorf("Unexpected dead letter %+v", l)
+	}
+}
+
+func TestDryRunAndDisabled(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer srv.Close()
+
+	d := NewDispatcher(Options{Webhooks: []string{srv.URL}, DryRun: true})
+	if failed := d.NewEpisodes(context.Background(), []collector.Episode{testEpisode}); failed != 0 || calls.Load() != 0 {
+		t.Errorf("Expected a dry run to send nothing, failed=%d calls=%d", failed, calls.Load())
+	}
+
+	var nilDispatcher *Dispatcher
+	if nilDispatcher.Enabled() || NewDispatcher(Options{}).Enabled() {
+		t.Error("Expected dispatchers without targets to be disabled")
+	}
+	if failed := nilDispatcher.NewEpisodes(context.Background(), []collector.Episode{testEpisode}); failed != 0 {
+		t.Errorf("Expected a nil dispatcher to do nothing, got %d", failed)
+	}
+}
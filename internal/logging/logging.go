@@ -0,0 +1,47 @@
+// Package logging configures the leveled structured logger shared by the scraper packages.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+)
+
+// Output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// New returns a logger writing records of at least the given level to w,
+// as logfmt style text or JSON lines
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q (use debug, info, warn or error)", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case FormatText, "":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q (use %s or %s)", format, FormatText, FormatJSON)
+	}
+}
+
+// Setup installs the logger as the default one. Messages still written with
+// the log package are logged at info level through the same handler.
+func Setup(w io.Writer, level, format string) error {
+	logger, err := New(w, level, format)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	log.SetFlags(0)
+	return nil
+}
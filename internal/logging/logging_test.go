@@ -0,0 +1,38 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "warn", FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger.Info("Hidden")
+	logger.Warn("Download failed", "episode", "1245 - La batalla de l'Ebre")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected only the warning, got:\n%s", buf.String())
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("Invalid JSON log line: %v", err)
+	}
+	if record["level"] != "WARN" || record["episode"] != "1245 - La batalla de l'Ebre" {
+		t.Errorf("Unexpected record: %v", record)
+	}
+
+	if _, err := New(&buf, "verbose", FormatText); err == nil {
+		t.Error("Expected an invalid level to fail")
+	}
+	if _, err := New(&buf, "info", "xml"); err == nil {
+		t.Error("Expected an invalid format to fail")
+	}
+}
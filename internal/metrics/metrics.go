@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Failure classes
+const (
+	ClassNetwork    = "network"     // Connection errors and timeouts
+	ClassHTTPStatus = "http_status" // Unexpected HTTP status
+	ClassAPI        = "api"         // The API reported an error or returned no audio
+	ClassParse      = "parse"       // Malformed API response
+	ClassInvalid    = "invalid"     // Downloaded content rejected, e.g. too small
+	ClassFilesystem = "filesystem"  // Local file errors
+	ClassOther      = "other"
+)
+
+// Episode availability values of the episodes gauge
+const (
+	AvailabilityDownloaded = "downloaded" // Audio stored locally
+	AvailabilityRemote     = "remote"     // Audio only available from 3Cat
+	AvailabilityFallback   = "fallback"   // Audio URL unknown, waiting for repair
+	AvailabilityLost       = "lost"       // Removed from 3Cat before being downloaded
+)
+
+// Bucket upper bounds
+var (
+	latencyBuckets    = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	throughputBuckets = []float64{64e3, 256e3, 1e6, 4e6, 16e6, 64e6}
+)
+
+// Metrics holds the scraper instruments. All methods do nothing on nil
+// metrics, so the packages can record them unconditionally.
+type Metrics struct {
+	Registry *Registry
+
+	pages         *Counter
+	apiLatency    *Histogram
+	downloadBytes *Counter
+	downloads     *Counter
+	throughput    *Histogram
+	retries       *Counter
+	failures      *Counter
+	episodes      *Gauge
+}
+
+// New registers the scraper instruments in a new registry
+func New() *Metrics {
+	r := NewRegistry()
+	return &Metrics{
+		Registry:      r,
+		pages:         r.Counter("enguardia_api_pages_fetched_total", "Listing pages fetched from the 3Cat API."),
+		apiLatency:    r.Histogram("enguardia_api_request_duration_seconds", "Latency of 3Cat API requests.", latencyBuckets, "endpoint"),
+		downloadBytes: r.Counter("enguardia_download_bytes_total", "Bytes of media downloaded.", "media"),
+		downloads:     r.Counter("enguardia_downloads_total", "Media files downloaded.", "media"),
+		throughput:    r.Histogram("enguardia_download_throughput_bytes_per_second", "Throughput of media downloads.", throughputBuckets, "media"),
+		retries:       r.Counter("enguardia_retries_total", "Operations attempted again after an earlier failure.", "operation"),
+		failures:      r.Counter("enguardia_failures_total", "Failed operations by class.", "operation", "class"),
+		episodes:      r.Gauge("enguardia_episodes", "Stored episodes by audio availability.", "program", "availability"),
+	}
+}
+
+// PageFetched counts a listing page request
+func (m *Metrics) PageFetched() {
+	if m == nil {
+		return
+	}
+	m.pages.Inc()
+}
+
+// APIRequest records the latency of an API request to an endpoint (list or item)
+func (m *Metrics) APIRequest(endpoint string, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.apiLatency.Observe(elapsed.Seconds(), endpoint)
+}
+
+// Downloaded records a completed media download (audio or image)
+func (m *Metrics) Downloaded(media string, bytes int64, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.downloads.Inc(media)
+	m.downloadBytes.Add(float64(bytes), media)
+	if elapsed > 0 {
+		m.throughput.Observe(float64(bytes)/elapsed.Seconds(), media)
+	}
+}
+
+// Retry counts an operation attempted again
+func (m *Metrics) Retry(operation string) {
+	if m == nil {
+		return
+	}
+	m.retries.Inc(operation)
+}
+
+// Fail counts a failed operation by the class of its error, nil errors are ignored
+func (m *Metrics) Fail(operation string, err error) {
+	if m == nil || err == nil {
+		return
+	}
+	m.failures.Inc(operation, Classify(err))
+}
+
+// SetEpisodes sets the number of episodes of a programme by availability
+func (m *Metrics) SetEpisodes(program string, byAvailability map[string]int) {
+	if m == nil {
+		return
+	}
+	for _, availability := range []string{AvailabilityDownloaded, AvailabilityRemote, AvailabilityFallback, AvailabilityLost} {
+		m.episodes.Set(float64(byAvailability[availability]), program, availability)
+	}
+}
+
+// Handler serves the metrics in the text exposition format
+func (m *Metrics) Handler() http.Handler {
+	return m.Registry.Handler()
+}
+
+// classError tags an error with its failure class
+type classError struct {
+	class string
+	err   error
+}
+
+func (e *classError) Error() string { return e.err.Error() }
+func (e *classError) Unwrap() error { return e.err }
+
+// WithClass tags an error with a failure class, keeping its message
+func WithClass(class string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classError{class: class, err: err}
+}
+
+// Classify returns the failure class of an error
+func Classify(err error) string {
+	var tagged *classError
+	var netErr net.Error
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &tagged):
+		return tagged.class
+	// Before net.Error, which the errno inside path errors also satisfies
+	case errors.As(err, &pathErr), errors.As(err, &linkErr):
+		return ClassFilesystem
+	case errors.As(err, &netErr):
+		return ClassNetwork
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return ClassParse
+	}
+	return ClassOther
+}
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	pages := r.Counter("test_pages_total", "Pages fetched.")
+	failures := r.Counter("test_failures_total", "Failures.", "class")
+	latency := r.Histogram("test_latency_seconds", "Latency.", []float64{1, 0.1}, "endpoint")
+	episodes := r.Gauge("test_episodes", "Episodes.", "availability")
+
+	pages.Inc()
+	pages.Add(2)
+	failures.Inc(`say "hi"`)
+	latency.Observe(0.05, "list")
+	latency.Observe(0.5, "list")
+	latency.Observe(3, "list")
+	r.OnCollect(func() { episodes.Set(7, "remote") })
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP test_pages_total Pages fetched.
+# TYPE test_pages_total counter
+test_pages_total 3
+# HELP test_failures_total Failures.
+# TYPE test_failures_total counter
+test_failures_total{class="say \"hi\""} 1
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{endpoint="list",le="0.1"} 1
+test_latency_seconds_bucket{endpoint="list",le="1"} 2
+test_latency_seconds_bucket{endpoint="list",le="+Inf"} 3
+test_latency_seconds_sum{endpoint="list"} 3.55
+test_latency_seconds_count{endpoint="list"} 3
+# HELP test_episodes Episodes.
+# TYPE test_episodes gauge
+test_episodes{availability="remote"} 7
+`
+	if buf.String() != want {
+		t.Errorf("Unexpected exposition:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	m := New()
+	m.PageFetched()
+	m.APIRequest("item", 200*time.Millisecond)
+	m.Downloaded("audio", 2e6, time.Second)
+	m.Retry("audio_resolve")
+	m.Fail("audio", WithClass(ClassHTTPStatus, errors.New("bad status: 404 Not Found")))
+	m.Fail("audio", nil)
+	m.SetEpisodes("en-guardia", map[string]int{AvailabilityDownloaded: 3})
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if got := rec.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"enguardia_api_pages_fetched_total 1",
+		`enguardia_api_request_duration_seconds_count{endpoint="item"} 1`,
+		`enguardia_download_bytes_total{media="audio"} 2e+06`,
+		`enguardia_download_throughput_bytes_per_second_bucket{media="audio",le="4e+06"} 1`,
+		`enguardia_retries_total{operation="audio_resolve"} 1`,
+		`enguardia_failures_total{operation="audio",class="http_status"} 1`,
+		`enguardia_episodes{program="en-guardia",availability="downloaded"} 3`,
+		`enguardia_episodes{program="en-guardia",availability="fallback"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in:\n%s", want, body)
+		}
+	}
+
+	// Nil metrics record nothing
+	var none *Metrics
+	none.PageFetched()
+	none.Fail("audio", errors.New("ignored"))
+}
+
+func TestClassify(t *testing.T) {
+	_, statErr := os.Stat("/nonexistent/file")
+
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("failed: %w", WithClass(ClassAPI, errors.New("API returned status: KO"))), ClassAPI},
+		{fmt.Errorf("failed to create temp file: %w", statErr), ClassFilesystem},
+		{errors.New("something else"), ClassOther},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.err); got != tt.want {
+			t.Errorf("Classify(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Package program describes the 3Cat radio programmes that can be archived.
+package program
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+)
+
+// Tag categories understood by the tagger and the webapp
+var TagCategories = []string{"periods", "topics", "locations", "civilizations", "events"}
+
+// TagRules maps a tag category to its tags and the keywords that trigger each tag
+type TagRules map[string]map[string][]string
+
+// Program describes a 3Cat radio programme and how its archive is presented
+type Program struct {
+	ID          string   `json:"id"`                   // programaradio_id in the 3Cat API
+	Slug        string   `json:"slug"`                 // Short name used for directories and the -program flag
+	Name        string   `json:"name"`                 // Name used in logs
+	URLPattern  string   `json:"url_pattern"`          // Path of episode pages on the 3Cat site
+	AudioType   string   `json:"audio_type,omitempty"` // tipus_audio in the 3Cat API
+	DataDir     string   `json:"data_dir,omitempty"`   // Directory holding the episode files
+	TagsFile    string   `json:"tags_file,omitempty"`  // Path of the generated tags file
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Language    string   `json:"language,omitempty"`
+	Taxonomy    TagRules `json:"taxonomy,omitempty"` // Tagging rules (empty = built-in history taxonomy)
+}
+
+// Registry holds the programmes that can be archived
+type Registry struct {
+	Default  string    `json:"default"`
+	Programs []Program `json:"programs"`
+}
+
+// EnGuardia returns the built-in definition of the En Guàrdia programme
+func EnGuardia() Program {
+	return Program{
+		ID:          constants.ProgramRadioID,
+		Slug:        constants.DefaultProgramSlug,
+		Name:        "En Guàrdia",
+		URLPattern:  constants.EpisodeURLPattern,
+		AudioType:   constants.AudioType,
+		DataDir:     constants.DefaultDataDir,
+		TagsFile:    constants.DefaultTagsFile,
+		Title:       "En Guàrdia - Història de Catalunya",
+		Description: "Programa d'història de Catalunya Ràdio amb tots els episodis disponibles",
+		Language:    "ca",
+	}
+}
+
+// DefaultRegistry returns a registry containing only the built-in programme
+func DefaultRegistry() *Registry {
+	return &Registry{
+		Default:  constants.DefaultProgramSlug,
+		Programs: []Program{EnGuardia()},
+	}
+}
+
+// LoadRegistry reads a registry file. A missing file yields the default registry.
+func LoadRegistry(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return DefaultRegistry(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read programs file: %w", err)
+	}
+
+	var registry Registry
+	if err := json.Unmarshal(data, &registry); err != nil {
+		return nil, fmt.Errorf("failed to parse programs file: %w", err)
+	}
+
+	if err := registry.normalize(); err != nil {
+		return nil, err
+	}
+
+	return &registry, nil
+}
+
+// normalize validates the registry and fills in per-programme defaults
+func (r *Registry) normalize() error {
+	if len(r.Programs) == 0 {
+		return fmt.Errorf("programs file defines no programmes")
+	}
+
+	seen := make(map[string]bool)
+	for i := range r.Programs {
+		p := &r.Programs[i]
+		if p.ID == "" || p.Slug == "" || p.URLPattern == "" {
+			return fmt.Errorf("programme %d needs an id, slug and url_pattern", i+1)
+		}
+		if seen[p.Slug] {
+			return fmt.Errorf("duplicate programme slug: %s", p.Slug)
+		}
+		seen[p.Slug] = true
+
+		for category := range p.Taxonomy {
+			if !isTagCategory(category) {
+				return fmt.Errorf("programme %s: unknown tag category %q (use %s)",
+					p.Slug, category, strings.Join(TagCategories, ", "))
+			}
+		}
+
+		if p.Name == "" {
+			p.Name = p.Slug
+		}
+		if p.Title == "" {
+			p.Title = p.Name
+		}
+		if p.AudioType == "" {
+			p.AudioType = constants.AudioType
+		}
+		if p.Language == "" {
+			p.Language = "ca"
+		}
+		if p.DataDir == "" {
+			p.DataDir = filepath.Join(constants.ProgramsDataDir, p.Slug)
+		}
+		if p.TagsFile == "" {
+			p.TagsFile = "tags-" + p.Slug + constants.JSONExtension
+		}
+	}
+
+	if r.Default == "" {
+		r.Default = r.Programs[0].Slug
+	}
+	if !seen[r.Default] {
+		return fmt.Errorf("default programme %q is not defined", r.Default)
+	}
+
+	return nil
+}
+
+// Get returns the programme with the given slug, or the default one for an empty slug
+func (r *Registry) Get(slug string) (Program, error) {
+	if slug == "" {
+		slug = r.Default
+	}
+
+	for _, p := range r.Programs {
+		if p.Slug == slug {
+			return p, nil
+		}
+	}
+
+	return Program{}, fmt.Errorf("unknown programme %q (available: %s)", slug, strings.Join(r.Slugs(), ", "))
+}
+
+// Slugs returns the sorted slugs of all registered programmes
+func (r *Registry) Slugs() []string {
+	var slugs []string
+	for _, p := range r.Programs {
+		slugs = append(slugs, p.Slug)
+	}
+	sort.Strings(slugs)
+	return slugs
+}
+
+func isTagCategory(category string) bool {
+	for _, c := range TagCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
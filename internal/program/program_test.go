@@ -0,0 +1,85 @@
+package program
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeRegistry(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "programs.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write registry: %v", err)
+	}
+	return path
+}
+
+func TestLoadRegistryMissingFile(t *testing.T) {
+	registry, err := LoadRegistry(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatalf("Expected default registry, got error: %v", err)
+	}
+
+	p, err := registry.Get("")
+	if err != nil {
+		t.Fatalf("Failed to get default programme: %v", err)
+	}
+	if p.ID != "944" || p.DataDir != "capitols" || p.TagsFile != "tags.json" {
+		t.Errorf("Unexpected default programme: %+v", p)
+	}
+}
+
+func TestLoadRegistryDefaults(t *testing.T) {
+	path := writeRegistry(t, `{
+		"programs": [
+			{"id": "944", "slug": "en-guardia", "url_pattern": "/3cat/en-guardia/audio", "data_dir": "capitols"},
+			{"id": "123", "slug": "ciencia", "name": "Ciència", "url_pattern": "/3cat/ciencia/audio",
+			 "taxonomy": {"topics": {"fisica": ["física", "àtom"]}}}
+		]
+	}`)
+
+	registry, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatalf("Failed to load registry: %v", err)
+	}
+	if registry.Default != "en-guardia" {
+		t.Errorf("Expected first programme as default, got %s", registry.Default)
+	}
+
+	p, err := registry.Get("ciencia")
+	if err != nil {
+		t.Fatalf("Failed to get programme: %v", err)
+	}
+	if p.DataDir != filepath.Join("programes", "ciencia") || p.TagsFile != "tags-ciencia.json" {
+		t.Errorf("Unexpected per-programme paths: %s, %s", p.DataDir, p.TagsFile)
+	}
+	if p.Title != "Ciència" || p.AudioType != "CRTAPROG" || p.Language != "ca" {
+		t.Errorf("Unexpected display defaults: %+v", p)
+	}
+
+	if _, err := registry.Get("unknown"); err == nil {
+		t.Error("Expected an error for an unknown programme")
+	}
+}
+
+func TestLoadRegistryInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"No programmes", `{"programs": []}`},
+		{"Missing slug", `{"programs": [{"id": "1", "url_pattern": "/a"}]}`},
+		{"Duplicate slug", `{"programs": [{"id": "1", "slug": "a", "url_pattern": "/a"}, {"id": "2", "slug": "a", "url_pattern": "/b"}]}`},
+		{"Unknown category", `{"programs": [{"id": "1", "slug": "a", "url_pattern": "/a", "taxonomy": {"colors": {}}}]}`},
+		{"Unknown default", `{"default": "b", "programs": [{"id": "1", "slug": "a", "url_pattern": "/a"}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadRegistry(writeRegistry(t, tt.content)); err == nil {
+				t.Errorf("Test %s failed: expected an error", tt.name)
+			}
+		})
+	}
+}
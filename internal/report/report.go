@@ -0,0 +1,174 @@
+// Package report collects the outcome of a scraper run into a JSON report
+// that monitoring scripts can inspect.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/atomicfile"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+)
+
+// Counter names used across the scraper packages
+const (
+	PagesFetched     = "pages_fetched"
+	EpisodesFound    = "episodes_found"
+	MetadataSaved    = "metadata_saved"
+	MetadataExisting = "metadata_existing"
+	MetadataUpdated  = "metadata_updated"
+	AudioDownloaded  = "audio_downloaded"
+	AudioExisting    = "audio_existing"
+	ImagesDownloaded = "images_downloaded"
+	ImagesExisting   = "images_existing"
+	FallbackAudio    = "fallback_audio"
+	Repaired         = "repaired"
+	Failed           = "failed"
+)
+
+// Report describes a scraper run. All methods are safe for concurrent use
+// and do nothing on a nil report.
+type Report struct {
+	Command         string             `json:"command"`
+	Program         string             `json:"program"`
+	DryRun          bool               `json:"dry_run,omitempty"`
+	StartedAt       time.Time          `json:"started_at"`
+	FinishedAt      time.Time          `json:"finished_at"`
+	DurationSeconds float64            `json:"duration_seconds"`
+	ExitCode        int                `json:"exit_code"`
+	Counts          map[string]int     `json:"counts"`
+	PhaseSeconds    map[string]float64 `json:"phase_seconds,omitempty"`
+	BytesDownloaded int64              `json:"bytes_downloaded"`
+	NewEpisodes     []string           `json:"new_episodes"`
+	Errors          []EpisodeError     `json:"errors"`
+
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+// EpisodeError is a failure affecting a single episode
+type EpisodeError struct {
+	Episode string `json:"episode"`
+	Stage   string `json:"stage"` // metadata, audio, image, resolve...
+	Error   string `json:"error"`
+}
+
+// New starts the report of a command run
+func New(command, program string, now func() time.Time) *Report {
+	if now == nil {
+		now = time.Now
+	}
+	return &Report{
+		Command:      command,
+		Program:      program,
+		StartedAt:    now().UTC(),
+		Counts:       make(map[string]int),
+		PhaseSeconds: make(map[string]float64),
+		NewEpisodes:  []string{},
+		Errors:       []EpisodeError{},
+		now:          now,
+	}
+}
+
+// Add increments a counter
+func (r *Report) Add(counter string, n int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Counts[counter] += n
+}
+
+// Downloaded records a completed media download
+func (r *Report) Downloaded(counter string, bytes int64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Counts[counter]++
+	r.BytesDownloaded += bytes
+}
+
+// NewEpisode records an episode that was not in the archive yet
+func (r *Report) NewEpisode(title string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.NewEpisodes = append(r.NewEpisodes, title)
+	r.Counts[MetadataSaved]++
+}
+
+// Fail records an error affecting an episode
+func (r *Report) Fail(episode, stage string, err error) {
+	if r == nil || err == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Errors = append(r.Errors, EpisodeError{Episode: episode, Stage: stage, Error: err.Error()})
+	r.Counts[Failed]++
+}
+
+// Phase starts timing a phase of the run, call the returned function when it ends
+func (r *Report) Phase(name string) func() {
+	if r == nil {
+		return func() {}
+	}
+	start := r.now()
+	return func() {
+		elapsed := r.now().Sub(start).Seconds()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.PhaseSeconds[name] += elapsed
+	}
+}
+
+// Finish records the end of the run and its exit code
+func (r *Report) Finish(exitCode int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.FinishedAt = r.now().UTC()
+	r.DurationSeconds = r.FinishedAt.Sub(r.StartedAt).Seconds()
+	r.ExitCode = exitCode
+	sort.SliceStable(r.Errors, func(i, j int) bool {
+		return r.Errors[i].Episode < r.Errors[j].Episode
+	})
+}
+
+// FileName returns the default report file name, unique per run
+func (r *Report) FileName() string {
+	return fmt.Sprintf("%s-%s-%s%s", r.StartedAt.Format("20060102T150405Z"), r.Program, r.Command, constants.JSONExtension)
+}
+
+// Write saves the report as indented JSON, creating the parent directory
+func (r *Report) Write(path string) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r, "", constants.JSONIndent)
+	r.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal run report: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), constants.DirPermissions); err != nil {
+		return fmt.Errorf("failed to create report directory: %w", err)
+	}
+	if err := atomicfile.WriteFile(path, append(data, '\n'), constants.FilePermissions); err != nil {
+		return fmt.Errorf("failed to write run report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/p4u/enguardia-arxiu/internal/atomicfile"
+	"github.com/p4u/enguardia-arxiu/internal/backend"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+)
+
+// Orphan reasons
+const (
+	OrphanTemp       = "temporary"  // Leftover of an interrupted write
+	OrphanAudio      = "audio"      // Audio no episode refers to
+	OrphanImage      = "image"      // Image no episode refers to
+	OrphanSuperseded = "superseded" // Image replaced by one with a different extension
+	OrphanObject     = "object"     // Stored object no episode media links to
+)
+
+// Media extensions considered by the orphan scan, other files are left alone
+var (
+	audioExtensions = []string{constants.MP3Extension, constants.M4AExtension, constants.AACExtension, constants.MP4Extension}
+	imageExtensions = []string{constants.JPGExtension, ".jpeg", constants.PNGExtension, constants.WebPExtension}
+)
+
+// Orphan is a file of the data directory that no episode metadata refers to
+type Orphan struct {
+	File   string `json:"file"` // File name relative to the data directory
+	Size   int64  `json:"size"`
+	Reason string `json:"reason"`
+	Remote bool   `json:"remote,omitempty"` // Stored in a remote media backend
+}
+
+// Orphans cross-references the episode metadata with the files of the data
+// directory and returns the leftover temporary files and the media no episode
+// refers to, sorted by name. Hidden files and subdirectories are never listed,
+// except the objects of the content-addressed layout.
+// Media sharing its name with metadata that can't be parsed is kept, as it
+// can't be told whether it is still in use.
+func (s *Storage) Orphans() ([]Orphan, error) {
+	entries, err := os.ReadDir(s.dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data directory: %w", err)
+	}
+
+	referenced := make(map[string]bool)
+	images := make(map[string]bool)     // Stems of the referenced images
+	unreadable := make(map[string]bool) // Stems of the metadata that failed to load
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != constants.JSONExtension {
+			continue
+		}
+		episode, err := s.loadEpisode(filepath.Join(s.dataDir, name))
+		if err != nil {
+			slog.Warn("Keeping the media of unreadable metadata", "file", name, "error", err)
+			unreadable[stem(name)] = true
+			continue
+		}
+		referenced[episode.Filename] = true
+		if episode.ImageFilename != "" {
+			referenced[episode.ImageFilename] = true
+			images[stem(episode.ImageFilename)] = true
+		}
+	}
+
+	// Media in a remote backend is checked along with the local leftovers
+	type candidate struct {
+		name   string
+		size   int64
+		remote bool
+	}
+	var candidates []candidate
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // Removed meanwhile
+		}
+		candidates = append(candidates, candidate{name: entry.Name(), size: info.Size()})
+	}
+	if !backend.IsLocal(s.backend) {
+		media, err := s.backend.List(context.Background(), "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list media: %w", err)
+		}
+		for _, info := range media {
+			candidates = append(candidates, candidate{name: info.Name, size: info.Size, remote: true})
+		}
+	}
+
+	var orphans []Orphan
+	for _, c := range candidates {
+		name := c.name
+		if referenced[name] {
+			continue
+		}
+
+		var reason string
+		ext := strings.ToLower(filepath.Ext(name))
+		switch {
+		case ext == constants.TempSuffix:
+			reason = OrphanTemp
+		case strings.HasPrefix(name, "."), unreadable[stem(name)]:
+			continue
+		case contains(audioExtensions, ext):
+			reason = OrphanAudio
+		case contains(imageExtensions, ext) && images[stem(name)]:
+			reason = OrphanSuperseded
+		case contains(imageExtensions, ext):
+			reason = OrphanImage
+		default:
+			continue
+		}
+		orphans = append(orphans, Orphan{File: name, Size: c.size, Reason: reason, Remote: c.remote})
+	}
+
+	objects, err := s.objectOrphans(referenced, unreadable)
+	if err != nil {
+		return nil, err
+	}
+	orphans = append(orphans, objects...)
+
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].File < orphans[j].File
+	})
+	return orphans, nil
+}
+
+// Quarantine moves the orphans to a new timestamped subdirectory of dir (empty
+// = the quarantine directory inside the data directory), returning it. They
+// can be restored by moving them back. Remote media is downloaded to dir and
+// then deleted from its backend.
+func (s *Storage) Quarantine(orphans []Orphan, dir string) (string, error) {
+	if dir == "" {
+		dir = filepath.Join(s.dataDir, constants.QuarantineDir)
+	}
+	dir = filepath.Join(dir, s.now().UTC().Format("20060102T150405Z"))
+
+	if s.dryRun {
+		for _, orphan := range orphans {
+			slog.Info("Dry run: would move to quarantine", "file", orphan.File, "dir", dir)
+		}
+		return dir, nil
+	}
+
+	if err := os.MkdirAll(dir, constants.DirPermissions); err != nil {
+		return "", fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	for _, orphan := range orphans {
+		target := filepath.Join(dir, orphan.File)
+		if err := os.MkdirAll(filepath.Dir(target), constants.DirPermissions); err != nil {
+			return dir, fmt.Errorf("failed to create quarantine directory: %w", err)
+		}
+		if orphan.Remote {
+			if err := s.fetchRemote(orphan.File, target); err != nil {
+				return dir, fmt.Errorf("failed to move %s to quarantine: %w", orphan.File, err)
+			}
+		} else if err := os.Rename(filepath.Join(s.dataDir, orphan.File), target); err != nil {
+			return dir, fmt.Errorf("failed to move %s to quarantine: %w", orphan.File, err)
+		}
+		slog.Debug("Moved to quarantine", "file", orphan.File, "dir", dir)
+	}
+	return dir, nil
+}
+
+// RemoveOrphans deletes the orphans from the data directory
+func (s *Storage) RemoveOrphans(orphans []Orphan) error {
+	for _, orphan := range orphans {
+		path := filepath.Join(s.dataDir, orphan.File)
+		if orphan.Remote {
+			path = s.mediaLocation(orphan.File)
+		}
+		if s.dryRun {
+			slog.Info("Dry run: would delete", "file", path)
+			continue
+		}
+		if orphan.Remote {
+			if err := s.backend.Delete(context.Background(), orphan.File); err != nil {
+				return fmt.Errorf("failed to delete %s: %w", orphan.File, err)
+			}
+		} else if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete %s: %w", orphan.File, err)
+		}
+		slog.Debug("Deleted", "file", path)
+	}
+	return nil
+}
+
+// fetchRemote downloads a file from the media backend to path and deletes it
+// from the backend
+func (s *Storage) fetchRemote(name, path string) error {
+	ctx := context.Background()
+	r, err := s.backend.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	err = atomicfile.Write(path, constants.FilePermissions, func(w io.Writer) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return s.backend.Delete(ctx, name)
+}
+
+// objectOrphans returns the stored objects that no referenced media file maps
+// to in the manifest
+func (s *Storage) objectOrphans(referenced, unreadable map[string]bool) ([]Orphan, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dataDir, constants.ObjectsDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read objects directory: %w", err)
+	}
+	manifest, err := s.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool)
+	for name, sum := range manifest.Files {
+		if referenced[name] || unreadable[stem(name)] {
+			used[sum] = true
+		}
+	}
+
+	var orphans []Orphan
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || used[name] || strings.HasPrefix(name, ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // Removed meanwhile
+		}
+		orphans = append(orphans, Orphan{File: filepath.Join(constants.ObjectsDir, name), Size: info.Size(), Reason: OrphanObject})
+	}
+	return orphans, nil
+}
+
+// stem returns a file name without its extension
+func stem(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
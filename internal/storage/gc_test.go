@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+	"github.com/p4u/enguardia-arxiu/internal/fake3cat"
+)
+
+func TestOrphans(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+
+	st := newFakeStorage(t, srv, false)
+	write := func(name string, size int) {
+		if err := os.WriteFile(filepath.Join(st.dataDir, name), make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("1245-la-batalla-de-l-ebre.mp3"+constants.TempSuffix, 10)
+	write("1200-episodi-esborrat.mp3", 2048)
+	write("1200-episodi-esborrat.jpg", 100)
+	write("1245-la-batalla-de-l-ebre.png", 100) // Superseded by the .jpg
+	write("1199-metadades-trencades.json", 3)
+	write("1199-metadades-trencades.mp3", 100) // Kept, its metadata can't be read
+	write("notes.txt", 10)
+	if err := os.Mkdir(filepath.Join(st.dataDir, "subdir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write("subdir/1198-amagat.mp3", 100)
+
+	orphans, err := st.Orphans()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Orphan{
+		{File: "1200-episodi-esborrat.jpg", Size: 100, Reason: OrphanImage},
+		{File: "1200-episodi-esborrat.mp3", Size: 2048, Reason: OrphanAudio},
+		{File: "1245-la-batalla-de-l-ebre.mp3.tmp", Size: 10, Reason: OrphanTemp},
+		{File: "1245-la-batalla-de-l-ebre.png", Size: 100, Reason: OrphanSuperseded},
+	}
+	if len(orphans) != len(want) {
+		t.Fatalf("Orphans = %+v, want %+v", orphans, want)
+	}
+	for i := range want {
+		if orphans[i] != want[i] {
+			t.Errorf("Orphan %d = %+v, want %+v", i, orphans[i], want[i])
+		}
+	}
+
+	dir, err := st.Quarantine(orphans, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(dir) != filepath.Join(st.dataDir, constants.QuarantineDir) {
+		t.Errorf("Unexpected quarantine directory %s", dir)
+	}
+	for _, orphan := range want {
+		if _, err := os.Stat(filepath.Join(dir, orphan.File)); err != nil {
+			t.Errorf("Expected %s to be quarantined: %v", orphan.File, err)
+		}
+	}
+	for _, name := range []string{"1245-la-batalla-de-l-ebre.jpg", "1245-la-batalla-de-l-ebre.mp3", "1199-metadades-trencades.mp3", "notes.txt"} {
+		if _, err := os.Stat(filepath.Join(st.dataDir, name)); err != nil {
+			t.Errorf("Expected %s to be kept: %v", name, err)
+		}
+	}
+	if orphans, err := st.Orphans(); err != nil || len(orphans) != 0 {
+		t.Errorf("Expected nothing left to clean up, got %+v (%v)", orphans, err)
+	}
+}
+
+func TestRemoveOrphans(t *testing.T) {
+	dataDir := t.TempDir()
+	path := filepath.Join(dataDir, "1200-episodi-esborrat.mp3")
+	if err := os.WriteFile(path, []byte("audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	orphans := []Orphan{{File: "1200-episodi-esborrat.mp3", Reason: OrphanAudio}}
+
+	if err := NewStorageWithOptions(dataDir, Options{DryRun: true}).RemoveOrphans(orphans); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected a dry run to keep the file: %v", err)
+	}
+	if err := NewStorage(dataDir).RemoveOrphans(orphans); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the orphan to be deleted: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+)
+
+// ErrLocked is returned when another process holds the data directory lock
+var ErrLocked = errors.New("data directory is locked by another process")
+
+// Lock is an exclusive lock on the data directory, held by creating a lock
+// file that records the owner process
+type Lock struct {
+	PID     int    `json:"pid"`
+	Host    string `json:"host"`
+	Command string `json:"command"`
+	Created string `json:"created"`
+
+	path string
+}
+
+// Lock takes the data directory lock for the given command. A lock left by
+// a process that no longer runs on this host is taken over. Dry runs don't
+// lock anything.
+func (s *Storage) Lock(command string) (*Lock, error) {
+	host, _ := os.Hostname()
+	lock := &Lock{
+		PID:     os.Getpid(),
+		Host:    host,
+		Command: command,
+		Created: s.now().UTC().Format(time.RFC3339),
+	}
+	if s.dryRun {
+		return lock, nil
+	}
+	lock.path = filepath.Join(s.dataDir, constants.LockFile)
+
+	data, err := json.Marshal(lock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal lock: %w", err)
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(lock.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, constants.FilePermissions)
+		if err == nil {
+			_, writeErr := file.Write(data)
+			if closeErr := file.Close(); writeErr == nil {
+				writeErr = closeErr
+			}
+			if writeErr != nil {
+				_ = os.Remove(lock.path)
+				return nil, fmt.Errorf("failed to write lock file: %w", writeErr)
+			}
+			return lock, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create lock file: %w", err)
+		}
+
+		holder, err := readLock(lock.path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // Released meanwhile
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !holder.stale(host) {
+			return nil, fmt.Errorf("%w: %s (pid %d on %s) since %s", ErrLocked, holder.Command, holder.PID, holder.Host, holder.Created)
+		}
+
+		slog.Warn("Removing stale lock", "file", lock.path, "pid", holder.PID, "command", holder.Command)
+		if err := os.Remove(lock.path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove stale lock: %w", err)
+		}
+	}
+
+	return nil, fmt.Errorf("%w: lock file %s keeps reappearing", ErrLocked, lock.path)
+}
+
+// Unlock releases the lock
+func (l *Lock) Unlock() error {
+	if l == nil || l.path == "" {
+		return nil
+	}
+	if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove lock file: %w", err)
+	}
+	return nil
+}
+
+func readLock(path string) (*Lock, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+
+	var lock Lock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		// Being written right now, or left empty by a crash right after creating it
+		lock = Lock{Command: "unknown", Created: info.ModTime().UTC().Format(time.RFC3339)}
+	}
+	lock.path = path
+	return &lock, nil
+}
+
+// stale reports whether the lock was left by a process that no longer runs
+func (l *Lock) stale(host string) bool {
+	if l.PID == 0 {
+		created, err := time.Parse(time.RFC3339, l.Created)
+		return err == nil && time.Since(created) > constants.StaleLockAge
+	}
+	return l.Host == host && !processAlive(l.PID)
+}
+
+// processAlive reports whether a process with the given PID exists
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+)
+
+func TestLock(t *testing.T) {
+	dataDir := t.TempDir()
+	st := NewStorage(dataDir)
+
+	lock, err := st.Lock("scrape")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Lock("download"); !errors.Is(err, ErrLocked) {
+		t.Errorf("Expected a second lock to fail with ErrLocked, got %v", err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, constants.LockFile)); !os.IsNotExist(err) {
+		t.Errorf("Expected the lock file to be removed, got %v", err)
+	}
+
+	lock, err = st.Lock("download")
+	if err != nil {
+		t.Fatalf("Expected the released lock to be taken again: %v", err)
+	}
+	defer lock.Unlock()
+}
+
+func TestLockDryRun(t *testing.T) {
+	dataDir := t.TempDir()
+	lock, err := NewStorageWithOptions(dataDir, Options{DryRun: true}).Lock("scrape")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, constants.LockFile)); !os.IsNotExist(err) {
+		t.Errorf("Expected a dry run not to lock, got %v", err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStaleLock(t *testing.T) {
+	host, _ := os.Hostname()
+
+	// A process that has exited
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	exited := cmd.ProcessState.Pid()
+
+	write := func(dataDir string, data []byte, modTime time.Time) {
+		path := filepath.Join(dataDir, constants.LockFile)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	holder := func(pid int, host string) []byte {
+		data, err := json.Marshal(Lock{PID: pid, Host: host, Command: "watch", Created: time.Now().UTC().Format(time.RFC3339)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	for _, tc := range []struct {
+		name      string
+		data      []byte
+		modTime   time.Time
+		takenOver bool
+	}{
+		{"exited process", holder(exited, host), time.Now(), true},
+		{"running process", holder(os.Getpid(), host), time.Now(), false},
+		{"other host", holder(exited, host+"-other"), time.Now(), false},
+		{"left empty", nil, time.Now().Add(-2 * constants.StaleLockAge), true},
+		{"being written", nil, time.Now(), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			write(dataDir, tc.data, tc.modTime)
+			lock, err := NewStorage(dataDir).Lock("scrape")
+			if tc.takenOver != (err == nil) {
+				t.Fatalf("Taken over = %v, want %v (%v)", err == nil, tc.takenOver, err)
+			}
+			if err != nil && !errors.Is(err, ErrLocked) {
+				t.Errorf("Expected ErrLocked, got %v", err)
+			}
+			lock.Unlock()
+		})
+	}
+}
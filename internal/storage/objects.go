@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/p4u/enguardia-arxiu/internal/atomicfile"
+	"github.com/p4u/enguardia-arxiu/internal/backend"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+)
+
+// Layouts of the media files in the data directory
+const (
+	LayoutFlat    = "flat"    // Media stored under the titled file names
+	LayoutObjects = "objects" // Media stored once as objects/<sha256>, titled names are hard links
+)
+
+// CheckLayout returns an error for unknown layouts, empty means flat
+func CheckLayout(layout string) error {
+	switch layout {
+	case "", LayoutFlat, LayoutObjects:
+		return nil
+	}
+	return fmt.Errorf("invalid storage layout %q (use %s or %s)", layout, LayoutFlat, LayoutObjects)
+}
+
+// Manifest maps the titled media files and the URLs they were downloaded
+// from to their objects. Looking media up by URL lets a retitled episode reuse
+// the object instead of downloading it again.
+type Manifest struct {
+	Files map[string]string `json:"files"` // Titled file name -> object hash
+	URLs  map[string]string `json:"urls"`  // Media URL -> object hash
+}
+
+// objectsLayout reports whether media is stored as objects, which needs the
+// media to be in the data directory
+func (s *Storage) objectsLayout() bool {
+	return s.layout == LayoutObjects && backend.IsLocal(s.backend)
+}
+
+// objectPath returns the path of an object
+func (s *Storage) objectPath(sum string) string {
+	return filepath.Join(s.dataDir, constants.ObjectsDir, sum)
+}
+
+// loadManifest reads the manifest once, callers must hold s.mu
+func (s *Storage) loadManifest() (*Manifest, error) {
+	if s.manifest != nil {
+		return s.manifest, nil
+	}
+
+	m := &Manifest{Files: make(map[string]string), URLs: make(map[string]string)}
+	data, err := os.ReadFile(filepath.Join(s.dataDir, constants.ManifestFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read object manifest: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, m); err != nil {
+			return nil, fmt.Errorf("failed to parse object manifest: %w", err)
+		}
+	}
+	s.manifest = m
+	return m, nil
+}
+
+// saveManifest writes the manifest, callers must hold s.mu
+func (s *Storage) saveManifest() error {
+	data, err := json.MarshalIndent(s.manifest, "", constants.JSONIndent)
+	if err != nil {
+		return fmt.Errorf("failed to marshal object manifest: %w", err)
+	}
+	if err := atomicfile.WriteFile(filepath.Join(s.dataDir, constants.ManifestFile), data, constants.FilePermissions); err != nil {
+		return fmt.Errorf("failed to write object manifest: %w", err)
+	}
+	return nil
+}
+
+// Manifest returns a copy of the object manifest, empty in the flat layout
+func (s *Storage) Manifest() (Manifest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.loadManifest()
+	if err != nil {
+		return Manifest{}, err
+	}
+	copied := Manifest{Files: make(map[string]string, len(m.Files)), URLs: make(map[string]string, len(m.URLs))}
+	for k, v := range m.Files {
+		copied.Files[k] = v
+	}
+	for k, v := range m.URLs {
+		copied.URLs[k] = v
+	}
+	return copied, nil
+}
+
+// linkObject resolves a titled media file through the manifest, by name or by
+// the URL it was downloaded from, and links it to the stored object. It
+// reports whether the file is now in place; in the flat layout it never is.
+func (s *Storage) linkObject(name, url string, minSize int64) (bool, error) {
+	if !s.objectsLayout() || s.overwrite {
+		return false, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.loadManifest()
+	if err != nil {
+		return false, err
+	}
+	sum := m.Files[name]
+	if sum == "" {
+		sum = m.URLs[url]
+	}
+	if sum == "" {
+		return false, nil
+	}
+	info, err := os.Stat(s.objectPath(sum))
+	if err != nil || info.Size() <= minSize {
+		return false, nil // Quarantined or incomplete, download it again
+	}
+
+	path := filepath.Join(s.dataDir, name)
+	if s.dryRun {
+		slog.Info("Dry run: would link stored object", "file", path, "object", sum)
+		return true, nil
+	}
+	if err := replaceWithLink(s.objectPath(sum), path); err != nil {
+		return false, err
+	}
+	slog.Info("Linked stored object", "file", path, "object", sum)
+
+	m.Files[name] = sum
+	m.URLs[url] = sum
+	return true, s.saveManifest()
+}
+
+// storeObject moves a complete titled media file into the object store, or
+// links it to an identical object already stored, and records it in the
+// manifest. sum is the SHA-256 of the file, empty to compute it. It does
+// nothing in the flat layout.
+func (s *Storage) storeObject(name, url, sum string) error {
+	if !s.objectsLayout() || s.dryRun {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := s.loadManifest()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dataDir, name)
+	if sum == "" {
+		if known, ok := m.Files[name]; ok && sameFile(path, s.objectPath(known)) {
+			return nil
+		}
+		if sum, err = fileSum(path); err != nil {
+			return err
+		}
+	}
+
+	object := s.objectPath(sum)
+	switch {
+	case sameFile(path, object):
+	case fileExists(object):
+		// Stored once: drop the duplicate in favour of the existing object
+		if err := replaceWithLink(object, path); err != nil {
+			return err
+		}
+		slog.Info("Linked duplicate to stored object", "file", path, "object", sum)
+	default:
+		if err := os.MkdirAll(filepath.Dir(object), constants.DirPermissions); err != nil {
+			return fmt.Errorf("failed to create objects directory: %w", err)
+		}
+		if err := os.Link(path, object); err != nil {
+			return fmt.Errorf("failed to store object: %w", err)
+		}
+	}
+
+	m.Files[name] = sum
+	if url != "" {
+		m.URLs[url] = sum
+	}
+	return s.saveManifest()
+}
+
+// replaceWithLink atomically replaces path with a hard link to target
+func replaceWithLink(target, path string) error {
+	temp := path + ".link" + constants.TempSuffix
+	_ = os.Remove(temp)
+	if err := os.Link(target, temp); err != nil {
+		return fmt.Errorf("failed to link object: %w", err)
+	}
+	if err := os.Rename(temp, path); err != nil {
+		_ = os.Remove(temp)
+		return fmt.Errorf("failed to link object: %w", err)
+	}
+	return nil
+}
+
+// fileSum returns the hex SHA-256 of a file
+func fileSum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/metrics"
+)
+
+// ProbeAudio reports whether 3Cat still serves the audio of an episode, with a
+// HEAD request or, for servers that refuse it, a one-byte ranged GET. Missing
+// audio (404 or 410) is not an error; other failures are, as they say nothing
+// about the audio.
+func (s *Storage) ProbeAudio(ctx context.Context, episode collector.Episode) (bool, error) {
+	if episode.AudioURL == "" || episode.HasFallbackAudio() {
+		return false, nil
+	}
+
+	status, err := s.probe(ctx, http.MethodHead, episode.AudioURL)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = s.probe(ctx, http.MethodGet, episode.AudioURL)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to probe audio: %w", err)
+	}
+
+	switch {
+	case status == http.StatusOK || status == http.StatusPartialContent:
+		return true, nil
+	case status == http.StatusNotFound || status == http.StatusGone:
+		return false, nil
+	default:
+		return false, metrics.WithClass(metrics.ClassHTTPStatus, fmt.Errorf("failed to probe audio: status %d", status))
+	}
+}
+
+func (s *Storage) probe(ctx context.Context, method, url string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("invalid request: %w", err)
+	}
+	if method == http.MethodGet {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+	resp, err := s.audioClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if err := resp.Body.Close(); err != nil {
+		slog.Warn("Failed to close response body", "error", err)
+	}
+	return resp.StatusCode, nil
+}
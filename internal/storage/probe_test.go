@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/p4u/enguardia-arxiu/internal/fake3cat"
+)
+
+func TestProbeAudio(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+
+	st := newFakeStorage(t, srv, true)
+	srv.FailMedia("mp3/1/0/1001.mp3", http.StatusNotFound)
+	srv.FailMedia("mp3/1/0/1003.mp3", http.StatusInternalServerError)
+
+	for _, tc := range []struct {
+		number    int
+		available bool
+		fails     bool
+	}{
+		{number: 1245, available: false},              // Removed from 3Cat
+		{number: 1244, available: true},               // Still served
+		{number: 1243, available: false, fails: true}, // Says nothing about the audio
+		{number: 1242, available: false},              // Fallback audio, never probed
+	} {
+		available, err := st.ProbeAudio(context.Background(), findEpisode(t, st, tc.number))
+		if available != tc.available || (err != nil) != tc.fails {
+			t.Errorf("Episode %d: available = %v, error = %v; want %v, failure %v", tc.number, available, err, tc.available, tc.fails)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/atomicfile"
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+)
+
+// Queue is the list of episodes a download run still has to process. It is
+// saved in the data directory after every episode so an interrupted run can
+// resume where it stopped.
+type Queue struct {
+	Created   string   `json:"created"`
+	Filters   string   `json:"filters,omitempty"`   // Description of the filters that built the queue
+	Images    bool     `json:"images"`              // Download images as well as audio
+	Overwrite bool     `json:"overwrite,omitempty"` // Download complete files again
+	Pending   []string `json:"pending"`             // Episode JSON files, in download order
+	Done      int      `json:"done"`
+	Failed    []string `json:"failed,omitempty"`
+
+	path   string
+	dryRun bool
+}
+
+// NewQueue creates a download queue for the given episodes, kept in the named
+// file of the data directory; callers must Save it
+func (s *Storage) NewQueue(name string, episodes []collector.Episode) *Queue {
+	q := &Queue{
+		Created: s.now().UTC().Format(time.RFC3339),
+		Images:  true,
+		Pending: make([]string, 0, len(episodes)),
+		path:    filepath.Join(s.dataDir, name),
+		dryRun:  s.dryRun,
+	}
+	for _, episode := range episodes {
+		q.Pending = append(q.Pending, episode.JSONFile)
+	}
+	return q
+}
+
+// LoadQueue returns the queue an interrupted run left in the named file of the
+// data directory, or nil if there is none
+func (s *Storage) LoadQueue(name string) (*Queue, error) {
+	path := filepath.Join(s.dataDir, name)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read download queue: %w", err)
+	}
+
+	var q Queue
+	if err := json.Unmarshal(data, &q); err != nil {
+		return nil, fmt.Errorf("failed to parse download queue %s: %w", path, err)
+	}
+	q.path = path
+	q.dryRun = s.dryRun
+	return &q, nil
+}
+
+// QueuedEpisode loads a queued episode from its JSON file
+func (s *Storage) QueuedEpisode(jsonFile string) (collector.Episode, error) {
+	return s.loadEpisode(filepath.Join(s.dataDir, jsonFile))
+}
+
+// Next returns the next pending episode file, or false when the queue is empty
+func (q *Queue) Next() (string, bool) {
+	if len(q.Pending) == 0 {
+		return "", false
+	}
+	return q.Pending[0], true
+}
+
+// Complete removes the first pending episode from the queue and saves it.
+// Once the queue is empty its file is removed.
+func (q *Queue) Complete(ok bool) error {
+	if len(q.Pending) == 0 {
+		return nil
+	}
+
+	if ok {
+		q.Done++
+	} else {
+		q.Failed = append(q.Failed, q.Pending[0])
+	}
+	q.Pending = q.Pending[1:]
+
+	if len(q.Pending) == 0 {
+		return q.Remove()
+	}
+	return q.Save()
+}
+
+// Remove deletes the queue file
+func (q *Queue) Remove() error {
+	if q.dryRun {
+		return nil
+	}
+	if err := os.Remove(q.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove download queue: %w", err)
+	}
+	return nil
+}
+
+// Save writes the queue atomically so an interruption never leaves a truncated file
+func (q *Queue) Save() error {
+	if q.dryRun {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(q, "", constants.JSONIndent)
+	if err != nil {
+		return fmt.Errorf("failed to marshal download queue: %w", err)
+	}
+
+	if err := atomicfile.WriteFile(q.path, data, constants.FilePermissions); err != nil {
+		return fmt.Errorf("failed to write download queue: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+)
+
+func TestQueue(t *testing.T) {
+	dataDir := t.TempDir()
+	st := NewStorageWithOptions(dataDir, Options{Now: fakeNow})
+
+	if queue, err := st.LoadQueue(constants.DownloadQueueFile); err != nil || queue != nil {
+		t.Fatalf("Expected no queue, got %+v (%v)", queue, err)
+	}
+
+	episodes := []collector.Episode{{JSONFile: "1245.json"}, {JSONFile: "1244.json"}, {JSONFile: "1243.json"}}
+	queue := st.NewQueue(constants.DownloadQueueFile, episodes)
+	queue.Filters = "from 1243"
+	if err := queue.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.Complete(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.Complete(false); err != nil {
+		t.Fatal(err)
+	}
+
+	// An interrupted run resumes with the pending episodes
+	resumed, err := st.LoadQueue(constants.DownloadQueueFile)
+	if err != nil || resumed == nil {
+		t.Fatalf("Expected the queue to be kept: %v", err)
+	}
+	if next, ok := resumed.Next(); !ok || next != "1243.json" {
+		t.Errorf("Next = %q, %v, want 1243.json", next, ok)
+	}
+	if resumed.Done != 1 || strings.Join(resumed.Failed, ",") != "1244.json" || resumed.Filters != "from 1243" || !resumed.Images {
+		t.Errorf("Unexpected resumed queue %+v", resumed)
+	}
+	if resumed.Created != "2025-09-08T10:00:00Z" {
+		t.Errorf("Created = %q", resumed.Created)
+	}
+
+	// Queues of different runs are kept apart
+	if queue, err := st.LoadQueue(constants.ScrapeQueueFile); err != nil || queue != nil {
+		t.Errorf("Expected no scrape queue, got %+v (%v)", queue, err)
+	}
+
+	// The file is removed once the queue is empty
+	if err := resumed.Complete(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := resumed.Next(); ok {
+		t.Error("Expected the queue to be empty")
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, constants.DownloadQueueFile)); !os.IsNotExist(err) {
+		t.Errorf("Expected the finished queue to be removed, got %v", err)
+	}
+}
+
+func TestQueueDryRun(t *testing.T) {
+	dataDir := t.TempDir()
+	st := NewStorageWithOptions(dataDir, Options{DryRun: true})
+
+	queue := st.NewQueue(constants.DownloadQueueFile, []collector.Episode{{JSONFile: "1245.json"}, {JSONFile: "1244.json"}})
+	if err := queue.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.Complete(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, constants.DownloadQueueFile)); !os.IsNotExist(err) {
+		t.Errorf("Expected a dry run not to write the queue, got %v", err)
+	}
+}
+
+func TestLoadQueueInvalid(t *testing.T) {
+	dataDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dataDir, constants.DownloadQueueFile), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewStorage(dataDir).LoadQueue(constants.DownloadQueueFile); err == nil {
+		t.Error("Expected a truncated queue to fail to load")
+	}
+}
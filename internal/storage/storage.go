@@ -1,36 +1,317 @@
 package storage
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/p4u/enguardia-arxiu/internal/atomicfile"
+	"github.com/p4u/enguardia-arxiu/internal/backend"
 	"github.com/p4u/enguardia-arxiu/internal/collector"
 	"github.com/p4u/enguardia-arxiu/internal/constants"
+	"github.com/p4u/enguardia-arxiu/internal/metrics"
+	"github.com/p4u/enguardia-arxiu/internal/report"
 )
 
 type Storage struct {
-	dataDir string
+	dataDir     string
+	audioClient *http.Client
+	imageClient *http.Client
+	now         func() time.Time
+	limits      Limits
+	dryRun      bool
+	overwrite   bool
+	report      *report.Report
+	metrics     *metrics.Metrics
+	layout      string
+	backend     backend.Backend
+
+	mu       sync.Mutex
+	manifest *Manifest         // Loaded on first use in the objects layout
+	byItemID map[string]string // JSON file of the stored episodes by 3Cat item ID, loaded on first use
+}
+
+// Options configures the dependencies used by a Storage
+type Options struct {
+	Client          *http.Client     // HTTP client for media downloads (nil = default clients)
+	Now             func() time.Time // Clock used to decide which episodes are due for repair
+	DownloadTimeout time.Duration    // Timeout of the default audio client
+	HTTPTimeout     time.Duration    // Timeout of the default image client
+	Limits          Limits
+	DryRun          bool             // Log the files that would be written instead of writing them
+	Overwrite       bool             // Download media again even if a complete file exists
+	Report          *report.Report   // Run report receiving downloads and failures (nil = none)
+	Metrics         *metrics.Metrics // Metrics receiving downloads, retries and failures (nil = none)
+	Layout          string           // Media layout, LayoutFlat or LayoutObjects (empty = flat)
+	Backend         backend.Backend  // Where the media is stored (nil = the data directory)
+}
+
+// Limits holds the size thresholds used to validate media files
+type Limits struct {
+	MinAudioFileSize int64 // Existing audio files above this size are kept
+	MinImageFileSize int64 // Existing and downloaded images must exceed this size
+	MinDownloadSize  int64 // Downloaded audio files must reach this size
+}
+
+// DefaultLimits returns the size thresholds from the constants package
+func DefaultLimits() Limits {
+	return Limits{
+		MinAudioFileSize: constants.MinAudioFileSize,
+		MinImageFileSize: constants.MinImageFileSize,
+		MinDownloadSize:  constants.MinDownloadSize,
+	}
 }
 
 func NewStorage(dataDir string) *Storage {
-	return &Storage{dataDir: dataDir}
+	return NewStorageWithOptions(dataDir, Options{})
+}
+
+// NewStorageWithOptions creates a storage, empty options fall back to the defaults
+func NewStorageWithOptions(dataDir string, opts Options) *Storage {
+	s := &Storage{
+		dataDir:     dataDir,
+		audioClient: opts.Client,
+		imageClient: opts.Client,
+		now:         opts.Now,
+		limits:      opts.Limits,
+		dryRun:      opts.DryRun,
+		overwrite:   opts.Overwrite,
+		report:      opts.Report,
+		metrics:     opts.Metrics,
+		layout:      opts.Layout,
+		backend:     opts.Backend,
+	}
+	if s.layout == "" {
+		s.layout = LayoutFlat
+	}
+	if s.backend == nil {
+		s.backend = backend.NewFilesystem(dataDir)
+	}
+
+	defaults := DefaultLimits()
+	if s.limits.MinAudioFileSize <= 0 {
+		s.limits.MinAudioFileSize = defaults.MinAudioFileSize
+	}
+	if s.limits.MinImageFileSize <= 0 {
+		s.limits.MinImageFileSize = defaults.MinImageFileSize
+	}
+	if s.limits.MinDownloadSize <= 0 {
+		s.limits.MinDownloadSize = defaults.MinDownloadSize
+	}
+
+	if opts.DownloadTimeout <= 0 {
+		opts.DownloadTimeout = constants.DownloadTimeout
+	}
+	if opts.HTTPTimeout <= 0 {
+		opts.HTTPTimeout = constants.HTTPTimeout
+	}
+	if s.audioClient == nil {
+		// HTTP client with redirect handling and longer timeout
+		s.audioClient = &http.Client{
+			Timeout:       opts.DownloadTimeout,
+			CheckRedirect: keepOpaquePath,
+		}
+	}
+	if s.imageClient == nil {
+		s.imageClient = &http.Client{
+			Timeout:       opts.HTTPTimeout,
+			CheckRedirect: keepOpaquePath,
+		}
+	}
+	if s.now == nil {
+		s.now = time.Now
+	}
+
+	return s
+}
+
+// keepOpaquePath preserves the raw path of redirected media requests
+func keepOpaquePath(req *http.Request, via []*http.Request) error {
+	req.URL.Opaque = req.URL.Path
+	return nil
+}
+
+// SaveEpisode stores the metadata of a scraped episode and returns the stored
+// version. A stored episode, found by its 3Cat item ID so that a retitled
+// episode keeps its files, is updated with the changed fields, which are
+// recorded in its history.
+func (s *Storage) SaveEpisode(episode collector.Episode) (collector.Episode, error) {
+	at := s.now().UTC().Format(time.RFC3339)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if name := s.storedFile(episode); name != "" {
+		jsonPath := filepath.Join(s.dataDir, name)
+		existing, err := s.loadEpisode(jsonPath)
+		if err != nil {
+			slog.Warn("Keeping unreadable metadata", "file", jsonPath, "error", err)
+			s.report.Add(report.MetadataExisting, 1)
+			return episode, nil
+		}
+		updated, changes := existing.Update(episode, at)
+		if len(changes) == 0 {
+			slog.Debug("Metadata already exists", "file", jsonPath)
+			s.report.Add(report.MetadataExisting, 1)
+			return existing, nil
+		}
+		for _, change := range changes {
+			slog.Info("Metadata changed", "file", jsonPath, "field", change.Field, "old", change.Old, "new", change.New)
+		}
+		if err := s.writeEpisode(jsonPath, updated); err != nil {
+			s.report.Fail(episode.Title, "metadata", err)
+			return existing, err
+		}
+		s.index(updated)
+		s.report.Add(report.MetadataUpdated, 1)
+		slog.Info("Metadata updated", "file", jsonPath)
+		return updated, nil
+	}
+
+	jsonPath := filepath.Join(s.dataDir, episode.JSONFile)
+	episode.History = append(episode.History, collector.HistoryEvent{At: at, Event: collector.EventFirstSeen})
+	if err := s.writeEpisode(jsonPath, episode); err != nil {
+		s.report.Fail(episode.Title, "metadata", err)
+		return episode, err
+	}
+	s.index(episode)
+
+	s.report.NewEpisode(episode.Title)
+	slog.Info("Metadata saved", "file", jsonPath)
+	return episode, nil
+}
+
+// storedFile returns the JSON file of the stored version of an episode: the
+// file of the episode with the same 3Cat item ID, or else the file named
+// after its title; empty when it is not stored. Callers must hold s.mu.
+func (s *Storage) storedFile(episode collector.Episode) string {
+	if s.byItemID == nil {
+		s.byItemID = make(map[string]string)
+		episodes, err := s.LoadEpisodes()
+		if err != nil {
+			slog.Warn("Failed to index stored episodes", "error", err)
+		}
+		for _, stored := range episodes {
+			s.index(stored)
+		}
+	}
+	if name := s.byItemID[episode.ItemID()]; name != "" && s.fileSize(name) > 0 {
+		return name
+	}
+	if s.fileSize(episode.JSONFile) > 0 {
+		return episode.JSONFile
+	}
+	return ""
+}
+
+// index records the JSON file of a stored episode, callers must hold s.mu
+func (s *Storage) index(episode collector.Episode) {
+	if id := episode.ItemID(); id != "" && s.byItemID != nil {
+		s.byItemID[id] = episode.JSONFile
+	}
+}
+
+// UpdateEpisode overwrites the stored metadata of an existing episode,
+// recording the changed fields in its history
+func (s *Storage) UpdateEpisode(episode collector.Episode) error {
+	if episode.JSONFile == "" {
+		return fmt.Errorf("no JSON file for episode: %s", episode.Title)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jsonPath := filepath.Join(s.dataDir, episode.JSONFile)
+	if existing, err := s.loadEpisode(jsonPath); err == nil {
+		changes := collector.Changes(existing, episode, s.now().UTC().Format(time.RFC3339))
+		episode.History = append(existing.History, changes...)
+		if reflect.DeepEqual(existing, episode) {
+			slog.Debug("Metadata unchanged", "file", jsonPath)
+			return nil
+		}
+	}
+	if err := s.writeEpisode(jsonPath, episode); err != nil {
+		return err
+	}
+
+	slog.Info("Metadata updated", "file", jsonPath)
+	return nil
 }
 
-func (s *Storage) SaveEpisode(episode collector.Episode) error {
+// addHistory appends an event to the stored history of an episode
+func (s *Storage) addHistory(episode collector.Episode, event collector.HistoryEvent) {
+	if s.dryRun || episode.JSONFile == "" {
+		return
+	}
+	event.At = s.now().UTC().Format(time.RFC3339)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	jsonPath := filepath.Join(s.dataDir, episode.JSONFile)
+	stored, err := s.loadEpisode(jsonPath)
+	if err == nil {
+		if repeatsLastEvent(stored.History, event) {
+			return
+		}
+		stored.History = append(stored.History, event)
+		err = s.writeEpisode(jsonPath, stored)
+	}
+	if err != nil {
+		slog.Warn("Failed to record episode history", "file", jsonPath, "event", event.Event, "error", err)
+	}
+}
+
+// repeatsLastEvent reports whether a media event repeats the last one of the
+// same media, such as a download failing again the same way, which is not
+// worth rewriting the episode for
+func repeatsLastEvent(history []collector.HistoryEvent, event collector.HistoryEvent) bool {
+	for i := len(history) - 1; i >= 0; i-- {
+		last := history[i]
+		if last.Field != event.Field || (last.Event != collector.EventMediaDownloaded && last.Event != collector.EventMediaFailed) {
+			continue
+		}
+		return last.Event == event.Event && last.New == event.New && last.Error == event.Error
+	}
+	return false
+}
+
+// FallbackAudioEpisodes returns the stored episodes stuck on the placeholder audio URL
+// whose retry is due
+func (s *Storage) FallbackAudioEpisodes() ([]collector.Episode, error) {
+	now := s.now()
+	episodes, err := s.LoadEpisodes()
+	if err != nil {
+		return nil, err
+	}
 
-	// Check if JSON file already exists and has content
-	if info, err := os.Stat(jsonPath); err == nil && info.Size() > 0 {
-		log.Printf("Metadata already exists: %s", jsonPath)
+	var due []collector.Episode
+	for _, episode := range episodes {
+		if episode.AudioRetryDue(now) {
+			due = append(due, episode)
+		}
+	}
+
+	return due, nil
+}
+
+func (s *Storage) writeEpisode(jsonPath string, episode collector.Episode) error {
+	if s.dryRun {
+		slog.Info("Dry run: would write", "file", jsonPath)
 		return nil
 	}
 
@@ -39,209 +320,273 @@ func (s *Storage) SaveEpisode(episode collector.Episode) error {
 		return fmt.Errorf("failed to marshal episode: %w", err)
 	}
 
-	if err := os.WriteFile(jsonPath, data, constants.FilePermissions); err != nil {
+	if err := atomicfile.WriteFile(jsonPath, data, constants.FilePermissions); err != nil {
 		return fmt.Errorf("failed to write JSON file: %w", err)
 	}
 
-	log.Printf("Metadata saved: %s", jsonPath)
 	return nil
 }
 
-func (s *Storage) DownloadAudio(episode collector.Episode) error {
+func (s *Storage) loadEpisode(jsonPath string) (collector.Episode, error) {
+	var episode collector.Episode
+
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		return episode, err
+	}
+
+	if err := json.Unmarshal(data, &episode); err != nil {
+		return episode, err
+	}
+
+	episode.JSONFile = filepath.Base(jsonPath)
+	return episode, nil
+}
+
+// DownloadAudio downloads the audio of an episode unless a complete file exists.
+// A cancelled context aborts the transfer and removes the partial file.
+func (s *Storage) DownloadAudio(ctx context.Context, episode collector.Episode) (err error) {
+	defer func() {
+		if ctx.Err() != nil {
+			return // Interrupted, not failed
+		}
+		s.report.Fail(episode.Title, "audio", err)
+		s.metrics.Fail("audio", err)
+	}()
+
 	if episode.AudioURL == "" {
 		return fmt.Errorf("no audio URL available for episode: %s", episode.Title)
 	}
 
 	// Skip if this is a failed audio URL
-	if strings.Contains(episode.AudioURL, "failed-audio") {
-		log.Printf("Skipping failed audio URL for episode: %s", episode.Title)
+	if episode.HasFallbackAudio() {
+		slog.Debug("Skipping fallback audio URL", "episode", episode.Title)
+		s.report.Add(report.FallbackAudio, 1)
 		return nil
 	}
 
-	audioPath := filepath.Join(s.dataDir, episode.Filename)
+	audioPath := s.mediaLocation(episode.Filename)
 
 	// Check if file already exists and has reasonable content
-	if info, err := os.Stat(audioPath); err == nil {
-		if info.Size() > constants.MinAudioFileSize {
-			log.Printf("Audio already exists (%d bytes): %s", info.Size(), audioPath)
+	if info, err := s.backend.Stat(ctx, episode.Filename); err == nil {
+		if s.overwrite {
+			// The complete file is replaced once the new download succeeds
+			slog.Info("Audio already exists, downloading again", "file", audioPath, "bytes", info.Size)
+		} else if info.Size > s.limits.MinAudioFileSize {
+			slog.Debug("Audio already exists", "file", audioPath, "bytes", info.Size)
+			s.report.Add(report.AudioExisting, 1)
+			// Archives downloaded before switching layouts move into the object store
+			if err := s.storeObject(episode.Filename, episode.AudioURL, ""); err != nil {
+				slog.Warn("Failed to store audio object", "file", audioPath, "error", err)
+			}
 			return nil
+		} else if s.dryRun {
+			slog.Warn("Audio file too small, would download again", "file", audioPath, "bytes", info.Size)
 		} else {
-			log.Printf("Audio file too small (%d bytes), re-downloading: %s", info.Size(), audioPath)
+			slog.Warn("Audio file too small, downloading again", "file", audioPath, "bytes", info.Size)
+			s.metrics.Retry("audio_download")
 			// Remove the incomplete file
-			if err := os.Remove(audioPath); err != nil {
-				log.Printf("Failed to remove incomplete audio file: %v", err)
+			if err := s.backend.Delete(ctx, episode.Filename); err != nil {
+				slog.Warn("Failed to remove incomplete audio file", "file", audioPath, "error", err)
 			}
 		}
 	}
 
-	log.Printf("Downloading audio from %s to %s", episode.AudioURL, audioPath)
-
-	// Create HTTP client with redirect handling and longer timeout
-	client := &http.Client{
-		Timeout: constants.DownloadTimeout,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			req.URL.Opaque = req.URL.Path
-			return nil
-		},
-	}
-
-	resp, err := client.Get(episode.AudioURL)
-	if err != nil {
-		return fmt.Errorf("failed to download audio: %w", err)
+	if linked, err := s.linkObject(episode.Filename, episode.AudioURL, s.limits.MinAudioFileSize); err != nil {
+		slog.Warn("Failed to link stored audio object", "file", audioPath, "error", err)
+	} else if linked {
+		s.report.Add(report.AudioExisting, 1)
+		return nil
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Printf("Failed to close response body: %v", err)
-		}
-	}()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("bad status: %s", resp.Status)
+	if s.dryRun {
+		slog.Info("Dry run: would download audio", "url", episode.AudioURL, "file", audioPath)
+		return nil
 	}
 
-	// Create temporary file first to avoid partial downloads
-	tempPath := audioPath + constants.TempSuffix
-	file, err := os.Create(tempPath)
-	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
-	}
-	defer func() {
-		if err := file.Close(); err != nil {
-			log.Printf("Failed to close temp file: %v", err)
-		}
-	}()
+	slog.Info("Downloading audio", "url", episode.AudioURL, "file", audioPath)
 
-	// Copy the content
-	size, err := io.Copy(file, resp.Body)
+	start := time.Now()
+	size, sum, err := s.download(ctx, s.audioClient, episode.AudioURL, episode.Filename, s.limits.MinDownloadSize)
 	if err != nil {
-		if removeErr := os.Remove(tempPath); removeErr != nil {
-			log.Printf("Failed to remove temp file after copy error: %v", removeErr)
+		if ctx.Err() == nil {
+			s.addHistory(episode, collector.HistoryEvent{Event: collector.EventMediaFailed, Field: "audio", Error: err.Error()})
 		}
-		return fmt.Errorf("failed to copy content: %w", err)
+		return fmt.Errorf("failed to download audio: %w", err)
 	}
+	s.addHistory(episode, collector.HistoryEvent{Event: collector.EventMediaDownloaded, Field: "audio", New: episode.Filename})
 
-	// Close the file before renaming
-	if err := file.Close(); err != nil {
-		log.Printf("Failed to close file before rename: %v", err)
+	slog.Info("Audio downloaded", "file", audioPath, "bytes", size)
+	s.report.Downloaded(report.AudioDownloaded, size)
+	s.metrics.Downloaded("audio", size, time.Since(start))
+	if err := s.storeObject(episode.Filename, episode.AudioURL, sum); err != nil {
+		slog.Warn("Failed to store audio object", "file", audioPath, "error", err)
 	}
+	return nil
+}
 
-	// Check if download was successful (reasonable file size)
-	if size < constants.MinDownloadSize {
-		if removeErr := os.Remove(tempPath); removeErr != nil {
-			log.Printf("Failed to remove small temp file: %v", removeErr)
-		}
-		return fmt.Errorf("downloaded file too small (%d bytes), probably an error", size)
+// RemoveMedia deletes a media file, missing files are not an error
+func (s *Storage) RemoveMedia(ctx context.Context, name string) error {
+	if s.dryRun {
+		slog.Info("Dry run: would delete", "file", s.mediaLocation(name))
+		return nil
 	}
-
-	// Rename temp file to final name
-	if err := os.Rename(tempPath, audioPath); err != nil {
-		if removeErr := os.Remove(tempPath); removeErr != nil {
-			log.Printf("Failed to remove temp file after rename error: %v", removeErr)
-		}
-		return fmt.Errorf("failed to rename temp file: %w", err)
+	if err := s.backend.Delete(ctx, name); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", name, err)
 	}
-
-	log.Printf("Download successful: %s (%d bytes)", audioPath, size)
 	return nil
 }
 
-func (s *Storage) DownloadImage(episode collector.Episode) error {
+// DownloadImage downloads the image of an episode unless a complete file exists.
+// A cancelled context aborts the transfer and removes the partial file.
+func (s *Storage) DownloadImage(ctx context.Context, episode collector.Episode) (err error) {
+	defer func() {
+		if ctx.Err() != nil {
+			return // Interrupted, not failed
+		}
+		s.report.Fail(episode.Title, "image", err)
+		s.metrics.Fail("image", err)
+	}()
+
 	if episode.Image == "" || episode.ImageFilename == "" {
-		log.Printf("No image URL or filename for episode: %s", episode.Title)
+		slog.Debug("No image URL or filename", "episode", episode.Title)
 		return nil
 	}
 
 	// Skip if this is a failed image URL
 	if strings.Contains(episode.Image, "failed-image") {
-		log.Printf("Skipping failed image URL for episode: %s", episode.Title)
+		slog.Debug("Skipping failed image URL", "episode", episode.Title)
 		return nil
 	}
 
-	imagePath := filepath.Join(s.dataDir, episode.ImageFilename)
+	imagePath := s.mediaLocation(episode.ImageFilename)
 
 	// Check if file already exists and has reasonable content
-	if info, err := os.Stat(imagePath); err == nil {
-		if info.Size() > constants.MinImageFileSize {
-			log.Printf("Image already exists (%d bytes): %s", info.Size(), imagePath)
+	if info, err := s.backend.Stat(ctx, episode.ImageFilename); err == nil {
+		if s.overwrite {
+			// The complete file is replaced once the new download succeeds
+			slog.Info("Image already exists, downloading again", "file", imagePath, "bytes", info.Size)
+		} else if info.Size > s.limits.MinImageFileSize {
+			slog.Debug("Image already exists", "file", imagePath, "bytes", info.Size)
+			s.report.Add(report.ImagesExisting, 1)
+			// Archives downloaded before switching layouts move into the object store
+			if err := s.storeObject(episode.ImageFilename, episode.Image, ""); err != nil {
+				slog.Warn("Failed to store image object", "file", imagePath, "error", err)
+			}
 			return nil
+		} else if s.dryRun {
+			slog.Warn("Image file too small, would download again", "file", imagePath, "bytes", info.Size)
 		} else {
-			log.Printf("Image file too small (%d bytes), re-downloading: %s", info.Size(), imagePath)
+			slog.Warn("Image file too small, downloading again", "file", imagePath, "bytes", info.Size)
+			s.metrics.Retry("image_download")
 			// Remove the incomplete file
-			if err := os.Remove(imagePath); err != nil {
-				log.Printf("Failed to remove incomplete image file: %v", err)
+			if err := s.backend.Delete(ctx, episode.ImageFilename); err != nil {
+				slog.Warn("Failed to remove incomplete image file", "file", imagePath, "error", err)
 			}
 		}
 	}
 
-	log.Printf("Downloading image from %s to %s", episode.Image, imagePath)
+	if linked, err := s.linkObject(episode.ImageFilename, episode.Image, s.limits.MinImageFileSize); err != nil {
+		slog.Warn("Failed to link stored image object", "file", imagePath, "error", err)
+	} else if linked {
+		s.report.Add(report.ImagesExisting, 1)
+		return nil
+	}
 
-	// Create HTTP client with redirect handling and timeout
-	client := &http.Client{
-		Timeout: constants.HTTPTimeout,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			req.URL.Opaque = req.URL.Path
-			return nil
-		},
+	if s.dryRun {
+		slog.Info("Dry run: would download image", "url", episode.Image, "file", imagePath)
+		return nil
 	}
 
-	resp, err := client.Get(episode.Image)
+	slog.Info("Downloading image", "url", episode.Image, "file", imagePath)
+
+	start := time.Now()
+	size, sum, err := s.download(ctx, s.imageClient, episode.Image, episode.ImageFilename, s.limits.MinImageFileSize)
 	if err != nil {
+		if ctx.Err() == nil {
+			s.addHistory(episode, collector.HistoryEvent{Event: collector.EventMediaFailed, Field: "image", Error: err.Error()})
+		}
 		return fmt.Errorf("failed to download image: %w", err)
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Printf("Failed to close response body: %v", err)
-		}
-	}()
+	s.addHistory(episode, collector.HistoryEvent{Event: collector.EventMediaDownloaded, Field: "image", New: episode.ImageFilename})
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("bad status: %s", resp.Status)
+	slog.Info("Image downloaded", "file", imagePath, "bytes", size)
+	s.report.Downloaded(report.ImagesDownloaded, size)
+	s.metrics.Downloaded("image", size, time.Since(start))
+	if err := s.storeObject(episode.ImageFilename, episode.Image, sum); err != nil {
+		slog.Warn("Failed to store image object", "file", imagePath, "error", err)
 	}
+	return nil
+}
 
-	// Create temporary file first to avoid partial downloads
-	tempPath := imagePath + constants.TempSuffix
-	file, err := os.Create(tempPath)
+// download streams a URL into the media backend, which only replaces an
+// existing file once the download is complete. Nothing is stored on any
+// failure, including a cancelled context. It returns the size and the hex
+// SHA-256 of the content.
+func (s *Storage) download(ctx context.Context, client *http.Client, url, name string, minSize int64) (int64, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
+		return 0, "", fmt.Errorf("invalid request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
 	}
 	defer func() {
-		if err := file.Close(); err != nil {
-			log.Printf("Failed to close temp file: %v", err)
+		if err := resp.Body.Close(); err != nil {
+			slog.Warn("Failed to close response body", "error", err)
 		}
 	}()
 
-	// Copy the content
-	size, err := io.Copy(file, resp.Body)
-	if err != nil {
-		if removeErr := os.Remove(tempPath); removeErr != nil {
-			log.Printf("Failed to remove temp file after copy error: %v", removeErr)
-		}
-		return fmt.Errorf("failed to copy content: %w", err)
+	if resp.StatusCode != http.StatusOK {
+		return 0, "", metrics.WithClass(metrics.ClassHTTPStatus, fmt.Errorf("bad status: %s", resp.Status))
 	}
 
-	// Close the file before renaming
-	if err := file.Close(); err != nil {
-		log.Printf("Failed to close file before rename: %v", err)
+	hash := sha256.New()
+	body := &sizeCheckReader{r: io.TeeReader(resp.Body, hash), min: minSize}
+	size, err := s.backend.Put(ctx, name, body, resp.ContentLength)
+	switch {
+	case body.tooSmall != nil:
+		return size, "", body.tooSmall
+	case err != nil && ctx.Err() != nil:
+		return size, "", fmt.Errorf("interrupted after %d bytes: %w", body.n, ctx.Err())
+	case err != nil:
+		return size, "", fmt.Errorf("failed to store content: %w", err)
 	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
 
-	// Check if download was successful (reasonable file size)
-	if size < constants.MinImageFileSize {
-		if removeErr := os.Remove(tempPath); removeErr != nil {
-			log.Printf("Failed to remove small temp file: %v", removeErr)
-		}
-		return fmt.Errorf("downloaded image file too small (%d bytes), probably an error", size)
+// sizeCheckReader fails at the end of a download smaller than min, so the
+// backend discards it instead of storing an error page
+type sizeCheckReader struct {
+	r        io.Reader
+	min      int64
+	n        int64
+	tooSmall error
+}
+
+func (c *sizeCheckReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if err == io.EOF && c.n < c.min {
+		// Check if download was successful (reasonable file size)
+		c.tooSmall = metrics.WithClass(metrics.ClassInvalid, fmt.Errorf("downloaded file too small (%d bytes), probably an error", c.n))
+		return n, c.tooSmall
 	}
+	return n, err
+}
 
-	// Rename temp file to final name
-	if err := os.Rename(tempPath, imagePath); err != nil {
-		if removeErr := os.Remove(tempPath); removeErr != nil {
-			log.Printf("Failed to remove temp file after rename error: %v", removeErr)
+// mediaLocation returns the local path or remote URL of a media file for logs
+func (s *Storage) mediaLocation(name string) string {
+	if fs, ok := s.backend.(*backend.Filesystem); ok {
+		if path, err := fs.Path(name); err == nil {
+			return path
 		}
-		return fmt.Errorf("failed to rename temp file: %w", err)
 	}
-
-	log.Printf("Image download successful: %s (%d bytes)", imagePath, size)
-	return nil
+	if url := s.backend.URL(name); url != "" {
+		return url
+	}
+	return name
 }
 
 func (s *Storage) LoadEpisodes() ([]collector.Episode, error) {
@@ -256,15 +601,9 @@ func (s *Storage) LoadEpisodes() ([]collector.Episode, error) {
 			return nil
 		}
 
-		data, err := os.ReadFile(path)
+		episode, err := s.loadEpisode(path)
 		if err != nil {
-			log.Printf("Failed to read %s: %v", path, err)
-			return nil
-		}
-
-		var episode collector.Episode
-		if err := json.Unmarshal(data, &episode); err != nil {
-			log.Printf("Failed to unmarshal %s: %v", path, err)
+			slog.Warn("Failed to load episode", "file", path, "error", err)
 			return nil
 		}
 
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/fake3cat"
+)
+
+var fakeNow = func() time.Time { return time.Date(2025, 9, 8, 10, 0, 0, 0, time.UTC) }
+
+// newFakeStorage saves the episodes of the fake 3Cat server into a new data
+// directory and, unless lazy, downloads their media. Media that fails to
+// download is left to the test.
+func newFakeStorage(t *testing.T, srv *fake3cat.Server, lazy bool) *Storage {
+	t.Helper()
+
+	c := collector.NewCollectorWithOptions(collector.Options{
+		APIBaseURL:   srv.APIBaseURL(),
+		SiteURL:      srv.SiteURL(),
+		MediaBaseURL: srv.MediaBaseURL(),
+		Client:       srv.Client(),
+		Now:          fakeNow,
+	})
+	episodes, err := c.ScrapeEpisodes(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to scrape episodes: %v", err)
+	}
+
+	st := NewStorageWithOptions(t.TempDir(), Options{Client: srv.Client(), Now: fakeNow})
+	for _, episode := range episodes {
+		episode, err := st.SaveEpisode(episode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lazy {
+			continue
+		}
+		if !episode.HasFallbackAudio() {
+			_ = st.DownloadAudio(context.Background(), episode)
+		}
+		_ = st.DownloadImage(context.Background(), episode)
+	}
+	return st
+}
+
+// findEpisode returns the stored episode with the given number
+func findEpisode(t *testing.T, st *Storage, number int) collector.Episode {
+	t.Helper()
+	episodes, err := st.LoadEpisodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, episode := range episodes {
+		if episode.Number() == number {
+			return episode
+		}
+	}
+	t.Fatalf("Episode %d not found", number)
+	return collector.Episode{}
+}
+
+func TestEpisodeHistory(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	srv.FailMedia("jpg/1/0/1005.jpg", 404)
+
+	st := newFakeStorage(t, srv, false)
+	events := func() string {
+		var events []string
+		for _, event := range findEpisode(t, st, 1241).History {
+			events = append(events, event.Event+" "+event.Field)
+		}
+		return strings.Join(events, ", ")
+	}
+	if got, want := events(), "first_seen , media_downloaded audio, media_failed image"; got != want {
+		t.Errorf("History = %s, want %s", got, want)
+	}
+
+	// Failing again the same way is not recorded and leaves the file untouched
+	episode := findEpisode(t, st, 1241)
+	jsonPath := filepath.Join(st.dataDir, episode.JSONFile)
+	before, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.DownloadImage(context.Background(), episode); err == nil {
+		t.Fatal("Expected the image to fail again")
+	}
+	if err := st.UpdateEpisode(findEpisode(t, st, 1241)); err != nil {
+		t.Fatal(err)
+	}
+	if after, err := os.ReadFile(jsonPath); err != nil || string(after) != string(before) {
+		t.Errorf("Expected an unchanged episode not to be rewritten (error %v)", err)
+	}
+
+	// A change is recorded
+	episode = findEpisode(t, st, 1241)
+	episode.Description = "Descripció nova"
+	if err := st.UpdateEpisode(episode); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := events(), "first_seen , media_downloaded audio, media_failed image, field_changed description"; got != want {
+		t.Errorf("History = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/p4u/enguardia-arxiu/internal/collector"
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+	"github.com/p4u/enguardia-arxiu/internal/metrics"
+)
+
+// Problem is an inconsistency found in the data directory
+type Problem struct {
+	File    string // File name relative to the data directory
+	Message string
+}
+
+func (p Problem) String() string {
+	return p.File + ": " + p.Message
+}
+
+// Summary describes the contents of the data directory
+type Summary struct {
+	Episodes      int   `json:"episodes"`
+	AudioFiles    int   `json:"audio_files"`
+	ImageFiles    int   `json:"image_files"`
+	FallbackAudio int   `json:"fallback_audio"`
+	LocalOnly     int   `json:"local_only"` // Removed from 3Cat, audio archived
+	Lost          int   `json:"lost"`       // Removed from 3Cat, audio never downloaded
+	AudioBytes    int64 `json:"audio_bytes"`
+	ImageBytes    int64 `json:"image_bytes"`
+}
+
+// HasEpisode reports whether the episode metadata is stored, under its own
+// title or an earlier one
+func (s *Storage) HasEpisode(episode collector.Episode) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.storedFile(episode) != ""
+}
+
+// HasAudio reports whether the episode audio has been downloaded
+func (s *Storage) HasAudio(episode collector.Episode) bool {
+	return s.mediaSize(episode.Filename) > s.limits.MinAudioFileSize
+}
+
+// HasImage reports whether the episode image has been downloaded
+func (s *Storage) HasImage(episode collector.Episode) bool {
+	return s.mediaSize(episode.ImageFilename) > s.limits.MinImageFileSize
+}
+
+// fileSize returns the size of a file in the data directory, or -1 if it does not exist
+func (s *Storage) fileSize(name string) int64 {
+	if name == "" {
+		return -1
+	}
+	info, err := os.Stat(filepath.Join(s.dataDir, name))
+	if err != nil || info.IsDir() {
+		return -1
+	}
+	return info.Size()
+}
+
+// mediaSize returns the size of a media file in the backend, or -1 if it does not exist
+func (s *Storage) mediaSize(name string) int64 {
+	if name == "" {
+		return -1
+	}
+	info, err := s.backend.Stat(context.Background(), name)
+	if err != nil {
+		return -1
+	}
+	return info.Size
+}
+
+// Summarize counts the stored episodes and downloaded media
+func (s *Storage) Summarize() (Summary, error) {
+	episodes, err := s.LoadEpisodes()
+	if err != nil {
+		return Summary{}, err
+	}
+
+	summary := Summary{Episodes: len(episodes)}
+	for _, episode := range episodes {
+		if episode.HasFallbackAudio() {
+			summary.FallbackAudio++
+		}
+		switch episode.Status {
+		case collector.StatusLocalOnly:
+			summary.LocalOnly++
+		case collector.StatusLost:
+			summary.Lost++
+		}
+		if s.HasAudio(episode) {
+			summary.AudioFiles++
+			summary.AudioBytes += s.mediaSize(episode.Filename)
+		}
+		if s.HasImage(episode) {
+			summary.ImageFiles++
+			summary.ImageBytes += s.mediaSize(episode.ImageFilename)
+		}
+	}
+
+	return summary, nil
+}
+
+// Availability counts the stored episodes by audio availability
+func (s *Storage) Availability() (map[string]int, error) {
+	episodes, err := s.LoadEpisodes()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, episode := range episodes {
+		switch {
+		case s.HasAudio(episode):
+			counts[metrics.AvailabilityDownloaded]++
+		case episode.Status == collector.StatusLost:
+			counts[metrics.AvailabilityLost]++
+		case episode.HasFallbackAudio():
+			counts[metrics.AvailabilityFallback]++
+		default:
+			counts[metrics.AvailabilityRemote]++
+		}
+	}
+	return counts, nil
+}
+
+// Verify checks the episode metadata and, unless metadataOnly is set, that the
+// referenced media files have been downloaded completely
+func (s *Storage) Verify(metadataOnly bool) ([]Problem, error) {
+	files, err := filepath.Glob(filepath.Join(s.dataDir, "*"+constants.JSONExtension))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list episode files: %w", err)
+	}
+
+	var problems []Problem
+	add := func(file, format string, args ...interface{}) {
+		problems = append(problems, Problem{File: file, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, path := range files {
+		name := filepath.Base(path)
+		episode, err := s.loadEpisode(path)
+		if err != nil {
+			add(name, "invalid metadata: %v", err)
+			continue
+		}
+
+		if episode.Title == "" {
+			add(name, "missing title")
+		}
+		if episode.AudioURL == "" {
+			add(name, "missing audio URL")
+		} else if episode.HasFallbackAudio() {
+			add(name, "audio URL is the fallback placeholder (%d failed attempts)", episode.AudioFailures)
+		}
+
+		if metadataOnly {
+			continue
+		}
+
+		if !episode.HasFallbackAudio() && episode.Filename != "" {
+			switch size := s.mediaSize(episode.Filename); {
+			case size < 0:
+				add(name, "audio file %s not downloaded", episode.Filename)
+			case size <= s.limits.MinAudioFileSize:
+				add(name, "audio file %s is incomplete (%d bytes)", episode.Filename, size)
+			}
+		}
+		if episode.Image != "" && episode.ImageFilename != "" && !strings.Contains(episode.Image, "failed-image") {
+			switch size := s.mediaSize(episode.ImageFilename); {
+			case size < 0:
+				add(name, "image file %s not downloaded", episode.ImageFilename)
+			case size <= s.limits.MinImageFileSize:
+				add(name, "image file %s is incomplete (%d bytes)", episode.ImageFilename, size)
+			}
+		}
+	}
+
+	// Leftovers of interrupted downloads
+	temps, err := filepath.Glob(filepath.Join(s.dataDir, "*"+constants.TempSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list temporary files: %w", err)
+	}
+	for _, path := range temps {
+		add(filepath.Base(path), "leftover temporary download")
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].File < problems[j].File
+	})
+
+	return problems, nil
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/p4u/enguardia-arxiu/internal/constants"
+	"github.com/p4u/enguardia-arxiu/internal/fake3cat"
+)
+
+func TestVerify(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+	srv.FailMedia("jpg/1/0/1005.jpg", 404)
+
+	st := newFakeStorage(t, srv, false)
+	problems := func(metadataOnly bool) []string {
+		t.Helper()
+		problems, err := st.Verify(metadataOnly)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var lines []string
+		for _, problem := range problems {
+			lines = append(lines, problem.String())
+		}
+		return lines
+	}
+
+	fallback := "1242-els-templers-catalans.json: audio URL is the fallback placeholder (1 failed attempts)"
+	if got := problems(true); strings.Join(got, "\n") != fallback {
+		t.Errorf("Metadata problems = %q, want only the fallback audio", got)
+	}
+
+	// Incomplete media and leftover downloads are reported too
+	if err := os.WriteFile(filepath.Join(st.dataDir, "1243-la-pesta-negra.mp3"), []byte("short"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(st.dataDir, "1244-els-almogàvers.mp3"+constants.TempSuffix), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"1241-jaume-i-el-conqueridor.json: image file 1241-jaume-i-el-conqueridor.jpg not downloaded",
+		fallback,
+		"1243-la-pesta-negra.json: audio file 1243-la-pesta-negra.mp3 is incomplete (5 bytes)",
+		"1244-els-almogàvers.mp3.tmp: leftover temporary download",
+	}
+	if got := problems(false); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	srv := fake3cat.NewServer()
+	defer srv.Close()
+
+	st := newFakeStorage(t, srv, false)
+	summary, err := st.Summarize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Summary{
+		Episodes:      5,
+		AudioFiles:    4,
+		ImageFiles:    4,
+		FallbackAudio: 1,
+		AudioBytes:    4 * fake3cat.AudioSize,
+		ImageBytes:    4 * fake3cat.ImageSize,
+	}
+	if summary != want {
+		t.Errorf("Summary = %+v, want %+v", summary, want)
+	}
+}
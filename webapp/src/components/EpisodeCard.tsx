@@ -91,8 +91,8 @@ export const EpisodeCard = memo(function EpisodeCard({
         {episode.image && (
           <Box position="relative" overflow="hidden">
             <Image
-              src={episode.image}
-              alt={episode.title}
+              src={episode.thumbnail || episode.image}
+              alt={episode.imageAlt || episode.title}
               w="full"
               h="200px"
               objectFit="cover"
@@ -4,16 +4,26 @@ import {
   Heading,
   HStack,
   IconButton,
+  Select,
   useColorMode,
   useColorModeValue,
 } from '@chakra-ui/react'
 import { MoonIcon, SunIcon } from '@chakra-ui/icons'
-import { Link as RouterLink } from 'react-router-dom'
+import { Link as RouterLink, useNavigate } from 'react-router-dom'
+import { useEpisodes } from '@/contexts/EpisodesContext'
 
 export function Header() {
   const { colorMode, toggleColorMode } = useColorMode()
   const bg = useColorModeValue('white', 'gray.800')
   const borderColor = useColorModeValue('gray.200', 'gray.700')
+  const { programs, program, setProgram } = useEpisodes()
+  const navigate = useNavigate()
+
+  // Episode IDs belong to one programme, so a switch goes back home
+  const handleProgramChange = (slug: string) => {
+    setProgram(slug)
+    navigate('/')
+  }
 
   return (
     <Box
@@ -33,6 +43,21 @@ export function Header() {
           </RouterLink>
           
           <HStack spacing={4}>
+            {programs.length > 1 && (
+              <Select
+                aria-label="Programa"
+                size="sm"
+                maxW="xs"
+                value={program}
+                onChange={(e) => handleProgramChange(e.target.value)}
+              >
+                {programs.map((p) => (
+                  <option key={p.slug} value={p.slug}>
+                    {p.title}
+                  </option>
+                ))}
+              </Select>
+            )}
             <IconButton
               aria-label="Toggle color mode"
               icon={colorMode === 'light' ? <MoonIcon /> : <SunIcon />}
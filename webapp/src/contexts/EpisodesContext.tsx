@@ -1,12 +1,17 @@
 import { createContext, useContext, useEffect, useState, ReactNode } from 'react'
-import type { WebappData, Episode, Stats, Config, SearchFilters } from '@/types/episode'
-import { loadWebappData, searchEpisodes, filterEpisodesByCategory, sortEpisodes } from '@/utils/dataLoader'
+import type { WebappData, Episode, Stats, Config, SearchFilters, ProgramSummary } from '@/types/episode'
+import { loadPrograms, loadWebappData, searchEpisodes, filterEpisodesByCategory, sortEpisodes } from '@/utils/dataLoader'
 
 interface EpisodesContextType {
   // Data
   episodes: Episode[]
   stats: Stats
   config: Config
+
+  // Programmes of a multi-programme site, empty for a single programme
+  programs: ProgramSummary[]
+  program: string
+  setProgram: (slug: string) => void
   
   // Filtered/searched episodes
   filteredEpisodes: Episode[]
@@ -30,6 +35,8 @@ interface EpisodesContextType {
 
 const EpisodesContext = createContext<EpisodesContextType | undefined>(undefined)
 
+const PROGRAM_STORAGE_KEY = 'enguardia-program'
+
 interface EpisodesProviderProps {
   children: ReactNode
 }
@@ -64,6 +71,8 @@ export function EpisodesProvider({ children }: EpisodesProviderProps) {
     },
   })
   
+  const [programs, setPrograms] = useState<ProgramSummary[]>([])
+  const [program, setProgramState] = useState('')
   const [isLoading, setIsLoading] = useState(true)
   const [error, setError] = useState<string | null>(null)
   const [searchFilters, setSearchFilters] = useState<SearchFilters>({
@@ -78,15 +87,19 @@ export function EpisodesProvider({ children }: EpisodesProviderProps) {
 
   // Load data on mount
   useEffect(() => {
-    loadData()
+    loadData(localStorage.getItem(PROGRAM_STORAGE_KEY) ?? '')
   }, [])
 
-  const loadData = async () => {
+  const loadData = async (slug: string) => {
     try {
       setIsLoading(true)
       setError(null)
       console.log('EpisodesContext: Starting to load data...')
-      const data = await loadWebappData()
+      const index = await loadPrograms()
+      const selected = index.find(p => p.slug === slug) ?? index[0]
+      const data = await loadWebappData(selected?.dataPath)
+      setPrograms(index)
+      setProgramState(selected?.slug ?? '')
       console.log('EpisodesContext: Data loaded, setting webappData:', {
         episodesCount: data.episodes.length,
         firstEpisode: data.episodes[0]?.title,
@@ -167,13 +180,23 @@ export function EpisodesProvider({ children }: EpisodesProviderProps) {
   }
 
   const refreshData = async () => {
-    await loadData()
+    await loadData(program)
+  }
+
+  // The categories and tags of one programme mean nothing in another
+  const setProgram = (slug: string) => {
+    localStorage.setItem(PROGRAM_STORAGE_KEY, slug)
+    setSearchFilters(filters => ({ ...filters, category: undefined, tags: undefined }))
+    loadData(slug)
   }
 
   const value: EpisodesContextType = {
     episodes: webappData.episodes,
     stats: webappData.stats,
     config: webappData.config,
+    programs,
+    program,
+    setProgram,
     filteredEpisodes,
     isLoading,
     error,
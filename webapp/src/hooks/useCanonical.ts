@@ -0,0 +1,22 @@
+import { useEffect } from 'react'
+
+// Points the canonical link of the document to url while the component is mounted
+export function useCanonical(url?: string) {
+  useEffect(() => {
+    if (!url) {
+      return
+    }
+
+    let link = document.querySelector<HTMLLinkElement>('link[rel="canonical"]')
+    if (!link) {
+      link = document.createElement('link')
+      link.rel = 'canonical'
+      document.head.appendChild(link)
+    }
+    link.href = url
+
+    return () => {
+      link?.remove()
+    }
+  }, [url])
+}
@@ -1,12 +1,14 @@
 import { Box, Text } from '@chakra-ui/react'
 import { useParams } from 'react-router-dom'
 import { useEpisodes } from '@/contexts/EpisodesContext'
+import { useCanonical } from '@/hooks/useCanonical'
 
 export function EpisodePage() {
   const { id } = useParams<{ id: string }>()
-  const { getEpisodeById } = useEpisodes()
+  const { getEpisodeById, config } = useEpisodes()
   
   const episode = id ? getEpisodeById(id) : null
+  useCanonical(episode && config.episodeUrl ? config.episodeUrl.replace('{id}', episode.id) : undefined)
 
   if (!episode) {
     return (
@@ -38,6 +38,7 @@ import { useAudioPlayer } from '@/contexts/AudioPlayerContext'
 import { useUserPreferences } from '@/contexts/UserPreferencesContext'
 import { EpisodeCard } from '@/components/EpisodeCard'
 import { useDebounce } from '@/hooks/useDebounce'
+import { useCanonical } from '@/hooks/useCanonical'
 import type { Episode } from '@/types/episode'
 
 interface TagGroup {
@@ -48,9 +49,10 @@ interface TagGroup {
 
 export function HomePage() {
   const episodesContext = useEpisodes()
-  const { episodes, isLoading, error } = episodesContext
+  const { episodes, isLoading, error, config } = episodesContext
   const { play, currentEpisode, isPlaying } = useAudioPlayer()
   const { favourites, listened } = useUserPreferences()
+  useCanonical(config.siteUrl)
   
   console.log('HomePage: Full useEpisodes context:', episodesContext)
   console.log('HomePage: Rendering with:', {
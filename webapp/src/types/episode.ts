@@ -7,7 +7,11 @@ export interface Episode {
   parsedDate: string
   link: string
   audioUrl: string
+  audioType?: string
+  audioRenditions?: AudioRendition[]
   image: string
+  imageAlt?: string
+  thumbnail?: string
   filename: string
   jsonFile: string
   fileSize?: number
@@ -16,6 +20,13 @@ export interface Episode {
   category?: string
 }
 
+export interface AudioRendition {
+  url: string
+  format?: string
+  duration?: string
+  bitrate?: number
+}
+
 export interface Stats {
   totalEpisodes: number
   totalDuration: string
@@ -38,6 +49,8 @@ export interface Config {
   description: string
   language: string
   audioBaseUrl: string
+  siteUrl?: string
+  episodeUrl?: string // Canonical episode URL, {id} replaced by the episode ID
   supportsModes: string[]
   version: string
   buildTime: string
@@ -51,6 +64,17 @@ export interface Theme {
   backgroundUrl?: string
 }
 
+// One programme of a multi-programme site, from data/programs.json
+export interface ProgramSummary {
+  slug: string
+  title: string
+  description: string
+  language: string
+  dataPath: string // Data directory of the programme, relative to the base URL
+  totalEpisodes: number
+  availableCount: number
+}
+
 export interface WebappData {
   episodes: Episode[]
   stats: Stats
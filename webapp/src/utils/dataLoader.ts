@@ -1,8 +1,23 @@
-import type { WebappData, Episode, Stats, Config } from '@/types/episode'
+import type { WebappData, Episode, Stats, Config, ProgramSummary } from '@/types/episode'
+
+// loadPrograms returns the programme index of a multi-programme site, or an
+// empty list when the data directory holds a single programme
+export async function loadPrograms(): Promise<ProgramSummary[]> {
+  try {
+    const response = await fetch(`${import.meta.env.BASE_URL}data/programs.json`)
+    if (!response.ok) {
+      return []
+    }
+    return ((await response.json()) as ProgramSummary[] | null) ?? []
+  } catch {
+    // Single-programme sites have no index, and dev servers may answer with index.html
+    return []
+  }
+}
 
 // This will be replaced at build time with the actual data
 // Vite will inline the JSON files during the build process
-export async function loadWebappData(): Promise<WebappData> {
+export async function loadWebappData(dataPath = 'data'): Promise<WebappData> {
   try {
     // Get the base URL from Vite's environment (respects --base flag)
     const baseUrl = import.meta.env.BASE_URL
@@ -10,9 +25,9 @@ export async function loadWebappData(): Promise<WebappData> {
     // In development, load from the data directory
     // In production, these will be inlined by Vite
     const [episodesResponse, statsResponse, configResponse] = await Promise.all([
-      fetch(`${baseUrl}data/episodes-list.json`),
-      fetch(`${baseUrl}data/stats.json`),
-      fetch(`${baseUrl}data/config.json`),
+      fetch(`${baseUrl}${dataPath}/episodes-list.json`),
+      fetch(`${baseUrl}${dataPath}/stats.json`),
+      fetch(`${baseUrl}${dataPath}/config.json`),
     ])
 
     if (!episodesResponse.ok || !statsResponse.ok || !configResponse.ok) {
@@ -28,6 +43,7 @@ export async function loadWebappData(): Promise<WebappData> {
     console.log('Data loaded successfully:', {
       episodesCount: episodes.length,
       baseUrl,
+      dataPath,
       statsTotal: stats.totalEpisodes,
       configTitle: config.title
     })
@@ -45,8 +45,10 @@ export default defineConfig(({ command, mode }) => {
         },
         workbox: {
           globPatterns: ['**/*.{js,css,html,ico,png,svg,json,mp3}'],
+          // Static episode pages are for link previews and search engines
+          globIgnores: ['**/episodes/**'],
           navigateFallback: './offline.html',
-          navigateFallbackDenylist: [/^\/_/, /\/[^/?]+\.[^/]+$/],
+          navigateFallbackDenylist: [/^\/_/, /\/[^/?]+\.[^/]+$/, /\/episodes\//],
           maximumFileSizeToCacheInBytes: 5 * 1024 * 1024, // 5MB
         runtimeCaching: [
           {